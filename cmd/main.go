@@ -1,13 +1,20 @@
 package main
 
 import (
+	"context"
 	"html/template"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"01.tomorrow-school.ai/git/zsakhipo/forum/database"
 	"01.tomorrow-school.ai/git/zsakhipo/forum/handlers"
+	"01.tomorrow-school.ai/git/zsakhipo/forum/mailer"
 )
 
 func nl2br(text string) template.HTML {
@@ -22,12 +29,70 @@ func main() {
 	http.HandleFunc("/login", handlers.Login(db))
 	http.HandleFunc("/logout", handlers.Logout(db))
 	http.HandleFunc("/posts", handlers.Posts(db))
+	http.HandleFunc("/tag/{name}", handlers.Posts(db)) // Посты с тегом
 	http.HandleFunc("/post/create", handlers.CreatePost(db))
+	http.HandleFunc("/drafts", handlers.Drafts(db))
+	http.HandleFunc("/drafts/delete", handlers.DeleteDraft(db))
+	http.HandleFunc("/scheduled", handlers.ScheduledPosts(db))
+	http.HandleFunc("/scheduled/reschedule", handlers.ReschedulePost(db))
+	http.HandleFunc("/scheduled/cancel", handlers.CancelScheduledPost(db)) // Пост возвращается в черновики
 	http.HandleFunc("/comment", handlers.Comments(db))
 	http.HandleFunc("/like", handlers.Like(db))
-	http.HandleFunc("/post/delete", handlers.DeletePost(db))
+	http.HandleFunc("/bookmark", handlers.Bookmark(db))
+	http.HandleFunc("/post/{id}/subscribe", handlers.SubscribeThread(db))
 	http.HandleFunc("/edit-post", handlers.EditPost(db))
-	http.HandleFunc("/comment/delete", handlers.DeleteComment(db))
+	http.HandleFunc("/preview", handlers.Preview(db))
+	http.HandleFunc("/account/tokens", handlers.AccountTokens(db))
+	http.HandleFunc("/account/tokens/revoke", handlers.RevokeToken(db))
+	http.HandleFunc("/notifications", handlers.Notifications(db))
+	http.HandleFunc("/notifications/read", handlers.MarkNotificationsRead(db))
+	http.HandleFunc("/notifications/preferences", handlers.NotificationPreferences(db))
+	http.HandleFunc("/account/digest", handlers.AccountDigest(db))
+	http.HandleFunc("/account/profile", handlers.AccountProfile(db))
+	http.HandleFunc("/account/avatar", handlers.AccountAvatar(db))
+	http.HandleFunc("/avatar/{name}", handlers.Avatar(db))
+	http.HandleFunc("/user/{name}", handlers.Profile(db))
+	http.HandleFunc("/user/{name}/follow", handlers.FollowUser(db))
+	http.HandleFunc("/category/{name}/follow", handlers.FollowCategory(db))
+	http.HandleFunc("/digest/unsubscribe", handlers.DigestUnsubscribe(db))
+
+	// Личные сообщения; модераторы видят только сообщения, на которые пожаловались
+	http.HandleFunc("/messages", handlers.Messages(db))
+	http.HandleFunc("/messages/{id}", handlers.ConversationPage(db))
+	http.HandleFunc("/messages/report", handlers.ReportMessage(db))
+	http.HandleFunc("/account/blocks", handlers.AccountBlocks(db))
+	http.HandleFunc("/account/blocks/remove", handlers.UnblockUser(db))
+	http.HandleFunc("/moderation/reports", handlers.ModerationReports(db))
+	http.HandleFunc("/moderation/reports/resolve", handlers.ResolveReport(db))
+
+	// Администрирование webhook и журнал доставок (только роль admin)
+	http.HandleFunc("/admin/webhooks", handlers.AdminWebhooks(db))
+	http.HandleFunc("/admin/webhooks/delete", handlers.DeleteWebhook(db))
+	http.HandleFunc("/admin/webhooks/deliveries", handlers.WebhookDeliveries(db))
+	http.HandleFunc("/admin/webhooks/deliveries/replay", handlers.ReplayWebhookDelivery(db))
+
+	// Управление категориями (только роль admin)
+	http.HandleFunc("/admin/categories", handlers.AdminCategories(db))
+	http.HandleFunc("/admin/categories/update", handlers.UpdateCategory(db))
+	http.HandleFunc("/admin/categories/archive", handlers.ArchiveCategory(db))
+	http.HandleFunc("/admin/categories/move", handlers.MoveCategory(db))
+	http.HandleFunc("/admin/categories/merge", handlers.MergeCategory(db))
+
+	// Поток событий для живого обновления страниц
+	http.HandleFunc("/events", handlers.Events(db))
+
+	// WebSocket-канал обсуждения поста: комментарии, голоса и «печатает…»
+	http.HandleFunc("/post/{id}/live", handlers.PostLive(db))
+
+	// RSS/Atom-ленты (?format=atom — Atom, по умолчанию RSS 2.0)
+	http.HandleFunc("/feed.xml", handlers.Feed(db))
+	http.HandleFunc("/category/{name}/feed.xml", handlers.CategoryFeed(db))
+	http.HandleFunc("/user/{name}/feed.xml", handlers.UserFeed(db))
+	http.HandleFunc("/post/{id}/feed.xml", handlers.PostCommentsFeed(db))
+
+	// JSON API v1, спецификация /api/openapi.json и JSON-адреса страниц вроде /post/delete
+	// (маршруты — в handlers.RegisterAPI)
+	handlers.RegisterAPI(http.DefaultServeMux, db)
 
 	// Отдача статических файлов (CSS, JS и т.д.)
 	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
@@ -45,6 +110,43 @@ func main() {
 		tmpl.Execute(w, map[string]string{"Message": "404 - Page not found"})
 	})
 
-	log.Println("Server starting on :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	// Остановка по SIGINT/SIGTERM: закрываем потоки событий и WebSocket-соединения,
+	// ждём завершения текущих запросов
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	server := &http.Server{
+		Addr:        ":8080",
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	// Отправка webhook из очереди в БД
+	go handlers.StartWebhookWorker(ctx, db)
+
+	// Публикация запланированных постов в назначенное время
+	go handlers.StartPostScheduler(ctx, db)
+
+	// Рассылка дайджестов: SMTP из FORUM_SMTP_ADDR или файлы .eml в FORUM_MAIL_DIR,
+	// FORUM_BASE_URL — адрес форума для ссылок в письмах
+	baseURL := os.Getenv("FORUM_BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+	go handlers.StartDigestScheduler(ctx, db, mailer.FromEnv(), strings.TrimSuffix(baseURL, "/"))
+
+	go func() {
+		log.Println("Server starting on :8080")
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down...")
+	// Shutdown не ждёт перехваченные соединения, поэтому WebSocket закрываем сами
+	handlers.CloseLiveConnections()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Println("Error during shutdown:", err)
+	}
 }
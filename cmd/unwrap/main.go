@@ -0,0 +1,47 @@
+// Команда unwrap однократно убирает из существующих постов переводы строк,
+// которые старый перенос по словам вставлял при сохранении. Сначала стоит посмотреть
+// список изменений без записи в базу:
+//
+//	go run ./cmd/unwrap -db forum.db -dry-run
+//	go run ./cmd/unwrap -db forum.db
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"01.tomorrow-school.ai/git/zsakhipo/forum/database"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	path := flag.String("db", "forum.db", "path to the forum database")
+	dryRun := flag.Bool("dry-run", false, "only list the posts that would change")
+	flag.Parse()
+
+	if _, err := os.Stat(*path); err != nil {
+		fmt.Fprintln(os.Stderr, "unwrap:", err)
+		return 1
+	}
+	db := database.Init(*path)
+	defer db.Close()
+
+	changes, err := database.UnwrapLegacyBreaks(db, *dryRun)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "unwrap:", err)
+		return 1
+	}
+	for _, c := range changes {
+		fmt.Printf("post %d %s: %q -> %q\n", c.PostID, c.Field, c.Before, c.After)
+	}
+	if *dryRun {
+		fmt.Printf("%d field(s) would be updated\n", len(changes))
+	} else {
+		fmt.Printf("%d field(s) updated\n", len(changes))
+	}
+	return 0
+}
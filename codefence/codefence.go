@@ -0,0 +1,33 @@
+// Пакет codefence распознаёт блоки кода Markdown (``` и ~~~). Одно правило используют
+// рендер Markdown и исправление старого переноса строк в базе, чтобы они одинаково
+// решали, какой текст относится к коду.
+package codefence
+
+import "strings"
+
+// Opening возвращает ограничитель блока кода (``` или ~~~ и длиннее), если строка его открывает.
+// Как в CommonMark: отступ не больше трёх пробелов, после ``` в строке нет обратных кавычек.
+func Opening(line string) string {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 || len(trimmed) < 3 {
+		return ""
+	}
+	c := trimmed[0]
+	if c != '`' && c != '~' {
+		return ""
+	}
+	n := 0
+	for n < len(trimmed) && trimmed[n] == c {
+		n++
+	}
+	if n < 3 || (c == '`' && strings.Contains(trimmed[n:], "`")) {
+		return ""
+	}
+	return trimmed[:n]
+}
+
+// Closes сообщает, закрывает ли строка блок кода: те же символы, не меньше, чем в открывающем
+func Closes(line, fence string) bool {
+	trimmed := strings.TrimSpace(line)
+	return strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == ""
+}
@@ -3,6 +3,9 @@ package database
 import (
 	"database/sql"
 	"log"
+	"strconv"
+	"strings"
+	"unicode"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -68,6 +71,177 @@ func Init(path string) *sql.DB {
 			FOREIGN KEY(post_id) REFERENCES posts(id) ON DELETE CASCADE,
 			FOREIGN KEY(category_id) REFERENCES categories(id) ON DELETE CASCADE
 		);`,
+		`CREATE TABLE IF NOT EXISTS tags (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT UNIQUE NOT NULL -- В нормализованном виде: нижний регистр, пробелы заменены дефисами
+		);`,
+		`CREATE TABLE IF NOT EXISTS post_tags (
+			post_id INTEGER NOT NULL,
+			tag_id INTEGER NOT NULL,
+			PRIMARY KEY (post_id, tag_id),
+			FOREIGN KEY(post_id) REFERENCES posts(id) ON DELETE CASCADE,
+			FOREIGN KEY(tag_id) REFERENCES tags(id) ON DELETE CASCADE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_post_tags_tag ON post_tags(tag_id);`,
+		`CREATE TABLE IF NOT EXISTS drafts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			title TEXT NOT NULL DEFAULT '',
+			content TEXT NOT NULL DEFAULT '',
+			category_ids TEXT NOT NULL DEFAULT '', -- ID категорий через запятую; проверяются при публикации
+			tags TEXT NOT NULL DEFAULT '',         -- Теги в том виде, как введены в форме
+			image_path TEXT NOT NULL DEFAULT '',   -- Загруженное изображение, ещё не привязанное к посту
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_drafts_user ON drafts(user_id, updated_at);`,
+		`CREATE TABLE IF NOT EXISTS api_tokens (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			token_hash TEXT UNIQUE NOT NULL, -- SHA-256 от токена, сам токен не хранится
+			scopes TEXT NOT NULL,            -- Права через запятую: read,write,moderate
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			last_used_at DATETIME,
+			expires_at DATETIME,             -- NULL, если токен бессрочный
+			FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS notifications (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,  -- Получатель
+			actor_id INTEGER NOT NULL, -- Пользователь, совершивший действие
+			type TEXT NOT NULL,        -- comment, post_like, comment_like, ...
+			post_id INTEGER,
+			comment_id INTEGER,        -- NULL, если уведомление относится к посту
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			read_at DATETIME,          -- NULL, пока уведомление не прочитано
+			FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY(actor_id) REFERENCES users(id) ON DELETE CASCADE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, read_at);`,
+		`CREATE TABLE IF NOT EXISTS notification_optouts (
+			user_id INTEGER NOT NULL,
+			type TEXT NOT NULL, -- Тип уведомлений, которые пользователь отключил
+			PRIMARY KEY (user_id, type),
+			FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS webhooks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			url TEXT NOT NULL,
+			secret TEXT NOT NULL,              -- Ключ HMAC-подписи доставок
+			events TEXT NOT NULL,              -- События через запятую: post.created,comment.created,post.deleted
+			category TEXT NOT NULL DEFAULT '', -- Только посты этой категории; пусто — все категории
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			webhook_id INTEGER NOT NULL,
+			event TEXT NOT NULL,
+			payload TEXT NOT NULL,                  -- Тело запроса; повторная отправка использует его без изменений
+			status TEXT NOT NULL DEFAULT 'pending', -- pending, delivered или failed
+			attempts INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at DATETIME NOT NULL,
+			response_code INTEGER,                  -- Код ответа последней попытки; NULL, если ответа не было
+			last_error TEXT NOT NULL DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			delivered_at DATETIME,
+			FOREIGN KEY(webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);`,
+		`CREATE TABLE IF NOT EXISTS digest_settings (
+			user_id INTEGER PRIMARY KEY,
+			frequency TEXT NOT NULL DEFAULT 'off', -- off, daily или weekly
+			last_sent_at DATETIME,                 -- NULL, пока дайджест не отправлялся
+			FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS category_follows (
+			user_id INTEGER NOT NULL,
+			category_id INTEGER NOT NULL, -- Новые посты категории попадают в дайджест и ленту «Following»
+			PRIMARY KEY (user_id, category_id),
+			FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY(category_id) REFERENCES categories(id) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS follows (
+			follower_id INTEGER NOT NULL,
+			followed_id INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (follower_id, followed_id),
+			FOREIGN KEY(follower_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY(followed_id) REFERENCES users(id) ON DELETE CASCADE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_follows_followed ON follows(followed_id);`,
+		`CREATE TABLE IF NOT EXISTS bookmarks (
+			user_id INTEGER NOT NULL,
+			post_id INTEGER NOT NULL,
+			label TEXT NOT NULL DEFAULT '', -- Личная метка для группировки закладок; видна только владельцу
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, post_id),
+			FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY(post_id) REFERENCES posts(id) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS thread_subscriptions (
+			user_id INTEGER NOT NULL,
+			post_id INTEGER NOT NULL,
+			muted BOOLEAN NOT NULL DEFAULT false, -- Заглушённая тема: уведомлений нет, автоподписка не возобновляет
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, post_id),
+			FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY(post_id) REFERENCES posts(id) ON DELETE CASCADE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_thread_subscriptions_post ON thread_subscriptions(post_id);`,
+		`CREATE TABLE IF NOT EXISTS conversations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			created_by INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP, -- Время последнего сообщения
+			FOREIGN KEY(created_by) REFERENCES users(id) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS conversation_members (
+			conversation_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			last_read_message_id INTEGER NOT NULL DEFAULT 0, -- Сообщения с большим ID не прочитаны
+			PRIMARY KEY (conversation_id, user_id),
+			FOREIGN KEY(conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+			FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_conversation_members_user ON conversation_members(user_id);`,
+		`CREATE TABLE IF NOT EXISTS messages (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			conversation_id INTEGER NOT NULL,
+			sender_id INTEGER NOT NULL,
+			content TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			removed_at DATETIME, -- Скрыто модератором по жалобе
+			FOREIGN KEY(conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+			FOREIGN KEY(sender_id) REFERENCES users(id) ON DELETE CASCADE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_messages_conversation ON messages(conversation_id, id);`,
+		`CREATE TABLE IF NOT EXISTS user_blocks (
+			blocker_id INTEGER NOT NULL,
+			blocked_id INTEGER NOT NULL, -- Не может писать blocker_id; его сообщения в группах скрыты
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (blocker_id, blocked_id),
+			FOREIGN KEY(blocker_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY(blocked_id) REFERENCES users(id) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS message_reports (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			message_id INTEGER NOT NULL,
+			reporter_id INTEGER NOT NULL,
+			reason TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'open', -- open, dismissed или removed
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			resolved_by INTEGER,
+			resolved_at DATETIME,
+			UNIQUE(message_id, reporter_id),
+			FOREIGN KEY(message_id) REFERENCES messages(id) ON DELETE CASCADE,
+			FOREIGN KEY(reporter_id) REFERENCES users(id) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS app_secrets (
+			name TEXT PRIMARY KEY,
+			value TEXT NOT NULL -- Ключи подписи, созданные при первом использовании
+		);`,
 	}
 
 	// Выполняем запросы для создания всех таблиц
@@ -78,14 +252,57 @@ func Init(path string) *sql.DB {
 		}
 	}
 
-	// Вставляем предопределенные категории, если их еще нет.
+	// Миграции существующих баз: добавление новых столбцов.
+	// Ошибка "duplicate column name" означает, что столбец уже добавлен.
+	migrations := []string{
+		`ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user'`, // user, moderator или admin
+		`ALTER TABLE posts ADD COLUMN updated_at DATETIME`,               // NULL, если пост не изменялся
+		`ALTER TABLE comments ADD COLUMN updated_at DATETIME`,
+		`ALTER TABLE users ADD COLUMN created_at DATETIME`, // NULL у пользователей, зарегистрированных до появления поля
+		`ALTER TABLE users ADD COLUMN display_name TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE users ADD COLUMN bio TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE users ADD COLUMN avatar TEXT NOT NULL DEFAULT ''`,    // Ключ файлов аватара; пусто — идентикон
+		`ALTER TABLE categories ADD COLUMN slug TEXT NOT NULL DEFAULT ''`, // Имя в адресах; заполняется ниже
+		`ALTER TABLE categories ADD COLUMN description TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE categories ADD COLUMN color TEXT NOT NULL DEFAULT ''`, // #rrggbb; пусто — цвет по умолчанию
+		`ALTER TABLE categories ADD COLUMN icon TEXT NOT NULL DEFAULT ''`,  // Имя иконки Font Awesome без префикса fa-
+		`ALTER TABLE categories ADD COLUMN position INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE categories ADD COLUMN archived BOOLEAN NOT NULL DEFAULT false`,  // Новые посты в категорию не принимаются
+		`ALTER TABLE categories ADD COLUMN parent_id INTEGER NOT NULL DEFAULT 0`,     // Родительская категория; 0 — верхний уровень
+		`ALTER TABLE categories ADD COLUMN posting TEXT NOT NULL DEFAULT 'everyone'`, // Кто может публиковать: everyone, moderators или readonly
+		`ALTER TABLE posts ADD COLUMN publish_at DATETIME`,                           // Время запланированной публикации (UTC); NULL — пост опубликован
+	}
+	for _, q := range migrations {
+		_, err := db.Exec(q)
+		if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+			log.Fatalf("Ошибка миграции базы данных: %v, запрос: %s", err, q)
+		}
+	}
+
+	// Вставляем предопределенные категории в новую базу.
 	insertCategories(db)
 
+	// Категориям из баз до появления адресов назначаются slug и порядок
+	backfillCategories(db)
+	if _, err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_slug ON categories(slug)`); err != nil {
+		log.Fatalf("Ошибка создания индекса категорий: %v", err)
+	}
+
 	return db
 }
 
-// insertCategories вставляет предопределенные категории в базу данных.
+// insertCategories вставляет предопределенные категории, если в базе нет ни одной.
+// Дальше категориями управляет администратор, поэтому удалённые или переименованные не возвращаются.
 func insertCategories(db *sql.DB) {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM categories").Scan(&count); err != nil {
+		log.Printf("Ошибка при подсчёте категорий: %v", err)
+		return
+	}
+	if count > 0 {
+		return
+	}
+
 	categories := []string{
 		"General",
 		"Announcements",
@@ -94,29 +311,90 @@ func insertCategories(db *sql.DB) {
 		"Suggestions",
 		"Off-topic",
 	}
+	for i, categoryName := range categories {
+		_, err := db.Exec("INSERT INTO categories (name, slug, position) VALUES (?, ?, ?)", categoryName, Slugify(categoryName), i+1)
+		if err != nil {
+			log.Printf("Ошибка при вставке категории '%s': %v", categoryName, err)
+		}
+	}
+}
 
-	for _, categoryName := range categories {
-		// Проверяем, существует ли категория, прежде чем вставлять её
-		var count int
-		err := db.QueryRow("SELECT COUNT(*) FROM categories WHERE name = ?", categoryName).Scan(&count)
+// backfillCategories назначает slug категориям без него и позицию по порядку создания
+func backfillCategories(db *sql.DB) {
+	if _, err := db.Exec("UPDATE categories SET position = id WHERE position = 0"); err != nil {
+		log.Printf("Ошибка при назначении порядка категорий: %v", err)
+	}
+	rows, err := db.Query("SELECT id, name FROM categories WHERE slug = '' ORDER BY id")
+	if err != nil {
+		log.Printf("Ошибка при выборке категорий без slug: %v", err)
+		return
+	}
+	pending := map[int]string{}
+	var ids []int
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			log.Printf("Ошибка при чтении категории: %v", err)
+			break
+		}
+		pending[id] = name
+		ids = append(ids, id)
+	}
+	rows.Close()
+	for _, id := range ids {
+		slug, err := UniqueCategorySlug(db, Slugify(pending[id]), id)
+		if err == nil {
+			_, err = db.Exec("UPDATE categories SET slug = ? WHERE id = ?", slug, id)
+		}
 		if err != nil {
-			log.Printf("Ошибка при проверке существования категории '%s': %v", categoryName, err)
-			continue
+			log.Printf("Ошибка при назначении slug категории %d: %v", id, err)
 		}
-		if count == 0 {
-			// Если категория не существует, вставляем её
-			_, err := db.Exec("INSERT INTO categories (name) VALUES (?)", categoryName)
-			if err != nil {
-				log.Printf("Ошибка при вставке категории '%s': %v", categoryName, err)
+	}
+}
+
+// Slugify строит slug из названия: буквы и цифры в нижнем регистре, остальное — дефисы
+func Slugify(name string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && sb.Len() > 0 {
+				sb.WriteByte('-')
 			}
+			sb.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
 		}
 	}
+	if sb.Len() == 0 {
+		return "category"
+	}
+	return sb.String()
 }
 
-// Проверяет, существует ли пост с таким ID
+// UniqueCategorySlug возвращает slug, не занятый другими категориями, добавляя -2, -3, …
+// exceptID — категория, которой slug назначается (её собственный slug не считается занятым).
+func UniqueCategorySlug(db *sql.DB, slug string, exceptID int) (string, error) {
+	candidate := slug
+	for n := 2; ; n++ {
+		var taken bool
+		err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM categories WHERE slug = ? AND id != ?)", candidate, exceptID).Scan(&taken)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+		candidate = slug + "-" + strconv.Itoa(n)
+	}
+}
+
+// Проверяет, существует ли опубликованный пост с таким ID; запланированные посты ещё не видны
 func PostExists(db *sql.DB, postID int) bool {
 	var exists bool
-	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM posts WHERE id = ?)", postID).Scan(&exists)
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM posts WHERE id = ? AND publish_at IS NULL)", postID).Scan(&exists)
 	return err == nil && exists
 }
 
@@ -126,3 +404,17 @@ func IsValidCategory(db *sql.DB, categoryID int) bool {
 	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM categories WHERE id = ?)", categoryID).Scan(&exists)
 	return err == nil && exists
 }
+
+// Проверяет, привязан ли пост к категории
+func PostInCategory(db *sql.DB, postID, categoryID int) bool {
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM post_categories WHERE post_id = ? AND category_id = ?)", postID, categoryID).Scan(&exists)
+	return err == nil && exists
+}
+
+// Проверяет, существует ли комментарий с таким ID
+func CommentExists(db *sql.DB, commentID int) bool {
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM comments WHERE id = ?)", commentID).Scan(&exists)
+	return err == nil && exists
+}
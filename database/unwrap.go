@@ -0,0 +1,151 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+
+	"01.tomorrow-school.ai/git/zsakhipo/forum/codefence"
+)
+
+// Раньше при создании поста заголовок и текст переносились по словам: все пробелы
+// схлопывались, а после каждого 20-го (заголовок) или 30-го (текст) слова вставлялся \n.
+// Сначала перенос применялся ко всему тексту (splitAndWrap в прежнем create_post.go).
+// С версии, добавившей блоки кода, текст поста переносился функцией wrapOutsideFences:
+// блоки кода по правилам codefence оставались как есть, переносился текст между ними.
+// Исходные пробелы восстановить нельзя, но вставленные переводы строк можно заменить пробелами.
+
+const (
+	legacyTitleWordLimit   = 20
+	legacyContentWordLimit = 30
+)
+
+// UnwrapChange описывает исправленное поле поста
+type UnwrapChange struct {
+	PostID int
+	Field  string // title или content
+	Before string
+	After  string
+}
+
+// UnwrapLegacyBreaks находит посты, текст которых в точности совпадает с результатом
+// старого переноса, и заменяет вставленные переводы строк пробелами.
+// Текст, который мог быть набран так вручную (не длиннее лимита слов), не меняется.
+// При dryRun изменения только возвращаются, база не обновляется.
+func UnwrapLegacyBreaks(db *sql.DB, dryRun bool) ([]UnwrapChange, error) {
+	rows, err := db.Query("SELECT id, title, content FROM posts ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	var changes []UnwrapChange
+	for rows.Next() {
+		var id int
+		var title, content string
+		if err := rows.Scan(&id, &title, &content); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if after, ok := unwrapLegacy(title, legacyTitleWordLimit); ok {
+			changes = append(changes, UnwrapChange{PostID: id, Field: "title", Before: title, After: after})
+		}
+		if after, ok := unwrapContent(content); ok {
+			changes = append(changes, UnwrapChange{PostID: id, Field: "content", Before: content, After: after})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if dryRun || len(changes) == 0 {
+		return changes, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	for _, c := range changes {
+		// Имя столбца берётся из UnwrapChange.Field, а не из пользовательского ввода
+		if _, err := tx.Exec("UPDATE posts SET "+c.Field+" = ? WHERE id = ?", c.After, c.PostID); err != nil {
+			return nil, err
+		}
+	}
+	return changes, tx.Commit()
+}
+
+// legacyWrap повторяет старый перенос по словам
+func legacyWrap(text string, wordLimit int) string {
+	words := strings.Fields(text)
+	if len(words) <= wordLimit {
+		return text
+	}
+	var sb strings.Builder
+	for i, w := range words {
+		sb.WriteString(w)
+		if (i+1)%wordLimit == 0 {
+			sb.WriteString("\n")
+		} else {
+			sb.WriteString(" ")
+		}
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// unwrapLegacy возвращает текст без вставленных переводов строк, если text — результат legacyWrap
+func unwrapLegacy(text string, wordLimit int) (string, bool) {
+	words := strings.Fields(text)
+	if len(words) <= wordLimit {
+		return text, false
+	}
+	joined := strings.Join(words, " ")
+	if legacyWrap(joined, wordLimit) != text {
+		return text, false
+	}
+	return joined, true
+}
+
+// unwrapContent снимает перенос с текста поста, сделанный любой из двух версий:
+// сначала весь текст целиком, затем текст между блоками кода
+func unwrapContent(content string) (string, bool) {
+	if after, ok := unwrapLegacy(content, legacyContentWordLimit); ok {
+		return after, true
+	}
+	return unwrapOutsideFences(content, legacyContentWordLimit)
+}
+
+// unwrapOutsideFences применяет unwrapLegacy к тексту между блоками кода.
+// Блоки определяются так же, как в wrapOutsideFences: открывает строка по codefence.Opening
+// (без \r в конце), закрывает — по codefence.Closes; незакрытый блок идёт до конца текста.
+func unwrapOutsideFences(content string, wordLimit int) (string, bool) {
+	lines := strings.Split(content, "\n")
+	var out, prose []string
+	changed := false
+	flush := func() {
+		if len(prose) == 0 {
+			return
+		}
+		text := strings.Join(prose, "\n")
+		if after, ok := unwrapLegacy(text, wordLimit); ok {
+			text, changed = after, true
+		}
+		out = append(out, text)
+		prose = nil
+	}
+	for i := 0; i < len(lines); i++ {
+		fence := codefence.Opening(strings.TrimRight(lines[i], "\r"))
+		if fence == "" {
+			prose = append(prose, lines[i])
+			continue
+		}
+		flush()
+		out = append(out, lines[i])
+		for i++; i < len(lines); i++ {
+			out = append(out, lines[i])
+			if codefence.Closes(lines[i], fence) {
+				break
+			}
+		}
+	}
+	flush()
+	return strings.Join(out, "\n"), changed
+}
@@ -0,0 +1,210 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"01.tomorrow-school.ai/git/zsakhipo/forum/codefence"
+)
+
+// words возвращает n слов через пробел, начиная со слова с номером from
+func words(from, n int) string {
+	ws := make([]string, n)
+	for i := range ws {
+		ws[i] = fmt.Sprintf("w%d", from+i)
+	}
+	return strings.Join(ws, " ")
+}
+
+// wrapOutsideFences повторяет перенос текста поста из версии с блоками кода:
+// legacyWrap применяется только к тексту между блоками
+func wrapOutsideFences(content string) string {
+	lines := strings.Split(content, "\n")
+	var out, prose []string
+	flush := func() {
+		if len(prose) > 0 {
+			out = append(out, legacyWrap(strings.Join(prose, "\n"), legacyContentWordLimit))
+			prose = nil
+		}
+	}
+	for i := 0; i < len(lines); i++ {
+		fence := codefence.Opening(strings.TrimRight(lines[i], "\r"))
+		if fence == "" {
+			prose = append(prose, lines[i])
+			continue
+		}
+		flush()
+		out = append(out, lines[i])
+		for i++; i < len(lines); i++ {
+			out = append(out, lines[i])
+			if codefence.Closes(lines[i], fence) {
+				break
+			}
+		}
+	}
+	flush()
+	return strings.Join(out, "\n")
+}
+
+// Блоки кода определяются так же, как при старом переносе: ограничитель по codefence.Opening,
+// закрывает только строка из тех же символов не короче открывающей
+func TestUnwrapFenceRule(t *testing.T) {
+	notFence := words(0, 35) + "\n``` a`b\n" + words(35, 35)
+	for _, tc := range []struct {
+		typed string
+		want  string // Пусто — набранный текст восстанавливается целиком
+	}{
+		{typed: words(0, 35) + "\n```\n```not a closing fence\nx  :=  1\n```\n" + words(35, 35)},
+		{typed: words(0, 35) + "\n````md\n```\ncode  block\n```\n````\n" + words(35, 35)},
+		{typed: words(0, 35) + "\n   ~~~\n  indented  code\n~~~~~\n" + words(35, 35)},
+		// После ``` с обратной кавычкой в строке блок не начинается: строка переносилась вместе с текстом
+		{typed: notFence, want: strings.Join(strings.Fields(notFence), " ")},
+	} {
+		want := tc.want
+		if want == "" {
+			want = tc.typed
+		}
+		stored := wrapOutsideFences(tc.typed)
+		got, ok := unwrapContent(stored)
+		if !ok || got != want {
+			t.Errorf("unwrapContent(%q):\nexpected %q\n     got %q (changed %v)", stored, want, got, ok)
+		}
+	}
+}
+
+// openUnwrapDB создаёт базу во временном каталоге с одним пользователем
+func openUnwrapDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db := Init(filepath.Join(t.TempDir(), "forum.db"))
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec("INSERT INTO users (email, username, password) VALUES ('u@example.com', 'unwrap_user', '-')"); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// insertPost сохраняет пост с заголовком и текстом как есть и возвращает его ID
+func insertPost(t *testing.T, db *sql.DB, title, content string) int {
+	t.Helper()
+	res, err := db.Exec("INSERT INTO posts (user_id, title, content) SELECT id, ?, ? FROM users LIMIT 1", title, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := res.LastInsertId()
+	return int(id)
+}
+
+// checkPost сверяет заголовок и текст поста в базе
+func checkPost(t *testing.T, db *sql.DB, id int, name, title, content string) {
+	t.Helper()
+	var gotTitle, gotContent string
+	if err := db.QueryRow("SELECT title, content FROM posts WHERE id = ?", id).Scan(&gotTitle, &gotContent); err != nil {
+		t.Fatal(err)
+	}
+	if gotTitle != title {
+		t.Errorf("%s: expected title %q, got %q", name, title, gotTitle)
+	}
+	if gotContent != content {
+		t.Errorf("%s: expected content %q, got %q", name, content, gotContent)
+	}
+}
+
+func TestUnwrapLegacyBreaks(t *testing.T) {
+	fenced := words(0, 40) + "\n```go\nfunc main() {\n\tprintln(\"a  b\")\n}\n```\n" + words(40, 35)
+	tests := []struct {
+		name                string
+		title, content      string // Набранный текст — его должна вернуть миграция
+		storedTitle, stored string // Текст в базе после старого переноса
+	}{
+		{
+			name:        "long title",
+			title:       words(0, 45),
+			storedTitle: legacyWrap(words(0, 45), legacyTitleWordLimit),
+			content:     "short", stored: "short",
+		},
+		{
+			name:  "long content wrapped as a whole",
+			title: "t", storedTitle: "t",
+			content: words(0, 70),
+			stored:  legacyWrap(words(0, 70), legacyContentWordLimit),
+		},
+		{
+			name:  "content with a code block",
+			title: "t", storedTitle: "t",
+			content: fenced,
+			stored:  wrapOutsideFences(fenced),
+		},
+		{
+			name:  "unclosed code block",
+			title: "t", storedTitle: "t",
+			content: words(0, 31) + "\n~~~\n" + words(31, 40),
+			stored:  wrapOutsideFences(words(0, 31) + "\n~~~\n" + words(31, 40)),
+		},
+		{
+			// Первая версия переносила и текст блоков кода, их переводы строк уже не восстановить
+			name:  "code block wrapped as a whole",
+			title: "t", storedTitle: "t",
+			content: strings.Join(strings.Fields(fenced), " "),
+			stored:  legacyWrap(fenced, legacyContentWordLimit),
+		},
+		{
+			name:        "title at the word limit",
+			title:       words(0, 10) + "\n" + words(10, 10),
+			storedTitle: words(0, 10) + "\n" + words(10, 10),
+			content:     "short", stored: "short",
+		},
+		{
+			name:  "short text with typed line breaks",
+			title: "t", storedTitle: "t",
+			content: "first line\nsecond  line\n\nthird",
+			stored:  "first line\nsecond  line\n\nthird",
+		},
+		{
+			name:  "long text with typed line breaks",
+			title: "t", storedTitle: "t",
+			content: words(0, 10) + "\n" + words(10, 30),
+			stored:  words(0, 10) + "\n" + words(10, 30),
+		},
+	}
+
+	db := openUnwrapDB(t)
+	ids := make([]int, len(tests))
+	for i, tc := range tests {
+		ids[i] = insertPost(t, db, tc.storedTitle, tc.stored)
+	}
+
+	// Пробный запуск ничего не меняет в базе
+	dry, err := UnwrapLegacyBreaks(db, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tc := range tests {
+		checkPost(t, db, ids[i], tc.name+" (dry run)", tc.storedTitle, tc.stored)
+	}
+
+	changes, err := UnwrapLegacyBreaks(db, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != len(dry) {
+		t.Errorf("dry run reported %d changes, the real run %d", len(dry), len(changes))
+	}
+	for i, tc := range tests {
+		checkPost(t, db, ids[i], tc.name, tc.title, tc.content)
+	}
+
+	// Повторный запуск ничего не находит
+	again, err := UnwrapLegacyBreaks(db, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range again {
+		t.Errorf("second run changed %s of post %d: %q -> %q", c.Field, c.PostID, c.Before, c.After)
+	}
+	for i, tc := range tests {
+		checkPost(t, db, ids[i], tc.name+" (second run)", tc.title, tc.content)
+	}
+}
@@ -4,6 +4,8 @@ go 1.24.2
 
 require (
 	github.com/google/uuid v1.6.0
+	github.com/gorilla/websocket v1.5.3
 	github.com/mattn/go-sqlite3 v1.14.28
 	golang.org/x/crypto v0.38.0
+	golang.org/x/text v0.25.0
 )
@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Максимальный размер тела JSON-запроса
+const maxAPIBodySize = 1 << 20
+
+// apiError — тело ответа с ошибкой. Все ошибки API имеют вид
+// {"error": {"status": 404, "code": "not_found", "message": "Post not found"}}
+type apiError struct {
+	Error apiErrorDetail `json:"error"`
+}
+
+type apiErrorDetail struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// apiCategory — категория в ответах API
+type apiCategory struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+// apiCategoryDetail — категория в списке категорий и ответах управления категориями
+type apiCategoryDetail struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Slug        string `json:"slug"`
+	Description string `json:"description"`
+	Color       string `json:"color"`     // #rrggbb или пусто
+	Icon        string `json:"icon"`      // Имя иконки Font Awesome без префикса fa-
+	ParentID    int    `json:"parent_id"` // 0 — категория верхнего уровня
+	Posting     string `json:"posting"`   // everyone, moderators или readonly
+	Position    int    `json:"position"`
+	Archived    bool   `json:"archived"`
+	PostCount   int    `json:"post_count"` // Вместе с постами подкатегорий
+}
+
+// apiCategoryInput — тело запроса на создание или изменение категории.
+// При изменении пропущенные поля сохраняют текущие значения.
+type apiCategoryInput struct {
+	Name        *string `json:"name,omitempty"`
+	Slug        *string `json:"slug,omitempty"` // Пусто — сформировать из имени
+	Description *string `json:"description,omitempty"`
+	Color       *string `json:"color,omitempty"`
+	Icon        *string `json:"icon,omitempty"`
+	ParentID    *int    `json:"parent_id,omitempty"` // 0 — категория верхнего уровня
+	Posting     *string `json:"posting,omitempty"`   // everyone, moderators или readonly
+	Position    *int    `json:"position,omitempty"`
+	Archived    *bool   `json:"archived,omitempty"`
+}
+
+// apiCategoryMergeInput — тело запроса на слияние категорий
+type apiCategoryMergeInput struct {
+	Into int `json:"into"` // ID категории, в которую переносятся посты и подписки
+}
+
+// apiComment — комментарий в ответах API
+type apiComment struct {
+	ID        int       `json:"id"`
+	PostID    int       `json:"post_id"`
+	Author    string    `json:"author"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+	Likes     int       `json:"likes"`
+	Dislikes  int       `json:"dislikes"`
+	UserVote  int       `json:"user_vote"` // 1 — лайк, -1 — дизлайк, 0 — нет голоса
+}
+
+// apiPost — пост в ответах API
+type apiPost struct {
+	ID           int           `json:"id"`
+	Title        string        `json:"title"`
+	Content      string        `json:"content"`
+	Author       string        `json:"author"`
+	CreatedAt    time.Time     `json:"created_at"`
+	Likes        int           `json:"likes"`
+	Dislikes     int           `json:"dislikes"`
+	UserVote     int           `json:"user_vote"`
+	CommentCount int           `json:"comment_count"`
+	ImageURL     string        `json:"image_url,omitempty"`
+	Categories   []apiCategory `json:"categories"`
+	Tags         []string      `json:"tags"`
+	Comments     []apiComment  `json:"comments,omitempty"`
+}
+
+// apiTag — тег в списке тегов
+type apiTag struct {
+	Name      string `json:"name"`
+	PostCount int    `json:"post_count"`
+}
+
+// apiPostList — страница списка постов
+type apiPostList struct {
+	Posts   []apiPost `json:"posts"`
+	Page    int       `json:"page"`
+	PerPage int       `json:"per_page"`
+	Total   int       `json:"total"`
+}
+
+// apiVoteResult — результат голосования
+type apiVoteResult struct {
+	Likes    int `json:"likes"`
+	Dislikes int `json:"dislikes"`
+	UserVote int `json:"user_vote"`
+}
+
+// apiPostInput — тело запроса на создание или изменение поста
+type apiPostInput struct {
+	Title       string    `json:"title"`
+	Content     string    `json:"content"`
+	CategoryIDs *[]int    `json:"category_ids,omitempty"` // nil при изменении — оставить категории без изменений
+	Tags        *[]string `json:"tags,omitempty"`         // nil при изменении — оставить теги без изменений
+	RemoveImage bool      `json:"remove_image,omitempty"`
+}
+
+// apiCommentInput — тело запроса на создание или изменение комментария
+type apiCommentInput struct {
+	Content string `json:"content"`
+}
+
+// apiVoteInput — тело запроса на голосование
+type apiVoteInput struct {
+	Value int `json:"value"` // 1 — лайк, -1 — дизлайк, 0 — снять голос
+}
+
+// apiPostDeleteInput — тело запроса на удаление поста со страницы (/post/delete)
+type apiPostDeleteInput struct {
+	PostID int `json:"post_id"`
+}
+
+// apiCommentDeleteInput — тело запроса на удаление комментария со страницы (/comment/delete)
+type apiCommentDeleteInput struct {
+	CommentID int `json:"comment_id"`
+}
+
+// apiDraftSaved — ответ на автосохранение черновика (/drafts/save)
+type apiDraftSaved struct {
+	ID       int       `json:"id"` // 0, если пустой черновик не сохранялся
+	SavedAt  time.Time `json:"saved_at"`
+	ImageURL string    `json:"image_url,omitempty"`
+}
+
+// apiUser — пользователь, от имени которого выполняется запрос к API
+type apiUser struct {
+	ID       int
+	Username string
+	Role     string
+	Scopes   []string // Права запроса: у токена — выданные при создании, у сессии — все доступные роли
+	TokenID  int      // 0, если запрос аутентифицирован сессионной кукой
+}
+
+// can сообщает, разрешено ли запросу действие с указанным правом.
+// Право moderate действует, только пока пользователь остаётся модератором, admin — администратором.
+func (u apiUser) can(scope string) bool {
+	if scope == scopeModerate && !isModeratorRole(u.Role) {
+		return false
+	}
+	if scope == scopeAdmin && u.Role != "admin" {
+		return false
+	}
+	return containsString(u.Scopes, scope)
+}
+
+// writeJSON отправляет ответ в формате JSON с указанным статусом
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("Error encoding JSON response:", err)
+	}
+}
+
+// writeAPIError отправляет ошибку в едином JSON-формате
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	code := strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+	writeJSON(w, status, apiError{Error: apiErrorDetail{Status: status, Code: code, Message: message}})
+}
+
+// apiMethodNotAllowed отвечает 405 со списком разрешённых методов
+func apiMethodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeAPIError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+}
+
+// decodeJSON читает тело запроса в v, запрещая неизвестные поля
+func decodeJSON(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxAPIBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return errors.New("Invalid JSON body: " + err.Error())
+	}
+	return nil
+}
+
+// authenticateAPI определяет пользователя по заголовку Authorization: Bearer
+// или по сессионной куке. badToken = true, если заголовок передан, но токен недействителен.
+func authenticateAPI(db *sql.DB, r *http.Request) (u apiUser, ok bool, badToken bool) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, found := strings.Cut(header, " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") {
+			return apiUser{}, false, true
+		}
+		u, ok = authenticateToken(db, strings.TrimSpace(token))
+		return u, ok, !ok
+	}
+
+	cookie, err := r.Cookie("session_id")
+	if err != nil {
+		return apiUser{}, false, false
+	}
+	err = db.QueryRow(`
+		SELECT u.id, u.username, u.role
+		FROM sessions s
+		JOIN users u ON s.user_id = u.id
+		WHERE s.id = ? AND s.expiry > ?`, cookie.Value, time.Now(),
+	).Scan(&u.ID, &u.Username, &u.Role)
+	if err != nil {
+		return apiUser{}, false, false
+	}
+	u.Scopes = allowedScopes(u.Role)
+	return u, true, false
+}
+
+// apiAuthorize проверяет аутентификацию и право scope. Если required = false,
+// анонимный запрос пропускается с нулевым пользователем. При отказе пишет ошибку и возвращает false.
+func apiAuthorize(db *sql.DB, w http.ResponseWriter, r *http.Request, scope string, required bool) (apiUser, bool) {
+	u, ok, badToken := authenticateAPI(db, r)
+	if badToken {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeAPIError(w, http.StatusUnauthorized, "Invalid or expired API token")
+		return apiUser{}, false
+	}
+	if !ok {
+		if required {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeAPIError(w, http.StatusUnauthorized, "Authentication required")
+			return apiUser{}, false
+		}
+		return apiUser{}, true
+	}
+	if !u.can(scope) {
+		writeAPIError(w, http.StatusForbidden, "Token is missing the \""+scope+"\" scope")
+		return apiUser{}, false
+	}
+	return u, true
+}
+
+// pathID разбирает числовой параметр пути (например, {id})
+func pathID(r *http.Request, name string) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue(name))
+	return id, err == nil && id > 0
+}
+
+// voteValue переводит флаги голоса в число: 1, -1 или 0
+func voteValue(liked, disliked bool) int {
+	if liked {
+		return 1
+	}
+	if disliked {
+		return -1
+	}
+	return 0
+}
+
+// toAPIPost преобразует пост в представление API
+func toAPIPost(p Post) apiPost {
+	out := apiPost{
+		ID:           p.ID,
+		Title:        p.Title,
+		Content:      p.Content,
+		Author:       p.Author,
+		CreatedAt:    p.CreatedTime,
+		Likes:        p.Likes,
+		Dislikes:     p.Dislikes,
+		UserVote:     voteValue(p.UserLiked, p.UserDisliked),
+		CommentCount: p.CommentCount,
+		ImageURL:     p.ImagePath,
+		Categories:   []apiCategory{},
+		Tags:         p.Tags,
+	}
+	for _, c := range p.Categories {
+		out.Categories = append(out.Categories, apiCategory{ID: c.ID, Name: c.Name, Slug: c.Slug})
+	}
+	for _, c := range p.Comments {
+		out.Comments = append(out.Comments, toAPIComment(c))
+	}
+	return out
+}
+
+// toAPIComment преобразует комментарий в представление API
+func toAPIComment(c Comment) apiComment {
+	return apiComment{
+		ID:        c.ID,
+		PostID:    c.PostID,
+		Author:    c.Author,
+		Content:   c.Content,
+		CreatedAt: c.CreatedTime,
+		Likes:     c.Likes,
+		Dislikes:  c.Dislikes,
+		UserVote:  voteValue(c.UserLiked, c.UserDisliked),
+	}
+}
+
+// writeValidationError отвечает 400 для ошибок валидации и 500 для остальных
+func writeValidationError(w http.ResponseWriter, err error) {
+	var vErr validationError
+	if errors.As(err, &vErr) {
+		writeAPIError(w, http.StatusBadRequest, vErr.Error())
+		return
+	}
+	log.Println("API error:", err)
+	writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
+}
+
+// APINotFound отвечает JSON-ошибкой 404 для неизвестных адресов API
+func APINotFound() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusNotFound, "Not Found")
+	}
+}
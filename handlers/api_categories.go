@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// toAPICategoryDetail преобразует категорию в представление API
+func toAPICategoryDetail(c Category) apiCategoryDetail {
+	return apiCategoryDetail{
+		ID:          c.ID,
+		Name:        c.Name,
+		Slug:        c.Slug,
+		Description: c.Description,
+		Color:       c.Color,
+		Icon:        c.Icon,
+		ParentID:    c.ParentID,
+		Posting:     c.Posting,
+		Position:    c.Position,
+		Archived:    c.Archived,
+		PostCount:   c.PostCount,
+	}
+}
+
+// APICategories обрабатывает /api/v1/categories: GET — список категорий, POST — новая категория
+func APICategories(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			apiListCategories(db, w, r)
+		case http.MethodPost:
+			apiCreateCategory(db, w, r)
+		default:
+			apiMethodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+	}
+}
+
+// apiListCategories возвращает категории в порядке панели фильтров; архивные — по include_archived=true
+func apiListCategories(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	includeArchived := false
+	if v := r.URL.Query().Get("include_archived"); v != "" {
+		var err error
+		if includeArchived, err = strconv.ParseBool(v); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "Invalid include_archived value")
+			return
+		}
+	}
+	if _, ok := apiAuthorize(db, w, r, scopeRead, false); !ok {
+		return
+	}
+
+	query := queryCategories
+	if includeArchived {
+		query = queryAllCategories
+	}
+	categories, err := query(db)
+	if err != nil {
+		log.Println("API: error listing categories:", err)
+		writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+	out := []apiCategoryDetail{}
+	for _, c := range categories {
+		out = append(out, toAPICategoryDetail(c))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// apiCreateCategory создаёт категорию; доступно только администраторам
+func apiCreateCategory(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if _, ok := apiAuthorize(db, w, r, scopeAdmin, true); !ok {
+		return
+	}
+	var in apiCategoryInput
+	if err := decodeJSON(r, &in); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	fields := in.apply(categoryInput{})
+	if err := validateCategory(db, &fields, 0); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	categoryID, err := createCategory(db, fields)
+	if err == nil {
+		err = in.applyOrder(db, categoryID)
+	}
+	if err != nil {
+		log.Println("API: error creating category:", err)
+		writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+	w.Header().Set("Location", "/api/v1/categories/"+strconv.Itoa(categoryID))
+	apiWriteCategory(db, w, categoryID, http.StatusCreated)
+}
+
+// APICategory обрабатывает /api/v1/categories/{id}: GET — категория, PUT — изменение
+func APICategory(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		categoryID, ok := pathID(r, "id")
+		if !ok {
+			writeAPIError(w, http.StatusBadRequest, "Invalid category ID")
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodPut {
+			apiMethodNotAllowed(w, http.MethodGet, http.MethodPut)
+			return
+		}
+		scope := scopeRead
+		if r.Method == http.MethodPut {
+			scope = scopeAdmin
+		}
+		if _, ok := apiAuthorize(db, w, r, scope, r.Method == http.MethodPut); !ok {
+			return
+		}
+		category, err := lookupCategoryByID(db, categoryID)
+		if err == sql.ErrNoRows {
+			writeAPIError(w, http.StatusNotFound, "Category not found")
+			return
+		}
+		if err != nil {
+			log.Println("API: error loading category:", err)
+			writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+		if r.Method == http.MethodGet {
+			writeJSON(w, http.StatusOK, toAPICategoryDetail(category))
+			return
+		}
+
+		var in apiCategoryInput
+		if err := decodeJSON(r, &in); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		fields := in.apply(categoryInput{
+			Name:        category.Name,
+			Slug:        category.Slug,
+			Description: category.Description,
+			Color:       category.Color,
+			Icon:        category.Icon,
+			ParentID:    category.ParentID,
+			Posting:     category.Posting,
+		})
+		if err := validateCategory(db, &fields, categoryID); err != nil {
+			writeValidationError(w, err)
+			return
+		}
+		err = updateCategory(db, categoryID, fields)
+		if err == nil {
+			err = in.applyOrder(db, categoryID)
+		}
+		if err != nil {
+			log.Println("API: error updating category:", err)
+			writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+		apiWriteCategory(db, w, categoryID, http.StatusOK)
+	}
+}
+
+// APICategoryMerge обрабатывает POST /api/v1/categories/{id}/merge: перенос постов,
+// подписок и webhook в категорию into и удаление категории {id}
+func APICategoryMerge(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sourceID, ok := pathID(r, "id")
+		if !ok {
+			writeAPIError(w, http.StatusBadRequest, "Invalid category ID")
+			return
+		}
+		if r.Method != http.MethodPost {
+			apiMethodNotAllowed(w, http.MethodPost)
+			return
+		}
+		if _, ok := apiAuthorize(db, w, r, scopeAdmin, true); !ok {
+			return
+		}
+		if _, err := lookupCategoryByID(db, sourceID); err != nil {
+			writeAPIError(w, http.StatusNotFound, "Category not found")
+			return
+		}
+		var in apiCategoryMergeInput
+		if err := decodeJSON(r, &in); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if in.Into == sourceID {
+			writeValidationError(w, errMergeIntoSelf)
+			return
+		}
+		if _, err := lookupCategoryByID(db, in.Into); err != nil {
+			writeValidationError(w, errInvalidCategory)
+			return
+		}
+		err := mergeCategories(db, sourceID, in.Into)
+		if errors.Is(err, errMergeIntoChild) {
+			writeValidationError(w, err)
+			return
+		}
+		if err != nil {
+			log.Println("API: error merging categories:", err)
+			writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+		apiWriteCategory(db, w, in.Into, http.StatusOK)
+	}
+}
+
+// apply накладывает переданные поля на текущие значения
+func (in apiCategoryInput) apply(fields categoryInput) categoryInput {
+	for _, f := range []struct {
+		src *string
+		dst *string
+	}{
+		{in.Name, &fields.Name},
+		{in.Slug, &fields.Slug},
+		{in.Description, &fields.Description},
+		{in.Color, &fields.Color},
+		{in.Icon, &fields.Icon},
+		{in.Posting, &fields.Posting},
+	} {
+		if f.src != nil {
+			*f.dst = *f.src
+		}
+	}
+	if in.ParentID != nil {
+		fields.ParentID = *in.ParentID
+	}
+	return fields
+}
+
+// applyOrder сохраняет переданные позицию и признак архива
+func (in apiCategoryInput) applyOrder(db *sql.DB, categoryID int) error {
+	if in.Position != nil {
+		if _, err := db.Exec("UPDATE categories SET position = ? WHERE id = ?", *in.Position, categoryID); err != nil {
+			return err
+		}
+	}
+	if in.Archived != nil {
+		return setCategoryArchived(db, categoryID, *in.Archived)
+	}
+	return nil
+}
+
+// apiWriteCategory отвечает текущим состоянием категории
+func apiWriteCategory(db *sql.DB, w http.ResponseWriter, categoryID, status int) {
+	category, err := lookupCategoryByID(db, categoryID)
+	if err != nil {
+		log.Println("API: error loading category:", err)
+		writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+	writeJSON(w, status, toAPICategoryDetail(category))
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+
+	"01.tomorrow-school.ai/git/zsakhipo/forum/database"
+)
+
+// APIPostComments обрабатывает /api/v1/posts/{id}/comments: GET — список, POST — новый комментарий
+func APIPostComments(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		postID, ok := pathID(r, "id")
+		if !ok {
+			writeAPIError(w, http.StatusBadRequest, "Invalid post ID")
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			apiMethodNotAllowed(w, http.MethodGet, http.MethodPost)
+			return
+		}
+		if !database.PostExists(db, postID) {
+			writeAPIError(w, http.StatusNotFound, "Post not found")
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			user, ok := apiAuthorize(db, w, r, scopeRead, false)
+			if !ok {
+				return
+			}
+			comments, err := queryComments(db, postID, user.ID)
+			if err != nil {
+				log.Println("API: error listing comments:", err)
+				writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
+				return
+			}
+			out := []apiComment{}
+			for _, c := range comments {
+				out = append(out, toAPIComment(c))
+			}
+			writeJSON(w, http.StatusOK, out)
+			return
+		}
+
+		user, ok := apiAuthorize(db, w, r, scopeWrite, true)
+		if !ok {
+			return
+		}
+		var in apiCommentInput
+		if err := decodeJSON(r, &in); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		in.Content = normalizeText(in.Content)
+		if err := validateComment(in.Content); err != nil {
+			writeValidationError(w, err)
+			return
+		}
+
+		commentID, err := insertComment(db, postID, user.ID, in.Content)
+		if err != nil {
+			log.Println("API: error creating comment:", err)
+			writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+		publishCommentCreated(db, commentID)
+		comment, err := queryComment(db, commentID, user.ID)
+		if err != nil {
+			log.Println("API: error loading comment:", err)
+			writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+		w.Header().Set("Location", "/api/v1/comments/"+strconv.Itoa(commentID))
+		writeJSON(w, http.StatusCreated, toAPIComment(comment))
+	}
+}
+
+// APIComment обрабатывает /api/v1/comments/{id}: чтение, изменение и удаление комментария
+func APIComment(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		commentID, ok := pathID(r, "id")
+		if !ok {
+			writeAPIError(w, http.StatusBadRequest, "Invalid comment ID")
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodPut && r.Method != http.MethodDelete {
+			apiMethodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+			return
+		}
+
+		scope, required := scopeWrite, true
+		if r.Method == http.MethodGet {
+			scope, required = scopeRead, false
+		}
+		user, ok := apiAuthorize(db, w, r, scope, required)
+		if !ok {
+			return
+		}
+
+		comment, err := queryComment(db, commentID, user.ID)
+		if err == sql.ErrNoRows {
+			writeAPIError(w, http.StatusNotFound, "Comment not found")
+			return
+		}
+		if err != nil {
+			log.Println("API: error loading comment:", err)
+			writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, toAPIComment(comment))
+		case http.MethodPut:
+			if comment.UserID != user.ID {
+				writeAPIError(w, http.StatusForbidden, "You are not the author of this comment")
+				return
+			}
+			var in apiCommentInput
+			if err := decodeJSON(r, &in); err != nil {
+				writeAPIError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			in.Content = normalizeText(in.Content)
+			if err := validateComment(in.Content); err != nil {
+				writeValidationError(w, err)
+				return
+			}
+			if err := updateComment(db, commentID, in.Content); err != nil {
+				log.Println("API: error updating comment:", err)
+				writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
+				return
+			}
+			publishCommentUpdated(db, commentID)
+			comment.Content = in.Content
+			writeJSON(w, http.StatusOK, toAPIComment(comment))
+		case http.MethodDelete:
+			// Чужой комментарий может удалить только модератор
+			if comment.UserID != user.ID && !user.can(scopeModerate) {
+				writeAPIError(w, http.StatusForbidden, "You are not the author of this comment")
+				return
+			}
+			if err := deleteComment(db, commentID); err != nil {
+				log.Println("API: error deleting comment:", err)
+				writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
+				return
+			}
+			publishCommentDeleted(db, comment.PostID, commentID)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
+
+// APICommentVote обрабатывает /api/v1/comments/{id}/vote
+func APICommentVote(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			apiMethodNotAllowed(w, http.MethodPost)
+			return
+		}
+		commentID, ok := pathID(r, "id")
+		if !ok {
+			writeAPIError(w, http.StatusBadRequest, "Invalid comment ID")
+			return
+		}
+		user, ok := apiAuthorize(db, w, r, scopeWrite, true)
+		if !ok {
+			return
+		}
+
+		var in apiVoteInput
+		if err := decodeJSON(r, &in); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if in.Value < -1 || in.Value > 1 {
+			writeAPIError(w, http.StatusBadRequest, "value must be 1, -1 or 0")
+			return
+		}
+		if !database.CommentExists(db, commentID) {
+			writeAPIError(w, http.StatusNotFound, "Comment not found")
+			return
+		}
+
+		if err := setVote(db, user.ID, 0, commentID, in.Value); err != nil {
+			log.Println("API: error saving vote:", err)
+			writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+		publishVote(db, 0, commentID)
+		comment, err := queryComment(db, commentID, user.ID)
+		if err != nil {
+			log.Println("API: error loading comment:", err)
+			writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+		writeJSON(w, http.StatusOK, apiVoteResult{
+			Likes:    comment.Likes,
+			Dislikes: comment.Dislikes,
+			UserVote: voteValue(comment.UserLiked, comment.UserDisliked),
+		})
+	}
+}
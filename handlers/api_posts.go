@@ -0,0 +1,368 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Параметры постраничного вывода API
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
+)
+
+// APIPosts обрабатывает /api/v1/posts: GET — список постов, POST — создание поста
+func APIPosts(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			apiListPosts(db, w, r)
+		case http.MethodPost:
+			apiCreatePost(db, w, r)
+		default:
+			apiMethodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+	}
+}
+
+// apiListPosts возвращает страницу постов с фильтрами filter, category и tag
+func apiListPosts(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	page := 1
+	if v := query.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeAPIError(w, http.StatusBadRequest, "page must be a positive integer")
+			return
+		}
+		page = n
+	}
+	perPage := defaultPerPage
+	if v := query.Get("per_page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPerPage {
+			writeAPIError(w, http.StatusBadRequest, "per_page must be between 1 and 100")
+			return
+		}
+		perPage = n
+	}
+
+	filter := query.Get("filter")
+	if filter != "" && filter != "created" && filter != "liked" && filter != "following" && filter != "saved" {
+		writeAPIError(w, http.StatusBadRequest, "Unknown filter")
+		return
+	}
+
+	user, ok := apiAuthorize(db, w, r, scopeRead, false)
+	if !ok {
+		return
+	}
+	if filter != "" && user.ID == 0 {
+		writeAPIError(w, http.StatusUnauthorized, "Authentication required for this filter")
+		return
+	}
+
+	q := postQuery{
+		ViewerID: user.ID,
+		Filter:   filter,
+		Label:    query.Get("label"),
+		Category: query.Get("category"),
+		Tag:      normalizeTag(query.Get("tag")),
+		Limit:    perPage,
+		Offset:   (page - 1) * perPage,
+	}
+	total, err := countPosts(db, q)
+	if err != nil {
+		log.Println("API: error counting posts:", err)
+		writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+	posts, err := queryPosts(db, q)
+	if err != nil {
+		log.Println("API: error listing posts:", err)
+		writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	out := apiPostList{Posts: []apiPost{}, Page: page, PerPage: perPage, Total: total}
+	for _, p := range posts {
+		out.Posts = append(out.Posts, toAPIPost(p))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// apiCreatePost создаёт пост от имени текущего пользователя
+func apiCreatePost(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	user, ok := apiAuthorize(db, w, r, scopeWrite, true)
+	if !ok {
+		return
+	}
+
+	var in apiPostInput
+	if err := decodeJSON(r, &in); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	in.Title, in.Content = normalizeText(in.Title), normalizeText(in.Content)
+	if err := validatePost(in.Title, in.Content); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	var categoryIDs []int
+	if in.CategoryIDs != nil {
+		categoryIDs = *in.CategoryIDs
+	}
+	if err := validateCategoryIDs(db, categoryIDs, 0, user.Role); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	var tags []string
+	if in.Tags != nil {
+		var err error
+		if tags, err = validateTags(*in.Tags); err != nil {
+			writeValidationError(w, err)
+			return
+		}
+	}
+
+	postID, err := insertPost(db, user.ID, in.Title, in.Content, "", categoryIDs, tags, time.Time{})
+	if err != nil {
+		log.Println("API: error creating post:", err)
+		writeAPIError(w, http.StatusInternalServerError, "Failed to create post")
+		return
+	}
+	publishPostCreated(db, postID)
+
+	post, err := queryPost(db, postID, user.ID)
+	if err != nil {
+		log.Println("API: error loading created post:", err)
+		writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+	w.Header().Set("Location", "/api/v1/posts/"+strconv.Itoa(postID))
+	writeJSON(w, http.StatusCreated, toAPIPost(post))
+}
+
+// APIPost обрабатывает /api/v1/posts/{id}: чтение, изменение и удаление поста
+func APIPost(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		postID, ok := pathID(r, "id")
+		if !ok {
+			writeAPIError(w, http.StatusBadRequest, "Invalid post ID")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			user, ok := apiAuthorize(db, w, r, scopeRead, false)
+			if !ok {
+				return
+			}
+			post, err := queryPost(db, postID, user.ID)
+			if err == sql.ErrNoRows {
+				writeAPIError(w, http.StatusNotFound, "Post not found")
+				return
+			}
+			if err != nil {
+				log.Println("API: error loading post:", err)
+				writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
+				return
+			}
+			writeJSON(w, http.StatusOK, toAPIPost(post))
+		case http.MethodPut:
+			apiUpdatePost(db, w, r, postID)
+		case http.MethodDelete:
+			apiDeletePost(db, w, r, postID)
+		default:
+			apiMethodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+		}
+	}
+}
+
+// apiUpdatePost изменяет пост; доступно только автору
+func apiUpdatePost(db *sql.DB, w http.ResponseWriter, r *http.Request, postID int) {
+	user, ok := apiAuthorize(db, w, r, scopeWrite, true)
+	if !ok {
+		return
+	}
+
+	post, err := queryPost(db, postID, user.ID)
+	if err == sql.ErrNoRows {
+		writeAPIError(w, http.StatusNotFound, "Post not found")
+		return
+	}
+	if err != nil {
+		log.Println("API: error loading post:", err)
+		writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+	if post.UserID != user.ID {
+		writeAPIError(w, http.StatusForbidden, "You can only edit your own posts")
+		return
+	}
+	readOnly, err := postReadOnly(db, postID)
+	if err != nil {
+		log.Println("API: error checking post categories:", err)
+		writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+	if readOnly {
+		writeAPIError(w, http.StatusForbidden, errReadOnlyPost.Error())
+		return
+	}
+
+	var in apiPostInput
+	if err := decodeJSON(r, &in); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	in.Title, in.Content = normalizeText(in.Title), normalizeText(in.Content)
+	if err := validatePost(in.Title, in.Content); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	// Если категории не переданы, оставляем текущие
+	var categoryIDs []int
+	if in.CategoryIDs != nil {
+		categoryIDs = *in.CategoryIDs
+		if err := validateCategoryIDs(db, categoryIDs, postID, user.Role); err != nil {
+			writeValidationError(w, err)
+			return
+		}
+	} else {
+		for _, c := range post.Categories {
+			categoryIDs = append(categoryIDs, c.ID)
+		}
+	}
+
+	// Если теги не переданы, оставляем текущие
+	tags := post.Tags
+	if in.Tags != nil {
+		if tags, err = validateTags(*in.Tags); err != nil {
+			writeValidationError(w, err)
+			return
+		}
+	}
+
+	if err := updatePost(db, postID, in.Title, in.Content, imageChange{Remove: in.RemoveImage}, categoryIDs, tags); err != nil {
+		log.Println("API: error updating post:", err)
+		writeAPIError(w, http.StatusInternalServerError, "Failed to update post")
+		return
+	}
+	publishPostUpdated(db, postID)
+	if in.RemoveImage && post.ImagePath != "" {
+		if err := removeImage(post.ImagePath); err != nil {
+			log.Println("API: error removing image:", err)
+		}
+	}
+
+	post, err = queryPost(db, postID, user.ID)
+	if err != nil {
+		log.Println("API: error loading updated post:", err)
+		writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+	writeJSON(w, http.StatusOK, toAPIPost(post))
+}
+
+// apiDeletePost удаляет пост; доступно автору и модераторам
+func apiDeletePost(db *sql.DB, w http.ResponseWriter, r *http.Request, postID int) {
+	user, ok := apiAuthorize(db, w, r, scopeWrite, true)
+	if !ok {
+		return
+	}
+
+	var authorID int
+	var imagePath sql.NullString
+	err := db.QueryRow("SELECT user_id, image_path FROM posts WHERE id = ? AND publish_at IS NULL", postID).Scan(&authorID, &imagePath)
+	if err == sql.ErrNoRows {
+		writeAPIError(w, http.StatusNotFound, "Post not found")
+		return
+	}
+	if err != nil {
+		log.Println("API: error querying post author:", err)
+		writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+	// Чужой пост может удалить только модератор
+	if authorID != user.ID && !user.can(scopeModerate) {
+		writeAPIError(w, http.StatusForbidden, "You are not the author of this post")
+		return
+	}
+
+	categories := postCategoryNames(db, postID)
+	if err := deletePost(db, postID); err != nil {
+		log.Println("API: error deleting post:", err)
+		writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+	publishPostDeleted(db, postID, categories)
+	if imagePath.Valid {
+		if err := removeImage(imagePath.String); err != nil {
+			log.Println("API: error removing image:", err)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// APIPostVote обрабатывает /api/v1/posts/{id}/vote
+func APIPostVote(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			apiMethodNotAllowed(w, http.MethodPost)
+			return
+		}
+		postID, ok := pathID(r, "id")
+		if !ok {
+			writeAPIError(w, http.StatusBadRequest, "Invalid post ID")
+			return
+		}
+		user, ok := apiAuthorize(db, w, r, scopeWrite, true)
+		if !ok {
+			return
+		}
+
+		var in apiVoteInput
+		if err := decodeJSON(r, &in); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if in.Value < -1 || in.Value > 1 {
+			writeAPIError(w, http.StatusBadRequest, "value must be 1, -1 or 0")
+			return
+		}
+		post, err := queryPost(db, postID, user.ID)
+		if err == sql.ErrNoRows {
+			writeAPIError(w, http.StatusNotFound, "Post not found")
+			return
+		}
+		if err != nil {
+			log.Println("API: error loading post:", err)
+			writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		if err := setVote(db, user.ID, postID, 0, in.Value); err != nil {
+			log.Println("API: error saving vote:", err)
+			writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+		publishVote(db, postID, 0)
+
+		if post, err = queryPost(db, post.ID, user.ID); err != nil {
+			log.Println("API: error loading post:", err)
+			writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+		writeJSON(w, http.StatusOK, apiVoteResult{
+			Likes:    post.Likes,
+			Dislikes: post.Dislikes,
+			UserVote: voteValue(post.UserLiked, post.UserDisliked),
+		})
+	}
+}
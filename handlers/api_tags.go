@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// Количество тегов в ответе /api/v1/tags по умолчанию
+const defaultTagLimit = 10
+
+// APITags обрабатывает GET /api/v1/tags: самые используемые теги, начинающиеся с q.
+// Используется для автодополнения тегов в формах поста.
+func APITags(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			apiMethodNotAllowed(w, http.MethodGet)
+			return
+		}
+		limit := defaultTagLimit
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxPerPage {
+				writeAPIError(w, http.StatusBadRequest, "limit must be between 1 and 100")
+				return
+			}
+			limit = n
+		}
+		if _, ok := apiAuthorize(db, w, r, scopeRead, false); !ok {
+			return
+		}
+
+		tags, err := queryTags(db, normalizeTag(r.URL.Query().Get("q")), limit)
+		if err != nil {
+			log.Println("API: error listing tags:", err)
+			writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+		out := []apiTag{}
+		for _, t := range tags {
+			out = append(out, apiTag{Name: t.Name, PostCount: t.PostCount})
+		}
+		writeJSON(w, http.StatusOK, out)
+	}
+}
@@ -174,7 +174,7 @@ func Register(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		_, err = db.Exec("INSERT INTO users (email, username, password) VALUES (?, ?, ?)", email, username, hashed)
+		_, err = db.Exec("INSERT INTO users (email, username, password, created_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP)", email, username, hashed)
 		if err != nil {
 			// Проверка на конфликт уникальности (email уже занят)
 			if strings.Contains(err.Error(), "UNIQUE constraint failed: users.email") {
@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // Декодеры форматов, которые принимает validateImage
+	_ "image/jpeg"
+	"image/png"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Размеры аватаров в пикселях; для каждого хранится отдельный файл
+var avatarSizes = []int{32, 64, 128}
+
+const (
+	avatarsDir          = uploadsDir + "/avatars"
+	maxAvatarDimension  = 4096 // Больше по любой стороне не декодируем, чтобы не тратить память
+	identiconGrid       = 5    // Клеток по стороне идентикона
+	avatarCacheDuration = 5 * time.Minute
+)
+
+// avatarSize возвращает ближайший доступный размер, не меньше запрошенного
+func avatarSize(requested int) int {
+	for _, s := range avatarSizes {
+		if requested <= s {
+			return s
+		}
+	}
+	return avatarSizes[len(avatarSizes)-1]
+}
+
+// avatarFile возвращает путь к файлу аватара заданного размера
+func avatarFile(key string, size int) string {
+	return filepath.Join(avatarsDir, key+"_"+strconv.Itoa(size)+".png")
+}
+
+// squareCrop вырезает из изображения квадрат по центру
+func squareCrop(img image.Image) image.Rectangle {
+	b := img.Bounds()
+	side := b.Dx()
+	if b.Dy() < side {
+		side = b.Dy()
+	}
+	x := b.Min.X + (b.Dx()-side)/2
+	y := b.Min.Y + (b.Dy()-side)/2
+	return image.Rect(x, y, x+side, y+side)
+}
+
+// resizeArea уменьшает квадратную область src до size×size, усредняя цвета
+// исходных пикселей, попавших в каждый пиксель результата. При увеличении
+// каждый пиксель результата берёт ближайший исходный.
+func resizeArea(src image.Image, area image.Rectangle, size int) *image.NRGBA {
+	dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+	side := area.Dx()
+	for dy := 0; dy < size; dy++ {
+		y0 := area.Min.Y + dy*side/size
+		y1 := area.Min.Y + (dy+1)*side/size
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for dx := 0; dx < size; dx++ {
+			x0 := area.Min.X + dx*side/size
+			x1 := area.Min.X + (dx+1)*side/size
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var r, g, b, a, n uint64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					c := color.NRGBAModel.Convert(src.At(x, y)).(color.NRGBA)
+					r += uint64(c.R)
+					g += uint64(c.G)
+					b += uint64(c.B)
+					a += uint64(c.A)
+					n++
+				}
+			}
+			dst.SetNRGBA(dx, dy, color.NRGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: uint8(a / n)})
+		}
+	}
+	return dst
+}
+
+// storeAvatar декодирует загруженное изображение, обрезает его до квадрата
+// и сохраняет во всех размерах. Возвращает ключ аватара или сообщение об ошибке.
+func storeAvatar(file multipart.File, userID int) (key string, msg string, err error) {
+	cfg, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return "", "Image could not be read.", nil
+	}
+	if cfg.Width > maxAvatarDimension || cfg.Height > maxAvatarDimension {
+		return "", fmt.Sprintf("Image is too large. Maximum size is %dx%d pixels.", maxAvatarDimension, maxAvatarDimension), nil
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		return "", "", err
+	}
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return "", "Image could not be read.", nil
+	}
+
+	if err := os.MkdirAll(avatarsDir, 0o755); err != nil {
+		return "", "", err
+	}
+	area := squareCrop(img)
+	key = fmt.Sprintf("%d_%d", userID, time.Now().UnixNano())
+	for _, size := range avatarSizes {
+		if err := writePNG(avatarFile(key, size), resizeArea(img, area, size)); err != nil {
+			removeAvatar(key)
+			return "", "", err
+		}
+	}
+	return key, "", nil
+}
+
+// writePNG записывает PNG через временный файл, как storeImage
+func writePNG(path string, img image.Image) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(tmp, img); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// removeAvatar удаляет файлы аватара всех размеров
+func removeAvatar(key string) {
+	if key == "" {
+		return
+	}
+	for _, size := range avatarSizes {
+		if err := os.Remove(avatarFile(key, size)); err != nil && !os.IsNotExist(err) {
+			log.Println("Error removing avatar:", err)
+		}
+	}
+}
+
+// identicon рисует симметричный узор 5×5, цвет и клетки которого
+// определяются SHA-256 от имени пользователя
+func identicon(username string, size int) *image.NRGBA {
+	sum := sha256.Sum256([]byte(username))
+	fg := color.NRGBA{R: sum[0]/2 + 64, G: sum[1]/2 + 64, B: sum[2]/2 + 64, A: 255}
+	bg := color.NRGBA{R: 240, G: 240, B: 240, A: 255}
+
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		row := y * identiconGrid / size
+		for x := 0; x < size; x++ {
+			col := x * identiconGrid / size
+			// Правая половина зеркалит левую
+			if col > identiconGrid/2 {
+				col = identiconGrid - 1 - col
+			}
+			c := bg
+			if sum[3+row*(identiconGrid/2+1)+col]%2 == 0 {
+				c = fg
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// Avatar отдаёт аватар пользователя: /avatar/{name}?s=64.
+// Если пользователь не загрузил картинку, генерируется идентикон.
+func Avatar(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		size := avatarSizes[0]
+		if v := r.URL.Query().Get("s"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				http.Error(w, "Invalid size", http.StatusBadRequest)
+				return
+			}
+			size = avatarSize(n)
+		}
+
+		name := r.PathValue("name")
+		var key string
+		err := db.QueryRow("SELECT avatar FROM users WHERE username = ?", name).Scan(&key)
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Println("Error loading avatar:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(avatarCacheDuration.Seconds())))
+		if key != "" {
+			w.Header().Set("Content-Type", "image/png")
+			http.ServeFile(w, r, avatarFile(key, size))
+			return
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, identicon(name, size)); err != nil {
+			log.Println("Error encoding identicon:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(buf.Bytes())
+	}
+}
+
+// AccountAvatar загружает новый аватар (поле avatar) или удаляет текущий (remove=1)
+func AccountAvatar(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userID, _, ok := sessionUser(db, r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxImageSize+1024*1024)
+		var oldKey string
+		if err := db.QueryRow("SELECT avatar FROM users WHERE id = ?", userID).Scan(&oldKey); err != nil {
+			log.Println("Error loading avatar:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		var newKey string
+		if r.FormValue("remove") != "1" {
+			file, header, err := r.FormFile("avatar")
+			if err != nil {
+				renderAccountProfile(w, db, userID, "Choose an image to upload.", false)
+				return
+			}
+			defer file.Close()
+
+			// Те же проверки размера, расширения и MIME-типа, что и у картинок постов
+			_, msg, err := validateImage(file, header)
+			if err == nil && msg == "" {
+				newKey, msg, err = storeAvatar(file, userID)
+			}
+			if err != nil {
+				log.Println("Error saving avatar:", err)
+				http.Error(w, "Failed to save image", http.StatusInternalServerError)
+				return
+			}
+			if msg != "" {
+				renderAccountProfile(w, db, userID, msg, false)
+				return
+			}
+		}
+
+		if _, err := db.Exec("UPDATE users SET avatar = ? WHERE id = ?", newKey, userID); err != nil {
+			log.Println("Error saving avatar:", err)
+			removeAvatar(newKey)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		removeAvatar(oldKey)
+		http.Redirect(w, r, "/account/profile?saved=1", http.StatusSeeOther)
+	}
+}
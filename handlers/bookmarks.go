@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"01.tomorrow-school.ai/git/zsakhipo/forum/database"
+)
+
+// Максимальная длина метки закладки (в символах unicode)
+const maxBookmarkLabelLength = 30
+
+// userBookmark возвращает, сохранил ли пользователь пост, и метку закладки
+func userBookmark(db *sql.DB, userID, postID int) (saved bool, label string, err error) {
+	err = db.QueryRow("SELECT label FROM bookmarks WHERE user_id = ? AND post_id = ?", userID, postID).Scan(&label)
+	if err == sql.ErrNoRows {
+		return false, "", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+	return true, label, nil
+}
+
+// bookmarkLabels возвращает непустые метки закладок пользователя по алфавиту
+func bookmarkLabels(db *sql.DB, userID int) ([]string, error) {
+	rows, err := db.Query("SELECT DISTINCT label FROM bookmarks WHERE user_id = ? AND label != '' ORDER BY label", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var labels []string
+	for rows.Next() {
+		var label string
+		if err := rows.Scan(&label); err != nil {
+			return nil, err
+		}
+		labels = append(labels, label)
+	}
+	return labels, rows.Err()
+}
+
+// bookmarkRedirect возвращает адрес ленты с теми же фильтрами, что были на странице
+func bookmarkRedirect(r *http.Request, postID int) string {
+	q := url.Values{}
+	for _, key := range []string{"filter", "category", "label"} {
+		if v := r.FormValue("redirect_" + key); v != "" {
+			q.Set(key, v)
+		}
+	}
+	target := "/posts"
+	if len(q) > 0 {
+		target += "?" + q.Encode()
+	}
+	return target + "#post-" + strconv.Itoa(postID)
+}
+
+// Bookmark добавляет пост в закладки или убирает его оттуда: POST /bookmark.
+// Поле label, если передано, задаёт метку закладки без снятия её.
+func Bookmark(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userID, _, ok := sessionUser(db, r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		postID, err := strconv.Atoi(r.FormValue("post_id"))
+		if err != nil {
+			http.Error(w, "Invalid Post ID", http.StatusBadRequest)
+			return
+		}
+		if !database.PostExists(db, postID) {
+			http.Error(w, "Post not found", http.StatusBadRequest)
+			return
+		}
+
+		if _, setLabel := r.Form["label"]; setLabel {
+			// Сохранение метки: закладка создаётся, если её ещё не было
+			label := strings.TrimSpace(r.FormValue("label"))
+			if utf8.RuneCountInString(label) > maxBookmarkLabelLength {
+				http.Error(w, "Label cannot exceed 30 characters", http.StatusBadRequest)
+				return
+			}
+			_, err = db.Exec(`
+				INSERT INTO bookmarks (user_id, post_id, label) VALUES (?, ?, ?)
+				ON CONFLICT(user_id, post_id) DO UPDATE SET label = excluded.label`, userID, postID, label)
+		} else {
+			saved, _, lookupErr := userBookmark(db, userID, postID)
+			switch {
+			case lookupErr != nil:
+				err = lookupErr
+			case saved:
+				_, err = db.Exec("DELETE FROM bookmarks WHERE user_id = ? AND post_id = ?", userID, postID)
+			default:
+				_, err = db.Exec("INSERT INTO bookmarks (user_id, post_id) VALUES (?, ?)", userID, postID)
+			}
+		}
+		if err != nil {
+			log.Println("Error saving bookmark:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, bookmarkRedirect(r, postID), http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,516 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// Правила публикации в категории. Подкатегория подчиняется и правилу родителя,
+// если оно строже: подкатегория объявлений тоже открыта только модераторам.
+const (
+	postingEveryone   = "everyone"   // Публиковать может любой пользователь
+	postingModerators = "moderators" // Только модераторы и администраторы
+	postingReadOnly   = "readonly"   // Новые посты не принимаются, существующие нельзя изменить
+)
+
+// postingRules — правила публикации от самого мягкого к самому строгому
+var postingRules = []string{postingEveryone, postingModerators, postingReadOnly}
+
+// categoryInput — изменяемые поля категории из формы администратора или API
+type categoryInput struct {
+	Name        string
+	Slug        string
+	Description string
+	Color       string
+	Icon        string
+	ParentID    int    // 0 — верхний уровень
+	Posting     string // Пусто — everyone
+}
+
+// CategoriesPageData определяет данные, передаваемые в шаблон admin_categories.html
+type CategoriesPageData struct {
+	CurrentUser  string
+	Categories   []Category // Все категории, включая архивные, в порядке дерева
+	Parents      []Category // Категории верхнего уровня — возможные родители
+	PostingRules []string
+	Form         categoryInput
+	Error        string
+}
+
+// EffectivePosting возвращает действующее правило публикации: более строгое из своего и родительского
+func (c Category) EffectivePosting() string {
+	strictness := func(rule string) int {
+		for i, r := range postingRules {
+			if r == rule {
+				return i
+			}
+		}
+		return 0
+	}
+	if strictness(c.parentPosting) > strictness(c.Posting) {
+		return c.parentPosting
+	}
+	return c.Posting
+}
+
+// canPost сообщает, может ли пользователь с ролью role добавлять посты в категорию
+func (c Category) canPost(role string) bool {
+	if c.Archived {
+		return false
+	}
+	switch c.EffectivePosting() {
+	case postingReadOnly:
+		return false
+	case postingModerators:
+		return isModeratorRole(role)
+	}
+	return true
+}
+
+// categoryTree собирает подкатегории под родителями. Порядок сохраняется;
+// подкатегория, родителя которой нет в списке (например, он в архиве), выводится на верхнем уровне.
+func categoryTree(categories []Category) []Category {
+	present := map[int]bool{}
+	for _, c := range categories {
+		present[c.ID] = true
+	}
+	var roots []Category
+	index := map[int]int{} // ID родителя → позиция в roots
+	for _, c := range categories {
+		if c.ParentID != 0 && present[c.ParentID] {
+			if i, ok := index[c.ParentID]; ok {
+				roots[i].Children = append(roots[i].Children, c)
+			}
+			continue
+		}
+		index[c.ID] = len(roots)
+		roots = append(roots, c)
+	}
+	return roots
+}
+
+// postableCategories оставляет категории, в которые пользователь с ролью role может добавить пост,
+// и те, в которых пост уже состоит (keep)
+func postableCategories(categories []Category, role string, keep []Category) []Category {
+	kept := map[int]bool{}
+	for _, c := range keep {
+		kept[c.ID] = true
+	}
+	var out []Category
+	for _, c := range categories {
+		if kept[c.ID] || c.canPost(role) {
+			out = append(out, c)
+		}
+	}
+	for _, c := range keep {
+		if !containsCategory(out, c.ID) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func containsCategory(categories []Category, id int) bool {
+	for _, c := range categories {
+		if c.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// postReadOnly сообщает, состоит ли пост в категории только для чтения; такой пост нельзя изменить
+func postReadOnly(db *sql.DB, postID int) (bool, error) {
+	categories, err := queryPostCategories(db, postID)
+	if err != nil {
+		return false, err
+	}
+	for _, c := range categories {
+		if c.EffectivePosting() == postingReadOnly {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// categoryFamilyNames возвращает имя категории и имена её подкатегорий:
+// фильтр по родительской категории включает подкатегории
+func categoryFamilyNames(db *sql.DB, categoryID int) ([]string, error) {
+	rows, err := db.Query("SELECT name FROM categories WHERE id = ? OR parent_id = ? ORDER BY id", categoryID, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// createCategory добавляет категорию в конец панели фильтров. Поля должны быть проверены validateCategory.
+func createCategory(db *sql.DB, in categoryInput) (int, error) {
+	res, err := db.Exec(`
+		INSERT INTO categories (name, slug, description, color, icon, parent_id, posting, position)
+		VALUES (?, ?, ?, ?, ?, ?, ?, (SELECT COALESCE(MAX(position), 0) + 1 FROM categories))`,
+		in.Name, in.Slug, in.Description, in.Color, in.Icon, in.ParentID, in.Posting)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+// updateCategory сохраняет поля категории. Webhook хранят имя категории,
+// поэтому при переименовании они переходят на новое имя.
+func updateCategory(db *sql.DB, categoryID int, in categoryInput) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var oldName string
+	if err := tx.QueryRow("SELECT name FROM categories WHERE id = ?", categoryID).Scan(&oldName); err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE categories SET name = ?, slug = ?, description = ?, color = ?, icon = ?, parent_id = ?, posting = ? WHERE id = ?",
+		in.Name, in.Slug, in.Description, in.Color, in.Icon, in.ParentID, in.Posting, categoryID)
+	if err != nil {
+		return err
+	}
+	if oldName != in.Name {
+		if _, err := tx.Exec("UPDATE webhooks SET category = ? WHERE category = ?", in.Name, oldName); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// setCategoryArchived переносит категорию в архив или возвращает из него.
+// Посты архивной категории остаются на месте, новые в неё не добавляются.
+func setCategoryArchived(db *sql.DB, categoryID int, archived bool) error {
+	_, err := db.Exec("UPDATE categories SET archived = ? WHERE id = ?", archived, categoryID)
+	return err
+}
+
+// moveCategory меняет категорию местами с соседней категорией того же уровня
+// (delta = -1 — выше, 1 — ниже) и перенумеровывает все категории по порядку
+func moveCategory(db *sql.DB, categoryID, delta int) error {
+	all, err := queryAllCategories(db)
+	if err != nil {
+		return err
+	}
+	tree := categoryTree(all)
+	swap := func(siblings []Category) bool {
+		for i, c := range siblings {
+			if c.ID != categoryID {
+				continue
+			}
+			if j := i + delta; j >= 0 && j < len(siblings) {
+				siblings[i], siblings[j] = siblings[j], siblings[i]
+			}
+			return true
+		}
+		return false
+	}
+	if !swap(tree) {
+		for _, root := range tree {
+			if swap(root.Children) {
+				break
+			}
+		}
+	}
+	var categories []Category
+	for _, root := range tree {
+		categories = append(categories, root)
+		categories = append(categories, root.Children...)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for i, c := range categories {
+		if _, err := tx.Exec("UPDATE categories SET position = ? WHERE id = ?", i+1, c.ID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// mergeCategories переносит посты, подписки и webhook категории sourceID в targetID
+// и удаляет sourceID. Пост, который был в обеих категориях, остаётся в targetID один раз.
+// Подкатегории sourceID переходят к targetID, а если она сама подкатегория — к её родителю.
+// Слить категорию с её же подкатегорией нельзя (errMergeIntoChild).
+func mergeCategories(db *sql.DB, sourceID, targetID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var sourceName, targetName string
+	var targetParent int
+	if err := tx.QueryRow("SELECT name FROM categories WHERE id = ?", sourceID).Scan(&sourceName); err != nil {
+		return err
+	}
+	if err := tx.QueryRow("SELECT name, parent_id FROM categories WHERE id = ?", targetID).Scan(&targetName, &targetParent); err != nil {
+		return err
+	}
+	if targetParent == sourceID {
+		return errMergeIntoChild
+	}
+	newParent := targetID
+	if targetParent != 0 {
+		newParent = targetParent
+	}
+
+	steps := []struct {
+		query string
+		args  []interface{}
+	}{
+		{"INSERT OR IGNORE INTO post_categories (post_id, category_id) SELECT post_id, ? FROM post_categories WHERE category_id = ?", []interface{}{targetID, sourceID}},
+		{"DELETE FROM post_categories WHERE category_id = ?", []interface{}{sourceID}},
+		{"INSERT OR IGNORE INTO category_follows (user_id, category_id) SELECT user_id, ? FROM category_follows WHERE category_id = ?", []interface{}{targetID, sourceID}},
+		{"DELETE FROM category_follows WHERE category_id = ?", []interface{}{sourceID}},
+		{"UPDATE webhooks SET category = ? WHERE category = ?", []interface{}{targetName, sourceName}},
+		{"UPDATE categories SET parent_id = ? WHERE parent_id = ?", []interface{}{newParent, sourceID}},
+		{"DELETE FROM categories WHERE id = ?", []interface{}{sourceID}},
+	}
+	for _, s := range steps {
+		if _, err := tx.Exec(s.query, s.args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// renderAdminCategories выводит страницу управления категориями с ошибкой формы, если она есть
+func renderAdminCategories(db *sql.DB, w http.ResponseWriter, data CategoriesPageData, status int) {
+	var err error
+	data.Categories, err = queryAllCategories(db)
+	if err != nil {
+		log.Println("Error fetching categories:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	for _, c := range data.Categories {
+		if c.ParentID == 0 {
+			data.Parents = append(data.Parents, c)
+		}
+	}
+	data.PostingRules = postingRules
+	tmpl, err := template.ParseFiles("templates/admin_categories.html")
+	if err != nil {
+		log.Println("Error parsing admin_categories.html template:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	tmpl.Execute(w, data)
+}
+
+// categoryFormInput читает поля категории из формы; неверный parent_id отклонит validateCategory
+func categoryFormInput(r *http.Request) categoryInput {
+	parentID, err := strconv.Atoi(r.FormValue("parent_id"))
+	if err != nil && r.FormValue("parent_id") != "" {
+		parentID = -1
+	}
+	return categoryInput{
+		Name:        r.FormValue("name"),
+		Slug:        r.FormValue("slug"),
+		Description: r.FormValue("description"),
+		Color:       r.FormValue("color"),
+		Icon:        r.FormValue("icon"),
+		ParentID:    parentID,
+		Posting:     r.FormValue("posting"),
+	}
+}
+
+// saveCategoryError отвечает на ошибку сохранения категории: ошибку валидации показывает
+// на странице управления, остальные — как внутреннюю ошибку
+func saveCategoryError(db *sql.DB, w http.ResponseWriter, username string, in categoryInput, err error) {
+	var vErr validationError
+	if errors.As(err, &vErr) {
+		renderAdminCategories(db, w, CategoriesPageData{CurrentUser: username, Form: in, Error: vErr.Error()}, http.StatusBadRequest)
+		return
+	}
+	log.Println("Error saving category:", err)
+	http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+}
+
+// formCategoryID разбирает category_id из формы; при ошибке отвечает 400 или 404
+func formCategoryID(db *sql.DB, w http.ResponseWriter, r *http.Request, field string) (int, bool) {
+	categoryID, err := strconv.Atoi(r.FormValue(field))
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return 0, false
+	}
+	if _, err := lookupCategoryByID(db, categoryID); err != nil {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return 0, false
+	}
+	return categoryID, true
+}
+
+// AdminCategories обрабатывает страницу /admin/categories: список категорий и создание новой
+func AdminCategories(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		username, ok := adminUser(db, w, r)
+		if !ok {
+			return
+		}
+		if r.Method == http.MethodGet {
+			renderAdminCategories(db, w, CategoriesPageData{CurrentUser: username}, http.StatusOK)
+			return
+		}
+
+		in := categoryFormInput(r)
+		err := validateCategory(db, &in, 0)
+		if err == nil {
+			_, err = createCategory(db, in)
+		}
+		if err != nil {
+			saveCategoryError(db, w, username, in, err)
+			return
+		}
+		http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+	}
+}
+
+// UpdateCategory сохраняет имя, slug, описание, цвет и иконку категории
+func UpdateCategory(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		username, ok := adminUser(db, w, r)
+		if !ok {
+			return
+		}
+		categoryID, ok := formCategoryID(db, w, r, "category_id")
+		if !ok {
+			return
+		}
+
+		in := categoryFormInput(r)
+		err := validateCategory(db, &in, categoryID)
+		if err == nil {
+			err = updateCategory(db, categoryID, in)
+		}
+		if err != nil {
+			// Форма создания не должна подхватить поля редактируемой категории
+			saveCategoryError(db, w, username, categoryInput{}, err)
+			return
+		}
+		http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+	}
+}
+
+// ArchiveCategory переносит категорию в архив (action=archive) или возвращает из него (action=restore)
+func ArchiveCategory(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if _, ok := adminUser(db, w, r); !ok {
+			return
+		}
+		categoryID, ok := formCategoryID(db, w, r, "category_id")
+		if !ok {
+			return
+		}
+		if err := setCategoryArchived(db, categoryID, r.FormValue("action") != "restore"); err != nil {
+			log.Println("Error archiving category:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+	}
+}
+
+// MoveCategory сдвигает категорию в панели фильтров: direction=up или direction=down
+func MoveCategory(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if _, ok := adminUser(db, w, r); !ok {
+			return
+		}
+		categoryID, ok := formCategoryID(db, w, r, "category_id")
+		if !ok {
+			return
+		}
+		var delta int
+		switch r.FormValue("direction") {
+		case "up":
+			delta = -1
+		case "down":
+			delta = 1
+		default:
+			http.Error(w, "Invalid direction", http.StatusBadRequest)
+			return
+		}
+		if err := moveCategory(db, categoryID, delta); err != nil {
+			log.Println("Error moving category:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+	}
+}
+
+// MergeCategory сливает категорию category_id с категорией into и удаляет первую
+func MergeCategory(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		username, ok := adminUser(db, w, r)
+		if !ok {
+			return
+		}
+		sourceID, ok := formCategoryID(db, w, r, "category_id")
+		if !ok {
+			return
+		}
+		targetID, ok := formCategoryID(db, w, r, "into")
+		if !ok {
+			return
+		}
+		if sourceID == targetID {
+			saveCategoryError(db, w, username, categoryInput{}, errMergeIntoSelf)
+			return
+		}
+		if err := mergeCategories(db, sourceID, targetID); err != nil {
+			if errors.Is(err, errMergeIntoChild) {
+				saveCategoryError(db, w, username, categoryInput{}, err)
+				return
+			}
+			log.Println("Error merging categories:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+	}
+}
@@ -5,11 +5,9 @@ import (
 	"log"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
 	"01.tomorrow-school.ai/git/zsakhipo/forum/database"
-	"unicode/utf8"
 )
 
 // Обработчик отправки комментария к посту
@@ -50,25 +48,16 @@ func Comments(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Получение содержимого комментария
-		content := r.FormValue("content")
-		if strings.TrimSpace(content) == "" {
-			// Получаем данные для posts.html
+		// Получение содержимого комментария и проверка ограничений
+		content := normalizeText(r.FormValue("content"))
+		if err := validateComment(content); err != nil {
+			// Перенаправляем на /posts с кодом ошибки
+			errCode := "empty_comment"
+			if err == errCommentTooLong {
+				errCode = "comment_too_long"
+			}
 			categoryFilter := r.FormValue("redirect_category")
-			// Получаем посты и категории (импортировать нужные структуры)
-			// Для простоты: перенаправляем на /posts с параметром ошибки
-			http.Redirect(w, r, "/posts?error=empty_comment"+func() string {
-				if categoryFilter != "" {
-					return "&category=" + categoryFilter
-				}
-				return ""
-			}(), http.StatusSeeOther)
-			return
-		}
-		// Ограничение по количеству слов для комментария
-		if utf8.RuneCountInString(content) > 120 {
-			categoryFilter := r.FormValue("redirect_category")
-			http.Redirect(w, r, "/posts?error=comment_too_long"+func() string {
+			http.Redirect(w, r, "/posts?error="+errCode+func() string {
 				if categoryFilter != "" {
 					return "&category=" + categoryFilter
 				}
@@ -78,12 +67,13 @@ func Comments(db *sql.DB) http.HandlerFunc {
 		}
 
 		// Вставка комментария в БД
-		_, err = db.Exec("INSERT INTO comments (post_id, user_id, content) VALUES (?, ?, ?)", postID, userID, content)
+		commentID, err := insertComment(db, postID, userID, content)
 		if err != nil {
 			log.Println("Не удалось сохранить комментарий в БД:", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
+		publishCommentCreated(db, commentID)
 
 		// Перенаправление на страницу постов, сохраняя текущую категорию
 		redirectCategory := r.FormValue("redirect_category")
@@ -4,26 +4,25 @@ import (
 	"database/sql"
 	"log"
 	"net/http"
-	"strconv"
 	"time"
 
 	"01.tomorrow-school.ai/git/zsakhipo/forum/database"
-	"encoding/json"
 )
 
-// DeletePost удаляет пост, если текущий пользователь является его автором
+// DeletePost удаляет пост, если текущий пользователь является его автором.
+// Вызывается со страницы через fetch, поэтому ошибки возвращаются в формате JSON API.
 func DeletePost(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Проверка метода запроса: только DELETE
 		if r.Method != http.MethodDelete {
-			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			apiMethodNotAllowed(w, http.MethodDelete)
 			return
 		}
 
 		// Проверка сессии пользователя
 		cookie, err := r.Cookie("session_id")
 		if err != nil {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			writeAPIError(w, http.StatusUnauthorized, "Authentication required")
 			return
 		}
 
@@ -31,130 +30,75 @@ func DeletePost(db *sql.DB) http.HandlerFunc {
 		err = db.QueryRow("SELECT user_id FROM sessions WHERE id = ? AND expiry > ?", cookie.Value, time.Now()).Scan(&userID)
 		if err != nil {
 			log.Println("Error validating user session for post deletion:", err)
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			writeAPIError(w, http.StatusUnauthorized, "Authentication required")
 			return
 		}
 
-		// Получение ID поста из формы или JSON
-		var postID int
-		if r.Method == http.MethodDelete {
-			var req struct{ PostID int `json:"post_id"` }
-			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-				http.Error(w, "Invalid request", http.StatusBadRequest)
-				return
-			}
-			postID = req.PostID
-		} else {
-			postID, err = strconv.Atoi(r.FormValue("post_id"))
-			if err != nil {
-				log.Println("Invalid post ID for deletion:", r.FormValue("post_id"), err)
-				http.Error(w, "Invalid Post ID", http.StatusBadRequest)
-				return
-			}
+		// Получение ID поста из JSON
+		var req apiPostDeleteInput
+		if err := decodeJSON(r, &req); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
 		}
+		postID := req.PostID
 
 		// Проверка поста
 		if !database.PostExists(db, postID) {
-			http.Error(w, "Post not found", http.StatusBadRequest)
+			writeAPIError(w, http.StatusNotFound, "Post not found")
 			return
 		}
 
 		// Проверка прав: является ли пользователь автором поста
 		var postAuthorID int
-		err = db.QueryRow("SELECT user_id FROM posts WHERE id = ?", postID).Scan(&postAuthorID)
+		var imagePath sql.NullString
+		err = db.QueryRow("SELECT user_id, image_path FROM posts WHERE id = ?", postID).Scan(&postAuthorID, &imagePath)
 		if err != nil {
 			if err == sql.ErrNoRows {
-				http.Error(w, "Post not found", http.StatusNotFound)
+				writeAPIError(w, http.StatusNotFound, "Post not found")
 				return
 			}
 			log.Println("Error querying post author for deletion:", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
 			return
 		}
 
 		// Если пользователь не автор, возвращаем 403 Forbidden
 		if postAuthorID != userID {
-			http.Error(w, "Forbidden: You are not the author of this post.", http.StatusForbidden)
-			return
-		}
-
-		// Начало транзакции для атомарного удаления связанных данных
-		tx, err := db.Begin()
-		if err != nil {
-			log.Println("Failed to begin transaction for post deletion:", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
-		defer tx.Rollback() // Откат транзакции в случае ошибки
-
-		// Удаление связанных лайков/дизлайков
-		_, err = tx.Exec("DELETE FROM likes WHERE post_id = ?", postID)
-		if err != nil {
-			log.Println("Failed to delete likes for post:", postID, err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
-
-		// Удаление связанных комментариев
-		_, err = tx.Exec("DELETE FROM comments WHERE post_id = ?", postID)
-		if err != nil {
-			log.Println("Failed to delete comments for post:", postID, err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
-
-		// Удаление связанных категорий
-		_, err = tx.Exec("DELETE FROM post_categories WHERE post_id = ?", postID)
-		if err != nil {
-			log.Println("Failed to delete post categories for post:", postID, err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
-
-		// Удаление самого поста
-		res, err := tx.Exec("DELETE FROM posts WHERE id = ? AND user_id = ?", postID, userID)
-		if err != nil {
-			log.Println("Failed to delete post from DB:", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
-		// Проверка успешности удаления поста
-		if count, _ := res.RowsAffected(); count == 0 {
-			log.Println("Post not found or unauthorized during final delete check (should not happen): postID", postID, "userID", userID)
-			http.Error(w, "Post not found or unauthorized", http.StatusForbidden)
+			writeAPIError(w, http.StatusForbidden, "You are not the author of this post")
 			return
 		}
 
-		// Фиксация транзакции
-		if err := tx.Commit(); err != nil {
-			log.Println("Failed to commit transaction for post deletion:", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		// Удаление поста вместе с лайками, комментариями и категориями
+		categories := postCategoryNames(db, postID)
+		if err := deletePost(db, postID); err != nil {
+			log.Println("Failed to delete post from DB:", postID, err)
+			writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
 			return
 		}
-
-		// Перенаправление на страницу с постами, сохраняя текущую категорию
-		redirectCategory := r.FormValue("redirect_category")
-		redirectURL := "/posts"
-		if redirectCategory != "" {
-			redirectURL += "?category=" + redirectCategory
+		publishPostDeleted(db, postID, categories)
+		if imagePath.Valid {
+			if err := removeImage(imagePath.String); err != nil {
+				log.Println("Error removing image of deleted post:", err)
+			}
 		}
-		http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+		w.WriteHeader(http.StatusNoContent)
 	}
 }
 
-// DeleteComment удаляет комментарий, если текущий пользователь является его автором
+// DeleteComment удаляет комментарий, если текущий пользователь является его автором.
+// Вызывается со страницы через fetch, поэтому ошибки возвращаются в формате JSON API.
 func DeleteComment(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Проверка метода запроса: только DELETE
 		if r.Method != http.MethodDelete {
-			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			apiMethodNotAllowed(w, http.MethodDelete)
 			return
 		}
 
 		// Проверка сессии пользователя
 		cookie, err := r.Cookie("session_id")
 		if err != nil {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			writeAPIError(w, http.StatusUnauthorized, "Authentication required")
 			return
 		}
 
@@ -162,91 +106,44 @@ func DeleteComment(db *sql.DB) http.HandlerFunc {
 		err = db.QueryRow("SELECT user_id FROM sessions WHERE id = ? AND expiry > ?", cookie.Value, time.Now()).Scan(&userID)
 		if err != nil {
 			log.Println("Error validating user session for comment deletion:", err)
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			writeAPIError(w, http.StatusUnauthorized, "Authentication required")
 			return
 		}
 
-		// Получение ID комментария из формы или JSON
-		var commentID int
-		if r.Method == http.MethodDelete {
-			var req struct{ CommentID int `json:"comment_id"` }
-			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-				http.Error(w, "Invalid request", http.StatusBadRequest)
-				return
-			}
-			commentID = req.CommentID
-		} else {
-			commentID, err = strconv.Atoi(r.FormValue("comment_id"))
-			if err != nil {
-				log.Println("Invalid comment ID for deletion:", r.FormValue("comment_id"), err)
-				http.Error(w, "Invalid Comment ID", http.StatusBadRequest)
-				return
-			}
+		// Получение ID комментария из JSON
+		var req apiCommentDeleteInput
+		if err := decodeJSON(r, &req); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
 		}
+		commentID := req.CommentID
 
 		// Проверка прав: является ли пользователь автором комментария
-		var commentAuthorID int
-		err = db.QueryRow("SELECT user_id FROM comments WHERE id = ?", commentID).Scan(&commentAuthorID)
+		var commentAuthorID, postID int
+		err = db.QueryRow("SELECT user_id, post_id FROM comments WHERE id = ?", commentID).Scan(&commentAuthorID, &postID)
 		if err != nil {
 			if err == sql.ErrNoRows {
-				http.Error(w, "Comment not found", http.StatusNotFound)
+				writeAPIError(w, http.StatusNotFound, "Comment not found")
 				return
 			}
 			log.Println("Error querying comment author for deletion:", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
 			return
 		}
 
 		// Если пользователь не автор, возвращаем 403 Forbidden
 		if commentAuthorID != userID {
-			http.Error(w, "Forbidden: You are not the author of this comment.", http.StatusForbidden)
+			writeAPIError(w, http.StatusForbidden, "You are not the author of this comment")
 			return
 		}
 
-		// Начало транзакции для атомарного удаления связанных данных
-		tx, err := db.Begin()
-		if err != nil {
-			log.Println("Failed to begin transaction for comment deletion:", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		// Удаление комментария вместе с его лайками
+		if err := deleteComment(db, commentID); err != nil {
+			log.Println("Failed to delete comment from DB:", commentID, err)
+			writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
 			return
 		}
-		defer tx.Rollback() // Откат транзакции в случае ошибки
-
-		// Удаление связанных лайков/дизлайков для комментария
-		_, err = tx.Exec("DELETE FROM likes WHERE comment_id = ?", commentID)
-		if err != nil {
-			log.Println("Failed to delete likes for comment:", commentID, err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
-
-		// Удаление самого комментария
-		res, err := tx.Exec("DELETE FROM comments WHERE id = ? AND user_id = ?", commentID, userID)
-		if err != nil {
-			log.Println("Failed to delete comment from DB:", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
-		// Проверка успешности удаления комментария
-		if count, _ := res.RowsAffected(); count == 0 {
-			log.Println("Comment not found or unauthorized during final delete check (should not happen): commentID", commentID, "userID", userID)
-			http.Error(w, "Comment not found or unauthorized", http.StatusForbidden)
-			return
-		}
-
-		// Фиксация транзакции
-		if err := tx.Commit(); err != nil {
-			log.Println("Failed to commit transaction for comment deletion:", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
-
-		// Перенаправление на страницу с постами, сохраняя текущую категорию
-		redirectCategory := r.FormValue("redirect_category")
-		redirectURL := "/posts"
-		if redirectCategory != "" {
-			redirectURL += "?category=" + redirectCategory
-		}
-		http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+		publishCommentDeleted(db, postID, commentID)
+		w.WriteHeader(http.StatusNoContent)
 	}
 }
@@ -0,0 +1,520 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+	"unicode/utf8"
+
+	"01.tomorrow-school.ai/git/zsakhipo/forum/mailer"
+)
+
+// Частота дайджеста
+const (
+	digestOff    = "off"
+	digestDaily  = "daily"
+	digestWeekly = "weekly"
+)
+
+// digestPeriods — за какой период собирается дайджест каждой частоты
+var digestPeriods = map[string]time.Duration{
+	digestDaily:  24 * time.Hour,
+	digestWeekly: 7 * 24 * time.Hour,
+}
+
+const (
+	digestCheckInterval = time.Hour // Как часто планировщик ищет пользователей, которым пора отправить дайджест
+	digestSectionLimit  = 10        // Сколько записей показывать в каждом разделе
+	digestTopLimit      = 5         // Сколько популярных постов показывать
+)
+
+// DigestPost — пост в дайджесте
+type DigestPost struct {
+	Title    string
+	Author   string
+	Category string
+	Score    int // Лайки минус дизлайки
+	URL      string
+}
+
+// DigestReply — комментарий к посту получателя
+type DigestReply struct {
+	PostTitle string
+	Author    string
+	Excerpt   string
+	URL       string
+}
+
+// Digest — данные шаблонов письма templates/email/digest.html и digest.txt
+type Digest struct {
+	Username       string
+	Frequency      string
+	NewPosts       []DigestPost
+	Replies        []DigestReply
+	TopPosts       []DigestPost
+	SettingsURL    string
+	UnsubscribeURL string
+}
+
+// empty сообщает, что за период ничего не произошло и письмо не нужно
+func (d Digest) empty() bool {
+	return len(d.NewPosts) == 0 && len(d.Replies) == 0 && len(d.TopPosts) == 0
+}
+
+// DigestPageData — данные для шаблона account_digest.html
+type DigestPageData struct {
+	CurrentUser string
+	Email       string
+	Frequency   string
+	Categories  []DigestCategory
+	Saved       bool
+}
+
+// DigestCategory — категория и отметка подписки на неё
+type DigestCategory struct {
+	ID       int
+	Name     string
+	Followed bool
+}
+
+// UnsubscribePageData — данные для шаблона digest_unsubscribe.html
+type UnsubscribePageData struct {
+	UserID       int
+	Signature    string
+	Unsubscribed bool
+}
+
+// appSecret возвращает ключ с данным именем, создавая его при первом обращении.
+// Ключ хранится в БД, чтобы подписанные ссылки оставались действительными после перезапуска.
+func appSecret(db *sql.DB, name string) ([]byte, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec("INSERT OR IGNORE INTO app_secrets (name, value) VALUES (?, ?)", name, hex.EncodeToString(buf)); err != nil {
+		return nil, err
+	}
+	var value string
+	if err := db.QueryRow("SELECT value FROM app_secrets WHERE name = ?", name).Scan(&value); err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(value)
+}
+
+// unsubscribeSignature подписывает ID пользователя для ссылки отписки
+func unsubscribeSignature(key []byte, userID int) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("digest-unsubscribe:" + strconv.Itoa(userID)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// unsubscribeURL возвращает ссылку отписки от дайджеста, которая работает без входа
+func unsubscribeURL(base string, key []byte, userID int) string {
+	return base + "/digest/unsubscribe?" + url.Values{
+		"u":   {strconv.Itoa(userID)},
+		"sig": {unsubscribeSignature(key, userID)},
+	}.Encode()
+}
+
+// StartDigestScheduler рассылает дайджесты до отмены ctx: сразу при запуске и затем каждый час.
+// baseURL — адрес форума для ссылок в письмах, например https://forum.example.com.
+func StartDigestScheduler(ctx context.Context, db *sql.DB, m mailer.Mailer, baseURL string) {
+	ticker := time.NewTicker(digestCheckInterval)
+	defer ticker.Stop()
+	for {
+		sendDueDigests(ctx, db, m, baseURL, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendDueDigests отправляет дайджест всем, у кого с прошлой отправки прошёл период.
+// Письмо, которое не удалось отправить, повторяется при следующей проверке.
+func sendDueDigests(ctx context.Context, db *sql.DB, m mailer.Mailer, baseURL string, now time.Time) int {
+	key, err := appSecret(db, "digest_unsubscribe")
+	if err != nil {
+		log.Println("Error loading digest signing key:", err)
+		return 0
+	}
+
+	rows, err := db.Query(`
+		SELECT u.id, u.username, u.email, d.frequency, d.last_sent_at
+		FROM digest_settings d
+		JOIN users u ON d.user_id = u.id
+		WHERE d.frequency != ?`, digestOff)
+	if err != nil {
+		log.Println("Error querying digest subscribers:", err)
+		return 0
+	}
+	type subscriber struct {
+		id                         int
+		username, email, frequency string
+		since                      time.Time
+	}
+	var due []subscriber
+	for rows.Next() {
+		var s subscriber
+		var lastSent sql.NullTime
+		if err := rows.Scan(&s.id, &s.username, &s.email, &s.frequency, &lastSent); err != nil {
+			log.Println("Error scanning digest subscriber:", err)
+			continue
+		}
+		period, ok := digestPeriods[s.frequency]
+		if !ok {
+			continue
+		}
+		s.since = now.Add(-period)
+		if lastSent.Valid {
+			if lastSent.Time.After(s.since) {
+				continue // Период ещё не прошёл
+			}
+			s.since = lastSent.Time
+		}
+		due = append(due, s)
+	}
+	rows.Close()
+
+	sent := 0
+	for _, s := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		digest, err := buildDigest(db, s.id, s.since, baseURL)
+		if err != nil {
+			log.Println("Error building digest:", err)
+			continue
+		}
+		digest.Username, digest.Frequency = s.username, s.frequency
+		digest.SettingsURL = baseURL + "/account/digest"
+		digest.UnsubscribeURL = unsubscribeURL(baseURL, key, s.id)
+
+		// Пустой дайджест не отправляем, но период отсчитываем заново
+		if !digest.empty() {
+			msg, err := renderDigest(digest)
+			if err != nil {
+				log.Println("Error rendering digest:", err)
+				continue
+			}
+			msg.To = s.email
+			if err := m.Send(msg); err != nil {
+				log.Println("Error sending digest to", s.email+":", err)
+				continue
+			}
+			sent++
+		}
+		if _, err := db.Exec("UPDATE digest_settings SET last_sent_at = ? WHERE user_id = ?", now, s.id); err != nil {
+			log.Println("Error updating digest last_sent_at:", err)
+		}
+	}
+	return sent
+}
+
+// buildDigest собирает разделы дайджеста пользователя за период с since
+func buildDigest(db *sql.DB, userID int, since time.Time, base string) (Digest, error) {
+	var d Digest
+	since = since.UTC() // created_at заполняется CURRENT_TIMESTAMP в UTC
+
+	// Новые посты в категориях, на которые подписан пользователь, и в их подкатегориях
+	rows, err := db.Query(`
+		SELECT p.id, p.title, u.username, MIN(c.name)
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		JOIN post_categories pc ON pc.post_id = p.id
+		JOIN categories c ON c.id = pc.category_id
+		JOIN category_follows f ON f.category_id IN (c.id, c.parent_id) AND f.user_id = ?
+		WHERE p.created_at > ? AND p.user_id != ? AND p.publish_at IS NULL
+		GROUP BY p.id
+		ORDER BY p.created_at DESC
+		LIMIT ?`, userID, since, userID, digestSectionLimit)
+	if err != nil {
+		return d, err
+	}
+	for rows.Next() {
+		var id int
+		var p DigestPost
+		if err := rows.Scan(&id, &p.Title, &p.Author, &p.Category); err != nil {
+			rows.Close()
+			return d, err
+		}
+		p.URL = postURL(base, id)
+		d.NewPosts = append(d.NewPosts, p)
+	}
+	rows.Close()
+
+	// Ответы других пользователей на посты получателя
+	rows, err = db.Query(`
+		SELECT c.id, p.title, u.username, c.content
+		FROM comments c
+		JOIN posts p ON c.post_id = p.id
+		JOIN users u ON c.user_id = u.id
+		WHERE p.user_id = ? AND c.user_id != ? AND c.created_at > ?
+		ORDER BY c.created_at DESC
+		LIMIT ?`, userID, userID, since, digestSectionLimit)
+	if err != nil {
+		return d, err
+	}
+	for rows.Next() {
+		var id int
+		var r DigestReply
+		var content string
+		if err := rows.Scan(&id, &r.PostTitle, &r.Author, &content); err != nil {
+			rows.Close()
+			return d, err
+		}
+		r.Excerpt = excerpt(content, 200)
+		r.URL = base + "/posts#comment-" + strconv.Itoa(id)
+		d.Replies = append(d.Replies, r)
+	}
+	rows.Close()
+
+	// Самые популярные посты периода
+	rows, err = db.Query(`
+		SELECT p.id, p.title, u.username,
+			COALESCE(SUM(CASE WHEN l.is_like = 1 THEN 1 WHEN l.is_like = 0 THEN -1 ELSE 0 END), 0) AS score
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		LEFT JOIN likes l ON l.post_id = p.id AND l.comment_id IS NULL
+		WHERE p.created_at > ? AND p.publish_at IS NULL
+		GROUP BY p.id
+		HAVING score > 0
+		ORDER BY score DESC, p.created_at DESC
+		LIMIT ?`, since, digestTopLimit)
+	if err != nil {
+		return d, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var p DigestPost
+		if err := rows.Scan(&id, &p.Title, &p.Author, &p.Score); err != nil {
+			return d, err
+		}
+		p.URL = postURL(base, id)
+		d.TopPosts = append(d.TopPosts, p)
+	}
+	return d, rows.Err()
+}
+
+// excerpt обрезает текст до limit символов по границе слова
+func excerpt(text string, limit int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	cut := string([]rune(text)[:limit])
+	if i := strings.LastIndex(cut, " "); i > limit/2 {
+		cut = cut[:i]
+	}
+	return cut + "…"
+}
+
+// renderDigest строит письмо из HTML- и текстового шаблонов
+func renderDigest(d Digest) (mailer.Message, error) {
+	htmlTmpl, err := template.ParseFiles("templates/email/digest.html")
+	if err != nil {
+		return mailer.Message{}, err
+	}
+	textTmpl, err := texttemplate.ParseFiles("templates/email/digest.txt")
+	if err != nil {
+		return mailer.Message{}, err
+	}
+	var htmlBody, textBody bytes.Buffer
+	if err := htmlTmpl.Execute(&htmlBody, d); err != nil {
+		return mailer.Message{}, err
+	}
+	if err := textTmpl.Execute(&textBody, d); err != nil {
+		return mailer.Message{}, err
+	}
+
+	subject := "Your daily forum digest"
+	if d.Frequency == digestWeekly {
+		subject = "Your weekly forum digest"
+	}
+	return mailer.Message{
+		Subject: subject,
+		Text:    textBody.String(),
+		HTML:    htmlBody.String(),
+		// Почтовые клиенты показывают кнопку отписки и отправляют POST на эту ссылку (RFC 8058)
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<" + d.UnsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	}, nil
+}
+
+// AccountDigest обрабатывает страницу /account/digest: частота дайджеста и категории
+func AccountDigest(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userID, username, ok := sessionUser(db, r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		// Обработка POST-запроса: сохранение настроек
+		if r.Method == http.MethodPost {
+			frequency := r.FormValue("frequency")
+			if _, ok := digestPeriods[frequency]; !ok && frequency != digestOff {
+				http.Error(w, "Invalid frequency", http.StatusBadRequest)
+				return
+			}
+			var categoryIDs []int
+			for _, v := range r.Form["categories"] {
+				id, err := strconv.Atoi(v)
+				if err != nil {
+					http.Error(w, "Invalid category", http.StatusBadRequest)
+					return
+				}
+				categoryIDs = append(categoryIDs, id)
+			}
+			if err := saveDigestSettings(db, userID, frequency, categoryIDs); err != nil {
+				log.Println("Error saving digest settings:", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			http.Redirect(w, r, "/account/digest?saved=1", http.StatusSeeOther)
+			return
+		}
+
+		data := DigestPageData{CurrentUser: username, Frequency: digestOff, Saved: r.URL.Query().Get("saved") == "1"}
+		err := db.QueryRow("SELECT email FROM users WHERE id = ?", userID).Scan(&data.Email)
+		if err == nil {
+			err = db.QueryRow("SELECT frequency FROM digest_settings WHERE user_id = ?", userID).Scan(&data.Frequency)
+			if err == sql.ErrNoRows {
+				err = nil
+			}
+		}
+		if err == nil {
+			data.Categories, err = queryDigestCategories(db, userID)
+		}
+		if err != nil {
+			log.Println("Error loading digest settings:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		tmpl, err := template.ParseFiles("templates/account_digest.html")
+		if err != nil {
+			log.Println("Error parsing account_digest.html template:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		tmpl.Execute(w, data)
+	}
+}
+
+// saveDigestSettings сохраняет частоту и подписки на категории одной транзакцией
+func saveDigestSettings(db *sql.DB, userID int, frequency string, categoryIDs []int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO digest_settings (user_id, frequency) VALUES (?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET frequency = excluded.frequency`, userID, frequency)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM category_follows WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	for _, id := range categoryIDs {
+		// Несуществующие категории пропускаются
+		_, err := tx.Exec("INSERT OR IGNORE INTO category_follows (user_id, category_id) SELECT ?, id FROM categories WHERE id = ?", userID, id)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// queryDigestCategories возвращает все категории с отметкой подписки пользователя
+func queryDigestCategories(db *sql.DB, userID int) ([]DigestCategory, error) {
+	rows, err := db.Query(`
+		SELECT c.id, c.name, f.user_id IS NOT NULL
+		FROM categories c
+		LEFT JOIN category_follows f ON f.category_id = c.id AND f.user_id = ?
+		ORDER BY c.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []DigestCategory
+	for rows.Next() {
+		var c DigestCategory
+		if err := rows.Scan(&c.ID, &c.Name, &c.Followed); err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+	return categories, rows.Err()
+}
+
+// DigestUnsubscribe отписывает от дайджеста по подписанной ссылке из письма, без входа.
+// GET показывает кнопку подтверждения (сканеры почты открывают ссылки сами),
+// POST отписывает — в том числе запрос почтового клиента по List-Unsubscribe-Post.
+func DigestUnsubscribe(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		// Параметры берутся из адреса и для POST: клиент отправляет его без изменений
+		userID, err := strconv.Atoi(r.URL.Query().Get("u"))
+		if err != nil {
+			http.Error(w, "Invalid unsubscribe link", http.StatusBadRequest)
+			return
+		}
+		sig := r.URL.Query().Get("sig")
+		key, err := appSecret(db, "digest_unsubscribe")
+		if err != nil {
+			log.Println("Error loading digest signing key:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !hmac.Equal([]byte(sig), []byte(unsubscribeSignature(key, userID))) {
+			http.Error(w, "Invalid unsubscribe link", http.StatusForbidden)
+			return
+		}
+
+		data := UnsubscribePageData{UserID: userID, Signature: sig}
+		if r.Method == http.MethodPost {
+			if _, err := db.Exec("UPDATE digest_settings SET frequency = ? WHERE user_id = ?", digestOff, userID); err != nil {
+				log.Println("Error unsubscribing from digest:", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			data.Unsubscribed = true
+		}
+
+		tmpl, err := template.ParseFiles("templates/digest_unsubscribe.html")
+		if err != nil {
+			log.Println("Error parsing digest_unsubscribe.html template:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		tmpl.Execute(w, data)
+	}
+}
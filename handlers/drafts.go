@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"database/sql"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Draft — черновик поста. Поля хранятся как введены в форме и проверяются при публикации.
+type Draft struct {
+	ID          int
+	Title       string
+	Content     string
+	CategoryIDs []int
+	Tags        string // Теги через запятую, как введены в форме
+	ImagePath   string // Загруженное изображение; при публикации переходит к посту
+	UpdatedAt   string
+	UpdatedTime time.Time
+}
+
+// DraftsPageData определяет данные, передаваемые в шаблон drafts.html
+type DraftsPageData struct {
+	CurrentUser string
+	Drafts      []Draft
+}
+
+// empty сообщает, что в черновике нечего сохранять
+func (d Draft) empty() bool {
+	return strings.TrimSpace(d.Title) == "" && strings.TrimSpace(d.Content) == "" &&
+		len(d.CategoryIDs) == 0 && strings.TrimSpace(d.Tags) == "" && d.ImagePath == ""
+}
+
+// draftColumns — столбцы черновика в порядке полей scanDraft
+const draftColumns = "id, title, content, category_ids, tags, image_path, updated_at"
+
+// scanDraft читает строку, выбранную через draftColumns
+func scanDraft(row interface{ Scan(...interface{}) error }) (Draft, error) {
+	var d Draft
+	var categoryIDs string
+	if err := row.Scan(&d.ID, &d.Title, &d.Content, &categoryIDs, &d.Tags, &d.ImagePath, &d.UpdatedTime); err != nil {
+		return Draft{}, err
+	}
+	for _, v := range strings.Split(categoryIDs, ",") {
+		if id, err := strconv.Atoi(v); err == nil {
+			d.CategoryIDs = append(d.CategoryIDs, id)
+		}
+	}
+	d.UpdatedAt = formatDate(d.UpdatedTime)
+	return d, nil
+}
+
+// loadDraft возвращает черновик пользователя или sql.ErrNoRows, если он чужой или не существует
+func loadDraft(db *sql.DB, userID, draftID int) (Draft, error) {
+	return scanDraft(db.QueryRow("SELECT "+draftColumns+" FROM drafts WHERE id = ? AND user_id = ?", draftID, userID))
+}
+
+// queryDrafts возвращает черновики пользователя, недавно изменённые первыми
+func queryDrafts(db *sql.DB, userID int) ([]Draft, error) {
+	rows, err := db.Query("SELECT "+draftColumns+" FROM drafts WHERE user_id = ? ORDER BY updated_at DESC, id DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	drafts := []Draft{}
+	for rows.Next() {
+		d, err := scanDraft(rows)
+		if err != nil {
+			return nil, err
+		}
+		drafts = append(drafts, d)
+	}
+	return drafts, rows.Err()
+}
+
+// saveDraft создаёт черновик (d.ID == 0) или обновляет существующий черновик пользователя
+func saveDraft(db *sql.DB, userID int, d *Draft) error {
+	if d.ID == 0 {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if err := insertDraft(tx, userID, d); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	res, err := db.Exec(`
+		UPDATE drafts SET title = ?, content = ?, category_ids = ?, tags = ?, image_path = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND user_id = ?`, d.Title, d.Content, draftCategoryIDs(d), d.Tags, d.ImagePath, d.ID, userID)
+	if err != nil {
+		return err
+	}
+	if count, _ := res.RowsAffected(); count == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// insertDraft создаёт новый черновик в транзакции tx и записывает его ID в d.ID.
+// Возвращает errTooManyDrafts, если у пользователя уже максимум черновиков.
+func insertDraft(tx *sql.Tx, userID int, d *Draft) error {
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM drafts WHERE user_id = ?", userID).Scan(&count); err != nil {
+		return err
+	}
+	if count >= maxDraftsPerUser {
+		return errTooManyDrafts
+	}
+	res, err := tx.Exec("INSERT INTO drafts (user_id, title, content, category_ids, tags, image_path) VALUES (?, ?, ?, ?, ?, ?)",
+		userID, d.Title, d.Content, draftCategoryIDs(d), d.Tags, d.ImagePath)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	d.ID = int(id)
+	return err
+}
+
+// draftCategoryIDs возвращает категории черновика в виде, в котором они хранятся в БД: "1,3"
+func draftCategoryIDs(d *Draft) string {
+	ids := make([]string, len(d.CategoryIDs))
+	for i, id := range d.CategoryIDs {
+		ids[i] = strconv.Itoa(id)
+	}
+	return strings.Join(ids, ",")
+}
+
+// deleteDraft удаляет черновик пользователя; изображение удаляется с диска, если оно не перешло к посту
+func deleteDraft(db *sql.DB, userID, draftID int, keepImage bool) error {
+	var imagePath string
+	err := db.QueryRow("SELECT image_path FROM drafts WHERE id = ? AND user_id = ?", draftID, userID).Scan(&imagePath)
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec("DELETE FROM drafts WHERE id = ? AND user_id = ?", draftID, userID); err != nil {
+		return err
+	}
+	if imagePath != "" && !keepImage {
+		if err := removeImage(imagePath); err != nil {
+			log.Println("Error removing draft image:", err)
+		}
+	}
+	return nil
+}
+
+// draftFromForm читает поля формы создания поста в черновик
+func draftFromForm(r *http.Request) Draft {
+	d := Draft{
+		Title:   normalizeText(r.FormValue("title")),
+		Content: normalizeText(r.FormValue("content")),
+		Tags:    strings.TrimSpace(r.FormValue("tags")),
+	}
+	d.ID, _ = strconv.Atoi(r.FormValue("draft_id"))
+	for _, v := range r.Form["categories"] {
+		if id, err := strconv.Atoi(v); err == nil && !containsInt(d.CategoryIDs, id) {
+			d.CategoryIDs = append(d.CategoryIDs, id)
+		}
+	}
+	return d
+}
+
+// SaveDraft обрабатывает POST /drafts/save — автосохранение формы создания поста.
+// Принимает те же поля, что и форма (включая изображение), и отвечает JSON.
+func SaveDraft(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			apiMethodNotAllowed(w, http.MethodPost)
+			return
+		}
+		userID, _, ok := sessionUser(db, r)
+		if !ok {
+			writeAPIError(w, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+
+		draft := draftFromForm(r)
+		if utf8.RuneCountInString(draft.Title) > maxDraftTitleLength || utf8.RuneCountInString(draft.Content) > maxDraftContentLength ||
+			utf8.RuneCountInString(draft.Tags) > maxTagsPerPost*(maxTagLength+2) {
+			writeAPIError(w, http.StatusBadRequest, errDraftTooLong.Error())
+			return
+		}
+
+		// Изображение сохранённого черновика остаётся, пока его не заменят или не уберут
+		var oldImage string
+		if draft.ID != 0 {
+			saved, err := loadDraft(db, userID, draft.ID)
+			if err == sql.ErrNoRows {
+				writeAPIError(w, http.StatusNotFound, "Draft not found")
+				return
+			}
+			if err != nil {
+				log.Println("Error loading draft:", err)
+				writeAPIError(w, http.StatusInternalServerError, "Internal Server Error")
+				return
+			}
+			oldImage = saved.ImagePath
+			if r.FormValue("remove_draft_image") != "on" {
+				draft.ImagePath = saved.ImagePath
+			}
+		}
+
+		file, header, err := r.FormFile("image")
+		if err == nil && file != nil {
+			defer file.Close()
+			ext, msg, err := validateImage(file, header)
+			if err != nil {
+				log.Println("Error reading draft image:", err)
+				writeAPIError(w, http.StatusInternalServerError, "Failed to read image")
+				return
+			}
+			if msg != "" {
+				writeAPIError(w, http.StatusBadRequest, msg)
+				return
+			}
+			if draft.ImagePath, err = storeImage(file, userID, ext); err != nil {
+				log.Println("Error saving draft image:", err)
+				writeAPIError(w, http.StatusInternalServerError, "Failed to save image")
+				return
+			}
+		}
+
+		// Пустую форму не сохраняем, чтобы не плодить пустые черновики
+		if draft.ID == 0 && draft.empty() {
+			writeJSON(w, http.StatusOK, apiDraftSaved{SavedAt: time.Now()})
+			return
+		}
+		if err := saveDraft(db, userID, &draft); err != nil {
+			if draft.ImagePath != oldImage {
+				removeImage(draft.ImagePath)
+			}
+			if err == errTooManyDrafts {
+				writeAPIError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			log.Println("Error saving draft:", err)
+			writeAPIError(w, http.StatusInternalServerError, "Failed to save draft")
+			return
+		}
+		if oldImage != "" && oldImage != draft.ImagePath {
+			if err := removeImage(oldImage); err != nil {
+				log.Println("Error removing replaced draft image:", err)
+			}
+		}
+		writeJSON(w, http.StatusOK, apiDraftSaved{ID: draft.ID, SavedAt: time.Now(), ImageURL: draft.ImagePath})
+	}
+}
+
+// Drafts выводит страницу «Мои черновики»
+func Drafts(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userID, username, ok := sessionUser(db, r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		drafts, err := queryDrafts(db, userID)
+		if err != nil {
+			log.Println("Error fetching drafts:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		tmpl, err := template.ParseFiles("templates/drafts.html")
+		if err != nil {
+			log.Println("Error parsing drafts.html template:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		tmpl.Execute(w, DraftsPageData{CurrentUser: username, Drafts: drafts})
+	}
+}
+
+// DeleteDraft удаляет черновик текущего пользователя вместе с его изображением
+func DeleteDraft(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userID, _, ok := sessionUser(db, r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		draftID, err := strconv.Atoi(r.FormValue("draft_id"))
+		if err != nil {
+			http.Error(w, "Invalid draft ID", http.StatusBadRequest)
+			return
+		}
+		err = deleteDraft(db, userID, draftID, false)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Draft not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Println("Error deleting draft:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/drafts", http.StatusSeeOther)
+	}
+}
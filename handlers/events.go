@@ -0,0 +1,392 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Типы событий, которые получают клиенты /events
+const (
+	eventPostCreated    = "post_created"
+	eventPostDeleted    = "post_deleted"
+	eventPostUpdated    = "post_updated"
+	eventCommentCreated = "comment_created"
+	eventCommentUpdated = "comment_updated"
+	eventCommentDeleted = "comment_deleted"
+	eventVote           = "vote"
+	eventNotification   = "notification" // Только получателю: новое число непрочитанных
+	eventMessage        = "message"      // Только получателю: новое число непрочитанных личных сообщений
+)
+
+const (
+	eventHistorySize  = 256              // Сколько последних событий хранится для Last-Event-ID
+	eventBufferSize   = 64               // Буфер подписчика; медленный клиент отключается и переподключается
+	heartbeatInterval = 25 * time.Second // Интервал комментария-пинга, чтобы прокси не закрывали соединение
+)
+
+// Event — событие хаба. Data сериализуется в JSON при публикации.
+type Event struct {
+	ID         string
+	Type       string
+	PostID     int
+	Categories []string // Категории поста, для фильтрации по категории
+	UserID     int      // Получатель личного события; 0 — событие видно всем
+	Data       []byte
+	seq        uint64
+}
+
+// eventHub — внутрипроцессный pub/sub. Хранит последние события, чтобы клиент,
+// переподключившийся с Last-Event-ID, получил пропущенное.
+type eventHub struct {
+	mu        sync.Mutex
+	boot      int64 // Метка запуска: ID событий прошлого процесса не совпадут с текущими
+	seq       uint64
+	history   []Event
+	subs      map[chan Event]struct{}
+	listeners []func(Event) // Вызываются при каждой публикации; не должны блокироваться
+}
+
+// events — общий хаб процесса
+var events = &eventHub{boot: time.Now().Unix(), subs: map[chan Event]struct{}{}}
+
+// publish присваивает событию ID, сохраняет его в истории и рассылает подписчикам.
+// Подписчик с переполненным буфером отключается: он переподключится и дочитает историю.
+func (h *eventHub) publish(e Event, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Println("Error encoding event:", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	e.seq = h.seq
+	e.ID = fmt.Sprintf("%d-%d", h.boot, h.seq)
+	e.Data = payload
+
+	h.history = append(h.history, e)
+	if len(h.history) > eventHistorySize {
+		h.history = h.history[len(h.history)-eventHistorySize:]
+	}
+	for ch := range h.subs {
+		select {
+		case ch <- e:
+		default:
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+	for _, fn := range h.listeners {
+		fn(e)
+	}
+}
+
+// listen добавляет функцию, которая получает все события сразу при публикации
+func (h *eventHub) listen(fn func(Event)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.listeners = append(h.listeners, fn)
+}
+
+// subscribe регистрирует подписчика. Если передан lastID, возвращает события после него;
+// resync = true, если пропущенные события уже не восстановить и клиенту нужно перезагрузить данные.
+func (h *eventHub) subscribe(lastID string) (ch chan Event, missed []Event, resync bool) {
+	ch = make(chan Event, eventBufferSize)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subs[ch] = struct{}{}
+
+	if lastID == "" {
+		return ch, nil, false
+	}
+	boot, seqStr, _ := strings.Cut(lastID, "-")
+	seq, err := strconv.ParseUint(seqStr, 10, 64)
+	if err != nil || boot != strconv.FormatInt(h.boot, 10) || seq > h.seq {
+		return ch, nil, true
+	}
+	if len(h.history) > 0 && h.history[0].seq > seq+1 {
+		resync = true
+	}
+	for _, e := range h.history {
+		if e.seq > seq {
+			missed = append(missed, e)
+		}
+	}
+	return ch, missed, resync
+}
+
+// unsubscribe удаляет подписчика, если хаб ещё не отключил его сам
+func (h *eventHub) unsubscribe(ch chan Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[ch]; ok {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
+
+// eventFilter — условия подписки из параметров /events
+type eventFilter struct {
+	PostID     int
+	Categories []string // Имена выбранной категории и её подкатегорий
+	UserID     int      // Текущий пользователь: получает свои личные события
+}
+
+// matches сообщает, нужно ли отправлять событие подписчику
+func (f eventFilter) matches(e Event) bool {
+	if e.UserID != 0 {
+		return e.UserID == f.UserID
+	}
+	if f.PostID != 0 && e.PostID != f.PostID {
+		return false
+	}
+	if len(f.Categories) > 0 && !containsAnyString(e.Categories, f.Categories) {
+		return false
+	}
+	return true
+}
+
+// Events отдаёт поток Server-Sent Events: /events?post=ID&category=slug.
+// Без параметров — все публичные события; авторизованный пользователь
+// также получает свои уведомления.
+func Events(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		var filter eventFilter
+		if v := r.URL.Query().Get("post"); v != "" {
+			id, err := strconv.Atoi(v)
+			if err != nil || id < 1 {
+				http.Error(w, "Invalid post ID", http.StatusBadRequest)
+				return
+			}
+			filter.PostID = id
+		}
+		// События несут имена категорий, поэтому slug из адреса переводим в имена категории и её подкатегорий
+		if v := r.URL.Query().Get("category"); v != "" {
+			filter.Categories = []string{v}
+			if cat, err := lookupCategory(db, v); err == nil {
+				if names, err := categoryFamilyNames(db, cat.ID); err == nil {
+					filter.Categories = names
+				}
+			}
+		}
+		filter.UserID, _, _ = sessionUser(db, r)
+
+		// EventSource передаёт ID последнего события в заголовке при переподключении
+		lastID := r.Header.Get("Last-Event-ID")
+		if lastID == "" {
+			lastID = r.URL.Query().Get("last_event_id")
+		}
+		ch, missed, resync := events.subscribe(lastID)
+		defer events.unsubscribe(ch)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		fmt.Fprint(w, "retry: 3000\n\n")
+		if resync {
+			fmt.Fprint(w, "event: resync\ndata: {}\n\n")
+		}
+		for _, e := range missed {
+			if filter.matches(e) {
+				writeEvent(w, e)
+			}
+		}
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case e, ok := <-ch:
+				if !ok {
+					// Клиент не успевал читать: закрываем поток, EventSource переподключится
+					return
+				}
+				if !filter.matches(e) {
+					continue
+				}
+				writeEvent(w, e)
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": ping\n\n")
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writeEvent записывает событие в формате text/event-stream
+func writeEvent(w http.ResponseWriter, e Event) {
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Type, e.Data)
+}
+
+// postCategoryNames возвращает имена категорий поста для фильтрации событий
+func postCategoryNames(db *sql.DB, postID int) []string {
+	categories, err := queryPostCategories(db, postID)
+	if err != nil {
+		log.Println("Error querying post categories for event:", err)
+	}
+	names := []string{}
+	for _, c := range categories {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// publishPostCreated сообщает о новом посте подписчикам и webhook
+func publishPostCreated(db *sql.DB, postID int) {
+	post, err := queryPost(db, postID, 0)
+	if err != nil {
+		log.Println("Error loading post for event:", err)
+		return
+	}
+	categories := postCategoryNames(db, postID)
+	events.publish(Event{Type: eventPostCreated, PostID: postID, Categories: categories}, map[string]interface{}{
+		"post_id":    postID,
+		"title":      post.Title,
+		"author":     post.Author,
+		"categories": categories,
+	})
+	enqueueWebhooks(db, hookPostCreated, categories, map[string]interface{}{
+		"post_id":    postID,
+		"title":      post.Title,
+		"content":    post.Content,
+		"author":     post.Author,
+		"categories": categories,
+		"created_at": post.CreatedTime.UTC(),
+	})
+}
+
+// publishPostUpdated сообщает об изменении поста
+func publishPostUpdated(db *sql.DB, postID int) {
+	post, err := queryPost(db, postID, 0)
+	if err != nil {
+		log.Println("Error loading post for event:", err)
+		return
+	}
+	categories := postCategoryNames(db, postID)
+	events.publish(Event{Type: eventPostUpdated, PostID: postID, Categories: categories}, map[string]interface{}{
+		"post_id":      postID,
+		"title":        post.Title,
+		"content":      post.Content,
+		"content_html": renderMarkdown(post.Content, mentionChecker(db)),
+		"categories":   categories,
+	})
+}
+
+// publishPostDeleted сообщает об удалении поста подписчикам и webhook. Категории нужно получить до удаления.
+func publishPostDeleted(db *sql.DB, postID int, categories []string) {
+	events.publish(Event{Type: eventPostDeleted, PostID: postID, Categories: categories}, map[string]interface{}{
+		"post_id": postID,
+	})
+	enqueueWebhooks(db, hookPostDeleted, categories, map[string]interface{}{
+		"post_id":    postID,
+		"categories": categories,
+	})
+}
+
+// publishCommentCreated сообщает о новом комментарии подписчикам и webhook
+func publishCommentCreated(db *sql.DB, commentID int) {
+	c, err := queryComment(db, commentID, 0)
+	if err != nil {
+		log.Println("Error loading comment for event:", err)
+		return
+	}
+	categories := postCategoryNames(db, c.PostID)
+	events.publish(Event{Type: eventCommentCreated, PostID: c.PostID, Categories: categories}, map[string]interface{}{
+		"post_id":      c.PostID,
+		"comment_id":   c.ID,
+		"author":       c.Author,
+		"content":      c.Content,
+		"content_html": renderMarkdown(c.Content, mentionChecker(db)),
+		"created_at":   c.CreatedAt,
+	})
+	enqueueWebhooks(db, hookCommentCreated, categories, map[string]interface{}{
+		"post_id":    c.PostID,
+		"comment_id": c.ID,
+		"author":     c.Author,
+		"content":    c.Content,
+		"categories": categories,
+		"created_at": c.CreatedTime.UTC(),
+	})
+}
+
+// publishCommentUpdated сообщает об изменении текста комментария
+func publishCommentUpdated(db *sql.DB, commentID int) {
+	c, err := queryComment(db, commentID, 0)
+	if err != nil {
+		log.Println("Error loading comment for event:", err)
+		return
+	}
+	events.publish(Event{Type: eventCommentUpdated, PostID: c.PostID, Categories: postCategoryNames(db, c.PostID)}, map[string]interface{}{
+		"post_id":      c.PostID,
+		"comment_id":   c.ID,
+		"content":      c.Content,
+		"content_html": renderMarkdown(c.Content, mentionChecker(db)),
+	})
+}
+
+// publishCommentDeleted сообщает об удалении комментария
+func publishCommentDeleted(db *sql.DB, postID, commentID int) {
+	events.publish(Event{Type: eventCommentDeleted, PostID: postID, Categories: postCategoryNames(db, postID)}, map[string]interface{}{
+		"post_id":    postID,
+		"comment_id": commentID,
+	})
+}
+
+// publishVote сообщает новые счётчики голосов поста или комментария (commentID != 0)
+func publishVote(db *sql.DB, postID, commentID int) {
+	data := map[string]interface{}{"post_id": postID, "comment_id": commentID}
+	if commentID == 0 {
+		post, err := queryPost(db, postID, 0)
+		if err != nil {
+			log.Println("Error loading post for vote event:", err)
+			return
+		}
+		data["likes"], data["dislikes"] = post.Likes, post.Dislikes
+	} else {
+		c, err := queryComment(db, commentID, 0)
+		if err != nil {
+			log.Println("Error loading comment for vote event:", err)
+			return
+		}
+		postID = c.PostID
+		data["post_id"], data["likes"], data["dislikes"] = c.PostID, c.Likes, c.Dislikes
+	}
+	events.publish(Event{Type: eventVote, PostID: postID, Categories: postCategoryNames(db, postID)}, data)
+}
+
+// publishNotification сообщает пользователю новое число непрочитанных уведомлений
+func publishNotification(db *sql.DB, userID int) {
+	events.publish(Event{Type: eventNotification, UserID: userID}, map[string]interface{}{
+		"unread": unreadNotifications(db, userID),
+	})
+}
+
+// publishMessage сообщает пользователю новое число непрочитанных личных сообщений
+func publishMessage(db *sql.DB, userID int) {
+	events.publish(Event{Type: eventMessage, UserID: userID}, map[string]interface{}{
+		"unread": unreadMessages(db, userID),
+	})
+}
@@ -0,0 +1,397 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/xml"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Количество записей в ленте
+const feedSize = 20
+
+// feed — лента в независимом от формата виде; из неё строятся RSS 2.0 и Atom
+type feed struct {
+	Title       string
+	Description string
+	Link        string // Страница сайта, которой соответствует лента
+	Self        string // Адрес самой ленты (без параметра format)
+	Updated     time.Time
+	Entries     []feedEntry
+}
+
+// feedEntry — запись ленты: пост или комментарий
+type feedEntry struct {
+	ID         string // Постоянный идентификатор (tag URI)
+	Title      string
+	Link       string
+	Author     string
+	HTML       string // Содержимое, уже экранированное для HTML
+	Categories []string
+	Published  time.Time
+	Updated    time.Time
+}
+
+// RSS 2.0
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	DCNS    string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	AtomLink      rssLink   `xml:"atom:link"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	Creator     string   `xml:"dc:creator"`
+	Categories  []string `xml:"category"`
+	PubDate     string   `xml:"pubDate"`
+	Description string   `xml:"description"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+// Atom
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Link       atomLink       `xml:"link"`
+	Author     atomPerson     `xml:"author"`
+	Categories []atomCategory `xml:"category"`
+	Content    atomContent    `xml:"content"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// Feed отдаёт ленту последних постов форума: /feed.xml
+func Feed(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		base := baseURL(r)
+		posts, err := queryPosts(db, postQuery{Limit: feedSize})
+		if err != nil {
+			log.Println("Error querying posts for feed:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		serveFeed(w, r, postsFeed(base, posts, feed{
+			Title:       "Forum",
+			Description: "Latest posts",
+			Link:        base + "/posts",
+			Self:        base + "/feed.xml",
+		}))
+	}
+}
+
+// CategoryFeed отдаёт ленту постов категории: /category/{slug}/feed.xml
+func CategoryFeed(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cat, err := lookupCategory(db, r.PathValue("name"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		base := baseURL(r)
+		posts, err := queryPosts(db, postQuery{Category: cat.Slug, Limit: feedSize})
+		if err != nil {
+			log.Println("Error querying category feed:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		serveFeed(w, r, postsFeed(base, posts, feed{
+			Title:       "Forum: " + cat.Name,
+			Description: "Latest posts in " + cat.Name,
+			Link:        base + "/posts?category=" + url.QueryEscape(cat.Slug),
+			Self:        base + "/category/" + url.PathEscape(cat.Slug) + "/feed.xml",
+		}))
+	}
+}
+
+// UserFeed отдаёт ленту постов пользователя: /user/{name}/feed.xml
+func UserFeed(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		var exists bool
+		if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE username = ?)", name).Scan(&exists); err != nil || !exists {
+			http.NotFound(w, r)
+			return
+		}
+
+		base := baseURL(r)
+		posts, err := queryPosts(db, postQuery{Author: name, Limit: feedSize})
+		if err != nil {
+			log.Println("Error querying user feed:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		serveFeed(w, r, postsFeed(base, posts, feed{
+			Title:       "Forum: posts by " + name,
+			Description: "Latest posts by " + name,
+			Link:        base + "/posts",
+			Self:        base + "/user/" + url.PathEscape(name) + "/feed.xml",
+		}))
+	}
+}
+
+// PostCommentsFeed отдаёт ленту комментариев поста: /post/{id}/feed.xml
+func PostCommentsFeed(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		postID, ok := pathID(r, "id")
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		post, err := queryPost(db, postID, 0)
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Println("Error querying post for comments feed:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		base := baseURL(r)
+		f := feed{
+			Title:       "Comments on \"" + post.Title + "\"",
+			Description: "Latest comments on \"" + post.Title + "\" by " + post.Author,
+			Link:        postURL(base, post.ID),
+			Self:        base + "/post/" + strconv.Itoa(post.ID) + "/feed.xml",
+			Updated:     lastModified(post.CreatedTime, post.UpdatedTime),
+		}
+		// Самые новые комментарии — первыми
+		for i := len(post.Comments) - 1; i >= 0 && len(f.Entries) < feedSize; i-- {
+			c := post.Comments[i]
+			entry := feedEntry{
+				ID:        tagURI(base, c.CreatedTime, "comment", c.ID),
+				Title:     "Comment by " + c.Author,
+				Link:      base + "/posts#comment-" + strconv.Itoa(c.ID),
+				Author:    c.Author,
+				HTML:      renderMarkdown(c.Content, nil),
+				Published: c.CreatedTime,
+				Updated:   lastModified(c.CreatedTime, c.UpdatedTime),
+			}
+			if entry.Updated.After(f.Updated) {
+				f.Updated = entry.Updated
+			}
+			f.Entries = append(f.Entries, entry)
+		}
+		serveFeed(w, r, f)
+	}
+}
+
+// postsFeed заполняет ленту записями о постах; дата обновления ленты — самая поздняя из записей
+func postsFeed(base string, posts []Post, f feed) feed {
+	for _, p := range posts {
+		var content strings.Builder
+		if p.ImagePath != "" {
+			content.WriteString(`<p><img src="` + html.EscapeString(base+p.ImagePath) + `" alt=""></p>`)
+		}
+		content.WriteString(renderMarkdown(p.Content, nil))
+
+		entry := feedEntry{
+			ID:        tagURI(base, p.CreatedTime, "post", p.ID),
+			Title:     p.Title,
+			Link:      postURL(base, p.ID),
+			Author:    p.Author,
+			HTML:      content.String(),
+			Published: p.CreatedTime,
+			Updated:   lastModified(p.CreatedTime, p.UpdatedTime),
+		}
+		for _, c := range p.Categories {
+			entry.Categories = append(entry.Categories, c.Name)
+		}
+		if entry.Updated.After(f.Updated) {
+			f.Updated = entry.Updated
+		}
+		f.Entries = append(f.Entries, entry)
+	}
+	return f
+}
+
+// serveFeed кодирует ленту в RSS 2.0 (по умолчанию) или Atom (?format=atom)
+// и отдаёт её с ETag и Last-Modified; условные запросы получают 304
+func serveFeed(w http.ResponseWriter, r *http.Request, f feed) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if f.Updated.IsZero() {
+		// Пустая лента: фиксированная дата, чтобы ответ не менялся между запросами
+		f.Updated = time.Unix(0, 0)
+	}
+	f.Updated = f.Updated.UTC().Truncate(time.Second)
+
+	var doc interface{}
+	var contentType string
+	switch r.URL.Query().Get("format") {
+	case "", "rss":
+		doc, contentType = toRSS(f), "application/rss+xml; charset=utf-8"
+	case "atom":
+		doc, contentType = toAtom(f), "application/atom+xml; charset=utf-8"
+	default:
+		http.Error(w, "Unknown feed format", http.StatusBadRequest)
+		return
+	}
+
+	body, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		log.Println("Error encoding feed:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	body = append([]byte(xml.Header), body...)
+
+	sum := sha256.Sum256(body)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, "", f.Updated, bytes.NewReader(body))
+}
+
+// toRSS преобразует ленту в документ RSS 2.0
+func toRSS(f feed) rssFeed {
+	out := rssFeed{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		DCNS:    "http://purl.org/dc/elements/1.1/",
+		Channel: rssChannel{
+			Title:         f.Title,
+			Link:          f.Link,
+			Description:   f.Description,
+			AtomLink:      rssLink{Href: f.Self, Rel: "self", Type: "application/rss+xml"},
+			LastBuildDate: f.Updated.Format(time.RFC1123Z),
+		},
+	}
+	for _, e := range f.Entries {
+		out.Channel.Items = append(out.Channel.Items, rssItem{
+			Title:       e.Title,
+			Link:        e.Link,
+			GUID:        rssGUID{Value: e.ID},
+			Creator:     e.Author,
+			Categories:  e.Categories,
+			PubDate:     e.Published.UTC().Format(time.RFC1123Z),
+			Description: e.HTML,
+		})
+	}
+	return out
+}
+
+// toAtom преобразует ленту в документ Atom
+func toAtom(f feed) atomFeed {
+	out := atomFeed{
+		Title:   f.Title,
+		ID:      f.Self,
+		Updated: f.Updated.Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: f.Self + "?format=atom", Rel: "self", Type: "application/atom+xml"},
+			{Href: f.Link, Rel: "alternate", Type: "text/html"},
+		},
+	}
+	for _, e := range f.Entries {
+		entry := atomEntry{
+			Title:     e.Title,
+			ID:        e.ID,
+			Published: e.Published.UTC().Format(time.RFC3339),
+			Updated:   e.Updated.UTC().Format(time.RFC3339),
+			Link:      atomLink{Href: e.Link, Rel: "alternate", Type: "text/html"},
+			Author:    atomPerson{Name: e.Author},
+			Content:   atomContent{Type: "html", Value: e.HTML},
+		}
+		for _, c := range e.Categories {
+			entry.Categories = append(entry.Categories, atomCategory{Term: c})
+		}
+		out.Entries = append(out.Entries, entry)
+	}
+	return out
+}
+
+// baseURL возвращает адрес сайта (схема и хост) для абсолютных ссылок в лентах
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// postURL возвращает ссылку на пост в общей ленте
+func postURL(base string, postID int) string {
+	return base + "/posts#post-" + strconv.Itoa(postID)
+}
+
+// tagURI строит постоянный идентификатор записи (RFC 4151),
+// который не меняется при редактировании: tag:host,2025-01-02:post-5
+func tagURI(base string, created time.Time, kind string, id int) string {
+	host := strings.TrimPrefix(strings.TrimPrefix(base, "https://"), "http://")
+	if i := strings.LastIndex(host, ":"); i != -1 && !strings.Contains(host[i:], "]") {
+		host = host[:i] // без порта
+	}
+	return "tag:" + host + "," + created.UTC().Format("2006-01-02") + ":" + kind + "-" + strconv.Itoa(id)
+}
+
+// lastModified возвращает дату изменения записи: updated, если запись изменялась, иначе created
+func lastModified(created, updated time.Time) time.Time {
+	if updated.After(created) {
+		return updated
+	}
+	return created
+}
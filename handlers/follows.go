@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+// isFollowing сообщает, подписан ли пользователь на автора
+func isFollowing(db *sql.DB, followerID, followedID int) bool {
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM follows WHERE follower_id = ? AND followed_id = ?)", followerID, followedID).Scan(&exists)
+	if err != nil {
+		log.Println("Error checking follow:", err)
+	}
+	return exists
+}
+
+// isFollowingCategory сообщает, подписан ли пользователь на категорию
+func isFollowingCategory(db *sql.DB, userID, categoryID int) bool {
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM category_follows WHERE user_id = ? AND category_id = ?)", userID, categoryID).Scan(&exists)
+	if err != nil {
+		log.Println("Error checking category follow:", err)
+	}
+	return exists
+}
+
+// followCounts возвращает число подписчиков пользователя и число его подписок
+func followCounts(db *sql.DB, userID int) (followers, following int, err error) {
+	err = db.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM follows WHERE followed_id = ?),
+			(SELECT COUNT(*) FROM follows WHERE follower_id = ?)`, userID, userID).Scan(&followers, &following)
+	return followers, following, err
+}
+
+// FollowUser подписывает на автора или отписывает от него: POST /user/{name}/follow.
+// Поле action=unfollow снимает подписку, иначе подписка добавляется.
+func FollowUser(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userID, _, ok := sessionUser(db, r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		name := r.PathValue("name")
+		var followedID int
+		err := db.QueryRow("SELECT id FROM users WHERE username = ?", name).Scan(&followedID)
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Println("Error looking up user to follow:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if followedID == userID {
+			http.Error(w, "You cannot follow yourself", http.StatusBadRequest)
+			return
+		}
+
+		if r.FormValue("action") == "unfollow" {
+			_, err = db.Exec("DELETE FROM follows WHERE follower_id = ? AND followed_id = ?", userID, followedID)
+		} else {
+			_, err = db.Exec("INSERT OR IGNORE INTO follows (follower_id, followed_id) VALUES (?, ?)", userID, followedID)
+		}
+		if err != nil {
+			log.Println("Error saving follow:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/user/"+url.PathEscape(name), http.StatusSeeOther)
+	}
+}
+
+// FollowCategory подписывает на категорию или отписывает от неё: POST /category/{slug}/follow
+// (старые ссылки с именем категории тоже работают).
+// Подписки на категории общие с настройками дайджеста.
+func FollowCategory(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userID, _, ok := sessionUser(db, r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		cat, err := lookupCategory(db, r.PathValue("name"))
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Println("Error looking up category to follow:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if r.FormValue("action") == "unfollow" {
+			_, err = db.Exec("DELETE FROM category_follows WHERE user_id = ? AND category_id = ?", userID, cat.ID)
+		} else {
+			_, err = db.Exec("INSERT OR IGNORE INTO category_follows (user_id, category_id) VALUES (?, ?)", userID, cat.ID)
+		}
+		if err != nil {
+			log.Println("Error saving category follow:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/posts?category="+url.QueryEscape(cat.Slug), http.StatusSeeOther)
+	}
+}
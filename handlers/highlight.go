@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Подсветка синтаксиса в блоках кода Markdown. Простой лексер без разбора грамматики:
+// комментарии, строки, числа, ключевые слова и встроенные типы. Для каждого фрагмента
+// выводится <span class="hl-…">, текст экранируется так же, как в остальном рендере.
+
+// codeLanguage описывает лексику языка для подсветки
+type codeLanguage struct {
+	keywords     map[string]bool
+	builtins     map[string]bool // Встроенные типы, функции и константы
+	lineComments []string
+	blockComment [2]string
+	quotes       string // Символы, открывающие строку
+	rawQuote     byte   // Строка без экранирования, может занимать несколько строк (` в Go)
+	tripleQuotes bool   // Строки в тройных кавычках (Python)
+	ignoreCase   bool   // Ключевые слова без учёта регистра (SQL)
+}
+
+func wordSet(s string) map[string]bool {
+	m := map[string]bool{}
+	for _, w := range strings.Fields(s) {
+		m[w] = true
+	}
+	return m
+}
+
+var (
+	langGo = &codeLanguage{
+		keywords: wordSet(`break case chan const continue default defer else fallthrough for func go goto
+			if import interface map package range return select struct switch type var`),
+		builtins: wordSet(`bool byte complex64 complex128 error float32 float64 int int8 int16 int32 int64
+			rune string uint uint8 uint16 uint32 uint64 uintptr any comparable true false nil iota
+			append cap clear close complex copy delete imag len make max min new panic print println real recover`),
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"'`",
+		rawQuote:     '`',
+	}
+	langJS = &codeLanguage{
+		keywords: wordSet(`async await break case catch class const continue debugger default delete do else
+			export extends finally for from function if import in instanceof let new of return static super
+			switch this throw try typeof var void while with yield interface type enum implements readonly`),
+		builtins: wordSet(`true false null undefined NaN Infinity Array Object String Number Boolean Promise
+			Map Set JSON Math console document window string number boolean any unknown never`),
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"'`",
+		rawQuote:     '`',
+	}
+	langPython = &codeLanguage{
+		keywords: wordSet(`and as assert async await break class continue def del elif else except finally
+			for from global if import in is lambda nonlocal not or pass raise return try while with yield`),
+		builtins: wordSet(`True False None self int str float bool list dict set tuple bytes len range print
+			open isinstance enumerate zip map filter sorted super`),
+		lineComments: []string{"#"},
+		quotes:       "\"'",
+		tripleQuotes: true,
+	}
+	langShell = &codeLanguage{
+		keywords: wordSet(`if then else elif fi for while until do done case esac in function return
+			local export readonly break continue`),
+		builtins: wordSet(`echo cd pwd ls cat grep sed awk set unset source exit test read printf
+			go git docker make curl sudo`),
+		lineComments: []string{"#"},
+		quotes:       "\"'",
+	}
+	langSQL = &codeLanguage{
+		keywords: wordSet(`select from where insert into values update set delete create table index drop
+			alter add column primary key foreign references unique not null default and or in is like
+			join left right inner outer on as group by order having limit offset distinct union all
+			exists case when then else end begin commit rollback transaction if asc desc`),
+		builtins: wordSet(`integer int text real blob boolean datetime varchar count sum avg min max
+			coalesce current_timestamp true false`),
+		lineComments: []string{"--"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "'\"",
+		ignoreCase:   true,
+	}
+	langJSON = &codeLanguage{
+		builtins: wordSet(`true false null`),
+		quotes:   "\"",
+	}
+	langC = &codeLanguage{
+		keywords: wordSet(`auto break case const continue default do else enum extern for goto if inline
+			register return sizeof static struct switch typedef union volatile while class namespace
+			public private protected template typename using virtual new delete try catch throw
+			#include #define #ifdef #ifndef #endif`),
+		builtins: wordSet(`void char short int long float double signed unsigned bool size_t true false
+			NULL nullptr std string vector printf`),
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"'",
+	}
+	langJava = &codeLanguage{
+		keywords: wordSet(`abstract break case catch class continue default do else extends final finally
+			for if implements import instanceof interface new package private protected public return
+			static super switch this throw throws try var void while record`),
+		builtins: wordSet(`boolean byte char double float int long short String Object Integer List Map
+			System true false null`),
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"'",
+	}
+	langRust = &codeLanguage{
+		keywords: wordSet(`as async await break const continue crate dyn else enum extern fn for if impl in
+			let loop match mod move mut pub ref return self Self static struct super trait type unsafe
+			use where while`),
+		builtins: wordSet(`bool char f32 f64 i8 i16 i32 i64 i128 isize str u8 u16 u32 u64 u128 usize
+			String Vec Option Result Some None Ok Err Box true false println`),
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"",
+	}
+)
+
+// codeLanguages сопоставляет названия из ```lang с описаниями языков
+var codeLanguages = map[string]*codeLanguage{
+	"go": langGo, "golang": langGo,
+	"js": langJS, "javascript": langJS, "ts": langJS, "typescript": langJS,
+	"py": langPython, "python": langPython,
+	"sh": langShell, "bash": langShell, "shell": langShell, "zsh": langShell,
+	"sql": langSQL, "sqlite": langSQL,
+	"json": langJSON,
+	"c":    langC, "cpp": langC, "c++": langC, "h": langC,
+	"java": langJava, "kotlin": langJava,
+	"rust": langRust, "rs": langRust,
+}
+
+// highlightCode возвращает экранированный код с разметкой подсветки.
+// Для неизвестного языка код только экранируется.
+func highlightCode(lang, code string) string {
+	l := codeLanguages[lang]
+	if l == nil {
+		return html.EscapeString(code)
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(code); {
+		if n := l.comment(code[i:]); n > 0 {
+			writeToken(&sb, "hl-comment", code[i:i+n])
+			i += n
+			continue
+		}
+		c := code[i]
+		if strings.IndexByte(l.quotes, c) >= 0 {
+			n := l.str(code[i:])
+			writeToken(&sb, "hl-string", code[i:i+n])
+			i += n
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(code[i:])
+		prevWord := i > 0 && isIdentRune(lastRune(code[:i]))
+		if unicode.IsDigit(r) && !prevWord {
+			n := size
+			for n < len(code[i:]) && strings.IndexByte("0123456789abcdefABCDEFxXoO_.", code[i+n]) >= 0 {
+				n++
+			}
+			writeToken(&sb, "hl-number", code[i:i+n])
+			i += n
+			continue
+		}
+		if isIdentRune(r) || (c == '#' && l == langC) {
+			n := size
+			for n < len(code[i:]) {
+				r, s := utf8.DecodeRuneInString(code[i+n:])
+				if !isIdentRune(r) {
+					break
+				}
+				n += s
+			}
+			word := code[i : i+n]
+			key := word
+			if l.ignoreCase {
+				key = strings.ToLower(word)
+			}
+			switch {
+			case l.keywords[key]:
+				writeToken(&sb, "hl-keyword", word)
+			case l.builtins[key]:
+				writeToken(&sb, "hl-builtin", word)
+			default:
+				sb.WriteString(html.EscapeString(word))
+			}
+			i += n
+			continue
+		}
+		sb.WriteString(html.EscapeString(code[i : i+size]))
+		i += size
+	}
+	return sb.String()
+}
+
+// comment возвращает длину комментария в начале s или 0.
+// Незакрытый блочный комментарий продолжается до конца кода.
+func (l *codeLanguage) comment(s string) int {
+	for _, p := range l.lineComments {
+		if strings.HasPrefix(s, p) {
+			if end := strings.IndexByte(s, '\n'); end >= 0 {
+				return end
+			}
+			return len(s)
+		}
+	}
+	if open := l.blockComment[0]; open != "" && strings.HasPrefix(s, open) {
+		if end := strings.Index(s[len(open):], l.blockComment[1]); end >= 0 {
+			return len(open) + end + len(l.blockComment[1])
+		}
+		return len(s)
+	}
+	return 0
+}
+
+// str возвращает длину строкового литерала в начале s.
+// Обычная строка заканчивается закрывающей кавычкой или концом строки кода.
+func (l *codeLanguage) str(s string) int {
+	q := s[0]
+	if l.tripleQuotes && strings.HasPrefix(s, strings.Repeat(string(q), 3)) {
+		if end := strings.Index(s[3:], s[:3]); end >= 0 {
+			return 3 + end + 3
+		}
+		return len(s)
+	}
+	raw := l.rawQuote != 0 && q == l.rawQuote
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && !raw:
+			i++
+		case s[i] == q:
+			return i + 1
+		case s[i] == '\n' && !raw:
+			return i
+		}
+	}
+	return len(s)
+}
+
+func writeToken(sb *strings.Builder, class, text string) {
+	sb.WriteString(`<span class="` + class + `">` + html.EscapeString(text) + `</span>`)
+}
+
+func isIdentRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
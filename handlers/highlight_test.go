@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var highlightSpanPattern = regexp.MustCompile(`<span class="(hl-[a-z]+)">([^<]*)</span>`)
+
+// highlightTokens возвращает подсвеченные фрагменты в виде «класс:текст»
+func highlightTokens(out string) []string {
+	var tokens []string
+	for _, m := range highlightSpanPattern.FindAllStringSubmatch(out, -1) {
+		tokens = append(tokens, strings.TrimPrefix(m[1], "hl-")+":"+html.UnescapeString(m[2]))
+	}
+	return tokens
+}
+
+func TestHighlightTokens(t *testing.T) {
+	tests := []struct {
+		lang, code string
+		want       []string
+	}{
+		{"go", "func f(s string) int { return len(s) + 0x1F } // done",
+			[]string{"keyword:func", "builtin:string", "builtin:int", "keyword:return", "builtin:len", "number:0x1F", "comment:// done"}},
+		{"go", "x := `raw\n\"q\"` + \"a\\\"b\" + 'c'",
+			[]string{"string:`raw\n\"q\"`", `string:"a\"b"`, "string:'c'"}},
+		{"go", "/* block\ncomment */ var x2 = 3.5",
+			[]string{"comment:/* block\ncomment */", "keyword:var", "number:3.5"}},
+		{"golang", "package main", []string{"keyword:package"}},
+		{"js", `const el = document.getElementById("a<b>"); // <script>`,
+			[]string{"keyword:const", "builtin:document", `string:"a<b>"`, "comment:// <script>"}},
+		{"javascript", "async function f() { return await x ?? null; }",
+			[]string{"keyword:async", "keyword:function", "keyword:return", "keyword:await", "builtin:null"}},
+		{"sh", "if [ -f \"$HOME/.rc\" ]; then echo 'ok' # note\nfi",
+			[]string{"keyword:if", `string:"$HOME/.rc"`, "keyword:then", "builtin:echo", "string:'ok'", "comment:# note", "keyword:fi"}},
+		{"bash", "for f in *.txt; do go vet $f; done",
+			[]string{"keyword:for", "keyword:in", "keyword:do", "builtin:go", "keyword:done"}},
+	}
+	for _, tc := range tests {
+		got := highlightTokens(highlightCode(tc.lang, tc.code))
+		if strings.Join(got, "|") != strings.Join(tc.want, "|") {
+			t.Errorf("%s %q:\nexpected %q\n     got %q", tc.lang, tc.code, tc.want, got)
+		}
+	}
+}
+
+// Незакрытые строки и комментарии подсвечиваются до конца строки или кода,
+// но вывод остаётся экранированным и теги сбалансированы
+func TestHighlightUnterminated(t *testing.T) {
+	tests := []struct {
+		lang, code string
+		want       []string
+	}{
+		{"go", "s := \"unterminated <b>\nnext := 1", []string{`string:"unterminated <b>`, "number:1"}},
+		{"go", "/* open <i> comment", []string{"comment:/* open <i> comment"}},
+		{"js", "let s = `multi\nline <x>", []string{"keyword:let", "string:`multi\nline <x>"}},
+		{"sh", `echo "a & b`, []string{"builtin:echo", `string:"a & b`}},
+		{"sh", "echo 'it''s", []string{"builtin:echo", "string:'it'", "string:'s"}},
+	}
+	for _, tc := range tests {
+		out := highlightCode(tc.lang, tc.code)
+		if got := highlightTokens(out); strings.Join(got, "|") != strings.Join(tc.want, "|") {
+			t.Errorf("%s %q:\nexpected %q\n     got %q", tc.lang, tc.code, tc.want, got)
+		}
+		if err := checkMarkdownTags(out); err != nil {
+			t.Errorf("%s %q: %v in %s", tc.lang, tc.code, err, out)
+		}
+		// Без разметки подсветки остаётся исходный код, экранированный целиком
+		if text := highlightSpanPattern.ReplaceAllString(out, "$2"); text != html.EscapeString(tc.code) {
+			t.Errorf("%s %q: expected escaped code %q, got %q", tc.lang, tc.code, html.EscapeString(tc.code), text)
+		}
+	}
+}
+
+func TestHighlightUnknownLanguage(t *testing.T) {
+	code := "DISPLAY \"<hi>\" & 'x' // func"
+	for _, lang := range []string{"", "cobol", "GO"} {
+		if got, want := highlightCode(lang, code), html.EscapeString(code); got != want {
+			t.Errorf("language %q: expected %q, got %q", lang, want, got)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Максимальный размер загружаемого изображения (5MB)
+const maxImageSize = 5 * 1024 * 1024
+
+// Каталог для загруженных изображений и соответствующий ему URL-префикс
+const (
+	uploadsDir       = "static/uploads"
+	uploadsURLPrefix = "/static/uploads/"
+)
+
+// validateImage проверяет размер, расширение и MIME-тип загруженного файла.
+// Возвращает расширение файла или сообщение об ошибке для пользователя.
+// Ненулевая ошибка означает, что файл не удалось прочитать.
+func validateImage(file multipart.File, header *multipart.FileHeader) (ext string, msg string, err error) {
+	// Проверяем размер файла
+	if header.Size > maxImageSize {
+		return "", "Image file is too large. Maximum size is 5MB.", nil
+	}
+
+	// Проверяем тип файла по расширению
+	ext = strings.ToLower(filepath.Ext(header.Filename))
+	if ext != ".jpg" && ext != ".jpeg" && ext != ".png" && ext != ".gif" {
+		return "", "Invalid file type. Only JPG, PNG, and GIF are allowed.", nil
+	}
+
+	// Проверяем MIME-type по первым байтам файла
+	buf := make([]byte, 512)
+	n, err := file.Read(buf)
+	if err != nil && err != io.EOF {
+		return "", "", err
+	}
+	filetype := http.DetectContentType(buf[:n])
+	if filetype != "image/jpeg" && filetype != "image/png" && filetype != "image/gif" {
+		return "", "Invalid image type. Only JPG, PNG, and GIF are allowed.", nil
+	}
+
+	// Сбросить указатель файла для последующего копирования
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", "", err
+	}
+	return ext, "", nil
+}
+
+// storeImage сохраняет изображение в каталог загрузок и возвращает его URL.
+// Файл сначала пишется во временный файл и только потом переименовывается,
+// поэтому по итоговому пути никогда не окажется частично записанный файл.
+func storeImage(file multipart.File, userID int, ext string) (string, error) {
+	tmp, err := os.CreateTemp(uploadsDir, ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	tmpName := tmp.Name()
+
+	if _, err := io.Copy(tmp, file); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return "", err
+	}
+
+	// Наносекунды в имени, чтобы новая картинка не затёрла старую при замене
+	filename := fmt.Sprintf("%d_%d%s", userID, time.Now().UnixNano(), ext)
+	if err := os.Rename(tmpName, filepath.Join(uploadsDir, filename)); err != nil {
+		os.Remove(tmpName)
+		return "", err
+	}
+	return uploadsURLPrefix + filename, nil
+}
+
+// removeImage удаляет файл изображения по его URL.
+// Пути вне каталога загрузок игнорируются.
+func removeImage(imagePath string) error {
+	if !strings.HasPrefix(imagePath, uploadsURLPrefix) {
+		return nil
+	}
+	name := filepath.Base(imagePath)
+	if name == "." || name == "/" || strings.HasPrefix(name, ".") {
+		return nil
+	}
+	err := os.Remove(filepath.Join(uploadsDir, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -65,86 +65,43 @@ func Like(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Проверка поста
+		// Проверка поста или комментария
 		if postID.Valid {
 			if !database.PostExists(db, int(postID.Int64)) {
 				http.Error(w, "Post not found", http.StatusBadRequest)
 				return
 			}
+		} else if !database.CommentExists(db, int(commentID.Int64)) {
+			http.Error(w, "Comment not found", http.StatusBadRequest)
+			return
 		}
 
-		// Проверка существования голоса от пользователя для данного поста/комментария
-		var existingIsLike bool
-		var existingVoteID int
-		query := ""
-		var args []interface{}
-
+		// Повторный такой же голос отменяет его, иначе голос устанавливается или меняется
+		var targetPost, targetComment int
 		if postID.Valid {
-			query = "SELECT id, is_like FROM likes WHERE user_id = ? AND post_id = ? AND comment_id IS NULL"
-			args = []interface{}{userID, postID.Int64}
-		} else { // commentID.Valid
-			query = "SELECT id, is_like FROM likes WHERE user_id = ? AND comment_id = ? AND post_id IS NULL"
-			args = []interface{}{userID, commentID.Int64}
+			targetPost = int(postID.Int64)
+		} else {
+			targetComment = int(commentID.Int64)
 		}
-
-		err = db.QueryRow(query, args...).Scan(&existingVoteID, &existingIsLike)
-
-		if err == nil { // Голос уже существует
-			if existingIsLike == isLike { // Если голос совпадает (лайк на лайк, дизлайк на дизлайк)
-				// Удаляем голос (отменяем)
-				deleteQuery := ""
-				deleteArgs := []interface{}{userID}
-				if postID.Valid {
-					deleteQuery = "DELETE FROM likes WHERE user_id = ? AND post_id = ? AND comment_id IS NULL"
-					deleteArgs = append(deleteArgs, postID.Int64)
-				} else {
-					deleteQuery = "DELETE FROM likes WHERE user_id = ? AND comment_id = ? AND post_id IS NULL"
-					deleteArgs = append(deleteArgs, commentID.Int64)
-				}
-				_, err := db.Exec(deleteQuery, deleteArgs...)
-				if err != nil {
-					log.Println("Ошибка удаления существующего голоса:", err)
-					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-					return
-				}
-			} else { // Если голос не совпадает (меняем лайк на дизлайк или наоборот)
-				updateQuery := ""
-				updateArgs := []interface{}{isLike, userID}
-				if postID.Valid {
-					updateQuery = "UPDATE likes SET is_like = ? WHERE user_id = ? AND post_id = ? AND comment_id IS NULL"
-					updateArgs = append(updateArgs, postID.Int64)
-				} else {
-					updateQuery = "UPDATE likes SET is_like = ? WHERE user_id = ? AND comment_id = ? AND post_id IS NULL"
-					updateArgs = append(updateArgs, commentID.Int64)
-				}
-				_, err := db.Exec(updateQuery, updateArgs...)
-				if err != nil {
-					log.Println("Ошибка обновления существующего голоса:", err)
-					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-					return
-				}
-			}
-		} else if err == sql.ErrNoRows { // Голоса нет, вставляем новый
-			insertQuery := ""
-			insertArgs := []interface{}{userID}
-			if postID.Valid {
-				insertQuery = "INSERT INTO likes(user_id, post_id, is_like) VALUES(?, ?, ?)"
-				insertArgs = append(insertArgs, postID.Int64, isLike)
-			} else {
-				insertQuery = "INSERT INTO likes(user_id, comment_id, is_like) VALUES(?, ?, ?)"
-				insertArgs = append(insertArgs, commentID.Int64, isLike)
-			}
-			_, err := db.Exec(insertQuery, insertArgs...)
-			if err != nil {
-				log.Println("Ошибка вставки нового голоса:", err)
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-				return
-			}
-		} else { // Другая ошибка БД при проверке голоса
+		liked, disliked, err := userVote(db, userID, targetPost, targetComment)
+		if err != nil {
 			log.Println("Ошибка запроса существующего голоса:", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
+		value := -1
+		if isLike {
+			value = 1
+		}
+		if (isLike && liked) || (!isLike && disliked) {
+			value = 0
+		}
+		if err := setVote(db, userID, targetPost, targetComment, value); err != nil {
+			log.Println("Ошибка сохранения голоса:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		publishVote(db, targetPost, targetComment)
 
 		// Перенаправление на страницу постов, сохраняя текущую категорию
 		redirectCategory := r.FormValue("redirect_category")
@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	liveSendBuffer   = 32               // Очередь исходящих сообщений соединения; переполнение — медленный клиент
+	liveReadLimit    = 1024             // Максимальный размер сообщения от клиента, байт
+	livePongWait     = 60 * time.Second // Сколько ждать pong, прежде чем считать соединение мёртвым
+	livePingInterval = 30 * time.Second // Интервал ping; меньше livePongWait
+	liveWriteWait    = 10 * time.Second // Таймаут записи одного сообщения
+	liveRateLimit    = 5                // Сообщений от клиента в секунду в среднем
+	liveRateBurst    = 10               // Допустимый всплеск сообщений
+)
+
+// Типы сообщений, которые присылает клиент
+const liveTyping = "typing"
+
+// CheckOrigin по умолчанию пропускает только запросы с того же хоста:
+// чужая страница не сможет открыть канал с cookie пользователя
+var liveUpgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+
+// liveMessage — сообщение канала. Для событий хаба Data — те же данные, что и в /events.
+type liveMessage struct {
+	Type string          `json:"type"`
+	ID   string          `json:"id,omitempty"`
+	Data json.RawMessage `json:"data"`
+}
+
+// liveClient — одно WebSocket-соединение зрителя поста
+type liveClient struct {
+	conn     *websocket.Conn
+	postID   int
+	userID   int // 0 — гость: только получает события
+	username string
+	send     chan []byte
+	slow     bool // Отключён за переполнение очереди; пишется под live.mu до закрытия send
+
+	tokens   float64 // Токены ограничителя частоты сообщений
+	lastSeen time.Time
+}
+
+// allow расходует токен на входящее сообщение; false — клиент превысил лимит
+func (c *liveClient) allow(now time.Time) bool {
+	c.tokens += now.Sub(c.lastSeen).Seconds() * liveRateLimit
+	if c.tokens > liveRateBurst {
+		c.tokens = liveRateBurst
+	}
+	c.lastSeen = now
+	if c.tokens < 1 {
+		return false
+	}
+	c.tokens--
+	return true
+}
+
+// liveHub — комнаты зрителей по постам
+type liveHub struct {
+	mu     sync.Mutex
+	rooms  map[int]map[*liveClient]struct{}
+	closed bool // Сервер останавливается: новые соединения не принимаются
+}
+
+var live = &liveHub{rooms: map[int]map[*liveClient]struct{}{}}
+
+func init() {
+	events.listen(live.dispatch)
+}
+
+// join добавляет клиента в комнату поста; false — сервер уже останавливается
+func (h *liveHub) join(c *liveClient) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return false
+	}
+	if h.rooms[c.postID] == nil {
+		h.rooms[c.postID] = map[*liveClient]struct{}{}
+	}
+	h.rooms[c.postID][c] = struct{}{}
+	return true
+}
+
+// leave удаляет клиента и закрывает его очередь, если это ещё не сделано
+func (h *liveHub) leave(c *liveClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.drop(c)
+}
+
+// drop — leave под уже взятой блокировкой
+func (h *liveHub) drop(c *liveClient) {
+	room := h.rooms[c.postID]
+	if _, ok := room[c]; !ok {
+		return
+	}
+	delete(room, c)
+	if len(room) == 0 {
+		delete(h.rooms, c.postID)
+	}
+	close(c.send)
+}
+
+// broadcast ставит сообщение в очередь всем зрителям поста, кроме except.
+// Не блокируется: клиент с полной очередью отключается (backpressure).
+func (h *liveHub) broadcast(postID int, msg []byte, except *liveClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.rooms[postID] {
+		if c == except {
+			continue
+		}
+		select {
+		case c.send <- msg:
+		default:
+			c.slow = true
+			h.drop(c)
+		}
+	}
+}
+
+// dispatch пересылает публичные события поста в его комнату.
+// Вызывается хабом событий под его блокировкой, поэтому не ждёт клиентов.
+func (h *liveHub) dispatch(e Event) {
+	if e.UserID != 0 || e.PostID == 0 {
+		return
+	}
+	msg, err := json.Marshal(liveMessage{Type: e.Type, ID: e.ID, Data: e.Data})
+	if err != nil {
+		log.Println("Error encoding live message:", err)
+		return
+	}
+	h.broadcast(e.PostID, msg, nil)
+}
+
+// CloseLiveConnections закрывает все WebSocket-соединения с кодом 1001 (going away).
+// Вызывается при остановке сервера перед http.Server.Shutdown, который не отслеживает перехваченные соединения.
+func CloseLiveConnections() {
+	live.mu.Lock()
+	defer live.mu.Unlock()
+	live.closed = true
+	deadline := time.Now().Add(time.Second)
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	for _, room := range live.rooms {
+		for c := range room {
+			c.conn.WriteControl(websocket.CloseMessage, msg, deadline)
+			c.conn.Close()
+			live.drop(c)
+		}
+	}
+}
+
+// PostLive открывает WebSocket-канал обсуждения поста: /post/{id}/live.
+// Зрители получают новые, изменённые и удалённые комментарии, изменения поста и счётчики голосов.
+// Пользователь, вошедший по cookie сессии, может отправлять {"type":"typing"}.
+func PostLive(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		postID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil || postID < 1 {
+			http.Error(w, "Invalid post ID", http.StatusBadRequest)
+			return
+		}
+		var exists int
+		if err := db.QueryRow("SELECT 1 FROM posts WHERE id = ? AND publish_at IS NULL", postID).Scan(&exists); err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "Post not found", http.StatusNotFound)
+				return
+			}
+			log.Println("Error checking post for live channel:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		userID, username, _ := sessionUser(db, r)
+
+		// Upgrade сам отвечает клиенту ошибкой, если запрос не WebSocket или Origin чужой
+		conn, err := liveUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		c := &liveClient{
+			conn:     conn,
+			postID:   postID,
+			userID:   userID,
+			username: username,
+			send:     make(chan []byte, liveSendBuffer),
+			tokens:   liveRateBurst,
+			lastSeen: time.Now(),
+		}
+		if !live.join(c) {
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+				time.Now().Add(liveWriteWait))
+			conn.Close()
+			return
+		}
+		go c.writePump()
+		c.readPump()
+	}
+}
+
+// readPump читает сообщения клиента до закрытия соединения
+func (c *liveClient) readPump() {
+	defer func() {
+		live.leave(c)
+		c.conn.Close()
+	}()
+	c.conn.SetReadLimit(liveReadLimit)
+	c.conn.SetReadDeadline(time.Now().Add(livePongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(livePongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if !c.allow(time.Now()) {
+			c.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "rate limit exceeded"),
+				time.Now().Add(liveWriteWait))
+			return
+		}
+		var msg liveMessage
+		if err := json.Unmarshal(data, &msg); err != nil || msg.Type != liveTyping {
+			continue
+		}
+		if c.userID == 0 {
+			continue // Гости только читают
+		}
+		payload, _ := json.Marshal(map[string]interface{}{"post_id": c.postID, "user": c.username})
+		out, _ := json.Marshal(liveMessage{Type: liveTyping, Data: payload})
+		live.broadcast(c.postID, out, c)
+	}
+}
+
+// writePump отправляет очередь клиента и ping'и. Закрытая очередь означает,
+// что клиента отключили: сервер останавливается или клиент не успевал читать.
+func (c *liveClient) writePump() {
+	ticker := time.NewTicker(livePingInterval)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+	for {
+		select {
+		case msg, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(liveWriteWait))
+			if !ok {
+				if !c.slow {
+					return
+				}
+				c.conn.WriteMessage(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "client too slow"))
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(liveWriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,529 @@
+package handlers
+
+import (
+	"database/sql"
+	"html"
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"01.tomorrow-school.ai/git/zsakhipo/forum/codefence"
+)
+
+// Markdown для постов и комментариев: подмножество CommonMark — абзацы, **жирный**, *курсив*,
+// списки, цитаты, ссылки, `код` и блоки ``` ```.
+//
+// Очистка устроена по белому списку: исходный текст никогда не попадает в вывод как HTML,
+// весь текст экранируется, а теги формируются только рендером из набора
+// p, br, strong, em, code, pre, blockquote, ul, ol, li, a и span подсветки кода. Атрибуты тоже фиксированы:
+// href (только http, https, mailto и относительные адреса), rel, class и start у списка.
+// Исходный текст в базе не меняется — его видит форма редактирования.
+
+// maxMarkdownDepth ограничивает вложенность цитат и списков
+const maxMarkdownDepth = 8
+
+var (
+	listItemPattern  = regexp.MustCompile(`^( {0,3})([-*+]|\d{1,9}[.)])( +|$)`)
+	mentionAtPattern = regexp.MustCompile(`^@([\p{L}\p{N}_-]{3,20})`)
+	autolinkPattern  = regexp.MustCompile(`^https?://[^\s<>"]+`)
+	fenceLangPattern = regexp.MustCompile(`^[A-Za-z0-9_+#-]+$`)
+)
+
+// renderMarkdown преобразует Markdown в безопасный HTML.
+// mention сообщает, существует ли пользователь; если nil, упоминания остаются текстом.
+func renderMarkdown(src string, mention func(string) bool) string {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	md := markdown{mention: mention}
+	var sb strings.Builder
+	md.blocks(&sb, strings.Split(src, "\n"), 0)
+	return sb.String()
+}
+
+// markdownFunc возвращает функцию шаблона markdown со ссылками на профили упомянутых пользователей
+func markdownFunc(db *sql.DB) func(string) template.HTML {
+	exists := mentionChecker(db)
+	return func(text string) template.HTML {
+		return template.HTML(renderMarkdown(text, exists))
+	}
+}
+
+// Preview возвращает HTML-фрагмент для живого предпросмотра в формах постов: POST /preview
+func Preview(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if _, _, ok := sessionUser(db, r); !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		content := normalizeText(r.FormValue("content"))
+		if utf8.RuneCountInString(content) > maxContentLength {
+			http.Error(w, errContentTooLong.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(markdownFunc(db)(content)))
+	}
+}
+
+type markdown struct {
+	mention func(string) bool
+}
+
+// blocks разбирает строки на блоки и выводит их
+func (md markdown) blocks(sb *strings.Builder, lines []string, depth int) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case strings.TrimSpace(line) == "":
+			i++
+
+		case codefence.Opening(line) != "" && depth < maxMarkdownDepth:
+			i = md.fenced(sb, lines, i)
+
+		case isQuoteLine(line) && depth < maxMarkdownDepth:
+			var inner []string
+			for ; i < len(lines) && isQuoteLine(lines[i]); i++ {
+				inner = append(inner, stripQuote(lines[i]))
+			}
+			sb.WriteString("<blockquote>")
+			md.blocks(sb, inner, depth+1)
+			sb.WriteString("</blockquote>")
+
+		case listItemPattern.MatchString(line) && depth < maxMarkdownDepth:
+			i = md.list(sb, lines, i, depth)
+
+		default:
+			// Абзац продолжается до пустой строки или начала другого блока
+			start := i
+			for i++; i < len(lines); i++ {
+				next := lines[i]
+				if strings.TrimSpace(next) == "" || codefence.Opening(next) != "" || isQuoteLine(next) || interruptsParagraph(next) {
+					break
+				}
+			}
+			sb.WriteString("<p>")
+			md.inline(sb, strings.TrimSpace(strings.Join(lines[start:i], "\n")), false)
+			sb.WriteString("</p>")
+		}
+	}
+}
+
+// fenced выводит блок кода, начинающийся со строки start, и возвращает индекс следующей строки.
+// Незакрытый блок продолжается до конца текста.
+func (md markdown) fenced(sb *strings.Builder, lines []string, start int) int {
+	fence := codefence.Opening(lines[start])
+	info := strings.Fields(strings.TrimLeft(lines[start], " ")[len(fence):])
+	var lang string
+	if len(info) > 0 && fenceLangPattern.MatchString(info[0]) {
+		lang = strings.ToLower(info[0])
+	}
+
+	var code []string
+	i := start + 1
+	for ; i < len(lines); i++ {
+		if codefence.Closes(lines[i], fence) {
+			i++
+			break
+		}
+		code = append(code, lines[i])
+	}
+
+	sb.WriteString("<pre><code")
+	if lang != "" {
+		sb.WriteString(` class="language-` + lang + `"`)
+	}
+	sb.WriteString(">")
+	sb.WriteString(highlightCode(lang, strings.Join(code, "\n")))
+	sb.WriteString("</code></pre>")
+	return i
+}
+
+func isQuoteLine(line string) bool {
+	trimmed := strings.TrimLeft(line, " ")
+	return len(line)-len(trimmed) <= 3 && strings.HasPrefix(trimmed, ">")
+}
+
+func stripQuote(line string) string {
+	trimmed := strings.TrimPrefix(strings.TrimLeft(line, " "), ">")
+	return strings.TrimPrefix(trimmed, " ")
+}
+
+// interruptsParagraph сообщает, начинает ли строка список посреди абзаца.
+// Как в CommonMark, нумерованный список прерывает абзац, только если начинается с 1.
+func interruptsParagraph(line string) bool {
+	m := listItemPattern.FindStringSubmatch(line)
+	if m == nil || strings.TrimSpace(line[len(m[0]):]) == "" {
+		return false
+	}
+	marker := m[2]
+	if len(marker) == 1 {
+		return true
+	}
+	return marker[:len(marker)-1] == "1"
+}
+
+// list выводит список, начинающийся со строки start, и возвращает индекс следующей строки
+func (md markdown) list(sb *strings.Builder, lines []string, start, depth int) int {
+	first := listItemPattern.FindStringSubmatch(lines[start])
+	ordered := len(first[2]) > 1
+	delim := first[2][len(first[2])-1]
+
+	type item struct{ lines []string }
+	var items []item
+	loose := false
+	i := start
+	for i < len(lines) {
+		m := listItemPattern.FindStringSubmatch(lines[i])
+		if m == nil || (len(m[2]) > 1) != ordered || m[2][len(m[2])-1] != delim {
+			break
+		}
+		// Отступ содержимого: маркер и пробелы после него (не больше четырёх)
+		indent := len(m[1]) + len(m[2]) + min(len(m[3]), 4)
+		if m[3] == "" {
+			indent++
+		}
+		it := item{lines: []string{lines[i][len(m[0]):]}}
+		i++
+		for i < len(lines) {
+			line := lines[i]
+			if strings.TrimSpace(line) == "" {
+				// Пустая строка остаётся в пункте, только если за ней идёт продолжение с отступом
+				j := i
+				for j < len(lines) && strings.TrimSpace(lines[j]) == "" {
+					j++
+				}
+				if j < len(lines) && leadingSpaces(lines[j]) >= indent {
+					loose = true
+					for ; i < j; i++ {
+						it.lines = append(it.lines, "")
+					}
+					continue
+				}
+				break
+			}
+			if leadingSpaces(line) >= indent {
+				it.lines = append(it.lines, line[indent:])
+			} else if listItemPattern.MatchString(line) || codefence.Opening(line) != "" || isQuoteLine(line) {
+				break
+			} else {
+				// Ленивое продолжение абзаца без отступа
+				it.lines = append(it.lines, strings.TrimLeft(line, " "))
+			}
+			i++
+		}
+		items = append(items, it)
+
+		// Пустые строки между пунктами делают список «свободным» с абзацами в пунктах
+		j := i
+		for j < len(lines) && strings.TrimSpace(lines[j]) == "" {
+			j++
+		}
+		if j > i && j < len(lines) && listItemPattern.MatchString(lines[j]) {
+			loose = true
+			i = j
+		}
+	}
+
+	tag := "ul"
+	if ordered {
+		tag = "ol"
+	}
+	sb.WriteString("<" + tag)
+	if ordered {
+		if n, err := strconv.Atoi(first[2][:len(first[2])-1]); err == nil && n != 1 {
+			sb.WriteString(` start="` + strconv.Itoa(n) + `"`)
+		}
+	}
+	sb.WriteString(">")
+	for _, it := range items {
+		var inner strings.Builder
+		md.blocks(&inner, it.lines, depth+1)
+		out := inner.String()
+		if !loose {
+			// В плотном списке текст пункта выводится без <p>
+			out = strings.ReplaceAll(strings.ReplaceAll(out, "<p>", ""), "</p>", "")
+		}
+		sb.WriteString("<li>" + out + "</li>")
+	}
+	sb.WriteString("</" + tag + ">")
+	return i
+}
+
+func leadingSpaces(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// inline выводит строчную разметку: код, ссылки, выделение, упоминания и переводы строк.
+// inLink запрещает вложенные ссылки внутри текста ссылки.
+func (md markdown) inline(sb *strings.Builder, text string, inLink bool) {
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '\\' && i+1 < len(text) && isASCIIPunct(text[i+1]):
+			sb.WriteString(html.EscapeString(text[i+1 : i+2]))
+			i += 2
+			continue
+
+		case c == '\n':
+			sb.WriteString("<br>\n")
+			i++
+			continue
+
+		case c == '`':
+			if n := md.codeSpan(sb, text[i:]); n > 0 {
+				i += n
+				continue
+			}
+			// Без закрывающей пары обратные кавычки выводятся как есть
+			n := 0
+			for i+n < len(text) && text[i+n] == '`' {
+				n++
+			}
+			sb.WriteString(text[i : i+n])
+			i += n
+			continue
+
+		case c == '[' && !inLink:
+			if n := md.link(sb, text[i:]); n > 0 {
+				i += n
+				continue
+			}
+
+		case c == '*' || c == '_':
+			if n := md.emphasis(sb, text, i, inLink); n > 0 {
+				i += n
+				continue
+			}
+
+		case c == '@' && md.mention != nil && !inLink && !precededByWordChar(text, i):
+			if m := mentionAtPattern.FindStringSubmatch(text[i:]); m != nil && md.mention(m[1]) {
+				sb.WriteString(`<a href="/user/` + url.PathEscape(m[1]) + `" class="text-blue-600 hover:underline">@` + html.EscapeString(m[1]) + `</a>`)
+				i += len(m[0])
+				continue
+			}
+
+		case c == 'h' && !inLink && !precededByWordChar(text, i):
+			if m := autolinkPattern.FindString(text[i:]); m != "" {
+				// Завершающая пунктуация относится к предложению, а не к адресу
+				m = strings.TrimRight(m, ".,:;!?)'*_")
+				sb.WriteString(`<a href="` + html.EscapeString(m) + `" rel="nofollow noopener">` + html.EscapeString(m) + `</a>`)
+				i += len(m)
+				continue
+			}
+		}
+		_, size := utf8.DecodeRuneInString(text[i:])
+		sb.WriteString(html.EscapeString(text[i : i+size]))
+		i += size
+	}
+}
+
+// codeSpan выводит `код` в начале text и возвращает длину разобранного фрагмента или 0
+func (md markdown) codeSpan(sb *strings.Builder, text string) int {
+	n := 0
+	for n < len(text) && text[n] == '`' {
+		n++
+	}
+	for j := n; j < len(text); {
+		k := strings.IndexByte(text[j:], '`')
+		if k < 0 {
+			return 0
+		}
+		start := j + k
+		end := start
+		for end < len(text) && text[end] == '`' {
+			end++
+		}
+		if end-start == n {
+			code := strings.ReplaceAll(text[n:start], "\n", " ")
+			if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+				code = code[1 : len(code)-1]
+			}
+			sb.WriteString("<code>" + html.EscapeString(code) + "</code>")
+			return end
+		}
+		j = end
+	}
+	return 0
+}
+
+// link выводит [текст](адрес) в начале text и возвращает длину разобранного фрагмента или 0.
+// Ссылка с недопустимой схемой выводится простым текстом.
+func (md markdown) link(sb *strings.Builder, text string) int {
+	level := 0
+	closing := -1
+	for j := 0; j < len(text) && closing < 0; j++ {
+		switch text[j] {
+		case '\\':
+			j++
+		case '[':
+			level++
+		case ']':
+			level--
+			if level == 0 {
+				closing = j
+			}
+		case '\n':
+			if j+1 < len(text) && text[j+1] == '\n' {
+				return 0
+			}
+		}
+	}
+	if closing < 0 || closing+1 >= len(text) || text[closing+1] != '(' {
+		return 0
+	}
+	// Адрес может содержать парные скобки, как в ссылках на Википедию
+	end, parens := -1, 0
+	for j := closing + 2; j < len(text) && end < 0; j++ {
+		switch text[j] {
+		case '(':
+			parens++
+		case ')':
+			if parens == 0 {
+				end = j
+			}
+			parens--
+		}
+	}
+	if end < 0 {
+		return 0
+	}
+	href := strings.TrimSpace(text[closing+2 : end])
+	href = strings.TrimSuffix(strings.TrimPrefix(href, "<"), ">")
+	if strings.ContainsAny(href, " \n") {
+		return 0
+	}
+
+	label := text[1:closing]
+	if !safeURL(href) {
+		md.inline(sb, label, true)
+		return end + 1
+	}
+	sb.WriteString(`<a href="` + html.EscapeString(href) + `" rel="nofollow noopener">`)
+	md.inline(sb, label, true)
+	sb.WriteString("</a>")
+	return end + 1
+}
+
+// safeURL разрешает http, https, mailto и относительные адреса
+func safeURL(href string) bool {
+	if href == "" {
+		return false
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.Host != ""
+	case "mailto":
+		return true
+	case "":
+		// «//host» без схемы — ссылка на чужой сайт, разрешаем только явные http(s).
+		// Браузеры читают «\» как «/», поэтому «/\host» и «\\host» означают то же самое.
+		if strings.Contains(href, `\`) {
+			return false
+		}
+		return len(href) < 2 || !isURLSlash(href[0]) || !isURLSlash(href[1])
+	}
+	return false
+}
+
+// isURLSlash сообщает, считает ли браузер символ разделителем пути
+func isURLSlash(c byte) bool {
+	return c == '/' || c == '\\'
+}
+
+// emphasis выводит *курсив*, **жирный** (или с _) начиная с позиции i
+// и возвращает длину разобранного фрагмента или 0
+func (md markdown) emphasis(sb *strings.Builder, text string, i int, inLink bool) int {
+	c := text[i]
+	n := 1
+	if i+1 < len(text) && text[i+1] == c {
+		n = 2
+	}
+	rest := text[i+n:]
+	// Открывающий разделитель не может стоять перед пробелом, а _ — внутри слова (snake_case)
+	if rest == "" || unicode.IsSpace(firstRune(rest)) || (c == '_' && precededByWordChar(text, i)) {
+		return 0
+	}
+	// Разделители разбираются сериями целиком; opened считает открытые внутри
+	// вложенные выделения (по длине серии), чтобы не закрыть внешнее их разделителем
+	var opened [3]int
+	for j := 1; j < len(rest); {
+		if rest[j] != c {
+			j++
+			continue
+		}
+		k := j
+		for k < len(rest) && rest[k] == c {
+			k++
+		}
+		run := k - j
+		if unicode.IsSpace(lastRune(rest[:j])) {
+			// Серия после пробела открывает вложенное выделение
+			if run < 3 && k < len(rest) && !unicode.IsSpace(firstRune(rest[k:])) {
+				opened[run]++
+			}
+			j = k
+			continue
+		}
+		if run < 3 && (opened[run] > 0 || run != n) {
+			// Закрывает вложенное выделение: * внутри **…** или ** внутри *…*
+			if opened[run] > 0 {
+				opened[run]--
+			}
+			j = k
+			continue
+		}
+		after := rest[k:]
+		if c == '_' && after != "" && isWordChar(firstRune(after)) {
+			j = k
+			continue
+		}
+		// Закрываем последними символами серии: в ***текст*** внутренний * остаётся курсиву
+		end := k - n
+		tag := "em"
+		if n == 2 {
+			tag = "strong"
+		}
+		sb.WriteString("<" + tag + ">")
+		md.inline(sb, rest[:end], inLink)
+		sb.WriteString("</" + tag + ">")
+		return n + k
+	}
+	return 0
+}
+
+func precededByWordChar(text string, i int) bool {
+	if i == 0 {
+		return false
+	}
+	return isWordChar(lastRune(text[:i]))
+}
+
+func isWordChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || r == '_' || r == '@' || r == '-'
+}
+
+func isASCIIPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+func firstRune(s string) rune {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r
+}
+
+func lastRune(s string) rune {
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return r
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// markdownCases — исходный Markdown и ожидаемый HTML
+var markdownCases = []struct {
+	name, src, want string
+}{
+	// Исходный HTML всегда экранируется
+	{"script tag", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>"},
+	{"img onerror", "<img src=x onerror=alert(1)>", "<p>&lt;img src=x onerror=alert(1)&gt;</p>"},
+	{"entities stay text", "a <b>bold</b> &amp; &lt;", "<p>a &lt;b&gt;bold&lt;/b&gt; &amp;amp; &amp;lt;</p>"},
+	{"html in list", "- <iframe src=x>", "<ul><li>&lt;iframe src=x&gt;</li></ul>"},
+
+	// Ссылки: только http, https, mailto и относительные адреса
+	{"javascript link", "[x](javascript:alert(1))", "<p>x</p>"},
+	{"javascript mixed case", "[x](JaVaScRiPt:alert(1))", "<p>x</p>"},
+	{"data link", "[x](data:text/html,hi)", "<p>x</p>"},
+	{"entity-encoded javascript", "[x](&#106;avascript:alert(1))", `<p><a href="&amp;#106;avascript:alert(1)" rel="nofollow noopener">x</a></p>`},
+	{"hex entity javascript", "[x](jav&#x61;script:alert(1))", `<p><a href="jav&amp;#x61;script:alert(1)" rel="nofollow noopener">x</a></p>`},
+	{"tab in scheme", "[x](java\tscript:alert(1))", "<p>x</p>"},
+	{"relative link", "[x](/posts?a=1&b=2)", `<p><a href="/posts?a=1&amp;b=2" rel="nofollow noopener">x</a></p>`},
+	{"https link", "[x](https://example.com)", `<p><a href="https://example.com" rel="nofollow noopener">x</a></p>`},
+	{"mailto link", "[x](mailto:a@example.com)", `<p><a href="mailto:a@example.com" rel="nofollow noopener">x</a></p>`},
+	{"protocol-relative link", "[x](//evil.com)", "<p>x</p>"},
+	{"slash backslash link", `[x](/\evil.com)`, "<p>x</p>"},
+	{"double backslash link", `[x](\\evil.com)`, "<p>x</p>"},
+	{"backslash in path", `[x](/a\b)`, "<p>x</p>"},
+	{"https without host", "[x](https:/evil.com)", "<p>x</p>"},
+
+	// Выход из атрибута через текст или адрес ссылки
+	{"quote in link text", `[" onmouseover="alert(1)](/a)`, `<p><a href="/a" rel="nofollow noopener">&#34; onmouseover=&#34;alert(1)</a></p>`},
+	{"tag in link text", "[<img src=x>](/a)", `<p><a href="/a" rel="nofollow noopener">&lt;img src=x&gt;</a></p>`},
+	{"quote in href", `[x](/a"onmouseover="alert(1))`, `<p><a href="/a&#34;onmouseover=&#34;alert(1)" rel="nofollow noopener">x</a></p>`},
+	{"apostrophe in href", "[x](/a'><script>)", `<p><a href="/a&#39;&gt;&lt;script" rel="nofollow noopener">x</a></p>`},
+	{"quote in autolink", `https://example.com/?q="x"`, `<p><a href="https://example.com/?q=" rel="nofollow noopener">https://example.com/?q=</a>&#34;x&#34;</p>`},
+	{"nested link", "[a [b](/b)](/a)", `<p><a href="/a" rel="nofollow noopener">a [b](/b)</a></p>`},
+
+	// Выделение
+	{"emphasis", "*x* and **y**", "<p><em>x</em> and <strong>y</strong></p>"},
+	{"strong emphasis", "***both***", "<p><strong><em>both</em></strong></p>"},
+	{"em inside strong", "**b *i* b**", "<p><strong>b <em>i</em> b</strong></p>"},
+	{"strong inside em", "*a **b *c* b** a*", "<p><em>a <strong>b <em>c</em> b</strong> a</em></p>"},
+	{"closing run", "*a **b***", "<p><em>a <strong>b</strong></em></p>"},
+	{"underscores", "_a __b__ c_", "<p><em>a <strong>b</strong> c</em></p>"},
+	{"snake case", "snake_case_name", "<p>snake_case_name</p>"},
+	{"spaced asterisks", "2 * 3 * 4", "<p>2 * 3 * 4</p>"},
+	{"unclosed emphasis", "*unclosed", "<p>*unclosed</p>"},
+
+	// Код
+	{"code span", "`<b>` and ``a`b``", "<p><code>&lt;b&gt;</code> and <code>a`b</code></p>"},
+	{"fence", "```\n<script>\n```", "<pre><code>&lt;script&gt;</code></pre>"},
+	{"tilde fence", "~~~\n*code*\n~~~", "<pre><code>*code*</code></pre>"},
+	{"fence language", "```go\nfunc main() {}\n```", `<pre><code class="language-go"><span class="hl-keyword">func</span> main() {}</code></pre>`},
+	{"fence language breakout", "```js\" onload=\"x\nalert(1)\n```", "<pre><code>alert(1)</code></pre>"},
+	{"unclosed fence", "```\nunclosed <b>", "<pre><code>unclosed &lt;b&gt;</code></pre>"},
+	{"longer closing fence", "```\na\n`````\nb", "<pre><code>a</code></pre><p>b</p>"},
+	{"shorter fence does not close", "````\na\n```\n````", "<pre><code>a\n```</code></pre>"},
+	{"backtick in info string", "``` a`b\nx", "<p>``` a`b<br>\nx</p>"},
+	{"indented four spaces", "    ```\nx", "<p>```<br>\nx</p>"},
+	{"fence in quote", "> ```\n> <b>\n> ```", "<blockquote><pre><code>&lt;b&gt;</code></pre></blockquote>"},
+
+	// Блоки
+	{"nested list", "- a\n  - b\n    - c", "<ul><li>a<ul><li>b<ul><li>c</li></ul></li></ul></li></ul>"},
+	{"ordered list start", "3. a\n4. b", `<ol start="3"><li>a</li><li>b</li></ol>`},
+	{"quote", "> a\n> > b", "<blockquote><p>a</p><blockquote><p>b</p></blockquote></blockquote>"},
+	{"line break", "a\nb", "<p>a<br>\nb</p>"},
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	for _, tc := range markdownCases {
+		got := renderMarkdown(tc.src, nil)
+		if got != tc.want {
+			t.Errorf("%s: renderMarkdown(%q)\nexpected %s\n     got %s", tc.name, tc.src, tc.want, got)
+		}
+		if err := checkMarkdownTags(got); err != nil {
+			t.Errorf("%s: %v in %s", tc.name, err, got)
+		}
+	}
+}
+
+// Вложенность цитат и списков ограничена maxMarkdownDepth; глубже разметка выводится текстом
+func TestRenderMarkdownDepth(t *testing.T) {
+	quote := strings.Repeat("> ", maxMarkdownDepth+2) + "deep"
+	var list strings.Builder
+	for i := 0; i < maxMarkdownDepth+2; i++ {
+		list.WriteString(strings.Repeat("  ", i) + "- item\n")
+	}
+
+	for _, tc := range []struct{ name, src, tag string }{
+		{"quotes", quote, "<blockquote>"},
+		{"lists", list.String(), "<ul>"},
+	} {
+		got := renderMarkdown(tc.src, nil)
+		if n := strings.Count(got, tc.tag); n != maxMarkdownDepth {
+			t.Errorf("%s: expected %d %s tags, got %d: %s", tc.name, maxMarkdownDepth, tc.tag, n, got)
+		}
+		if err := checkMarkdownTags(got); err != nil {
+			t.Errorf("%s: %v in %s", tc.name, err, got)
+		}
+	}
+
+	// Блок кода на предельной глубине остаётся текстом
+	got := renderMarkdown(strings.Repeat("> ", maxMarkdownDepth)+"```\n<b>", nil)
+	if strings.Contains(got, "<pre>") || strings.Contains(got, "<b>") {
+		t.Errorf("fence below maxMarkdownDepth: %s", got)
+	}
+}
+
+func TestRenderMarkdownMentions(t *testing.T) {
+	exists := func(name string) bool { return name == "alice" }
+	got := renderMarkdown("@alice, @bob and `@alice` [@alice](/x)", exists)
+	want := `<p><a href="/user/alice" class="text-blue-600 hover:underline">@alice</a>, @bob and <code>@alice</code> <a href="/x" rel="nofollow noopener">@alice</a></p>`
+	if got != want {
+		t.Errorf("expected %s\n     got %s", want, got)
+	}
+}
+
+var markdownTagPattern = regexp.MustCompile(`<(/?)([a-z]+)([^>]*)>`)
+
+// allowedMarkdownAttrs — атрибуты, которые может вывести рендер, по тегам
+var allowedMarkdownAttrs = map[string]*regexp.Regexp{
+	"a":    regexp.MustCompile(`^( href="[^"<>]*" rel="nofollow noopener"| href="/user/[^"<>]*" class="text-blue-600 hover:underline")$`),
+	"code": regexp.MustCompile(`^( class="language-[a-z0-9_+#-]+")?$`),
+	"ol":   regexp.MustCompile(`^( start="\d+")?$`),
+	"span": regexp.MustCompile(`^ class="hl-[a-z]+"$`),
+}
+
+// checkMarkdownTags проверяет, что в HTML только теги из белого списка рендера,
+// с допустимыми атрибутами и правильно вложенные
+func checkMarkdownTags(out string) error {
+	var stack []string
+	for _, m := range markdownTagPattern.FindAllStringSubmatch(out, -1) {
+		closing, tag, attrs := m[1] == "/", m[2], m[3]
+		switch tag {
+		case "br":
+			continue
+		case "p", "strong", "em", "pre", "blockquote", "ul", "li":
+			if attrs != "" {
+				return fmt.Errorf("unexpected attributes on <%s>: %q", tag, attrs)
+			}
+		case "a", "code", "ol", "span":
+			if !closing && !allowedMarkdownAttrs[tag].MatchString(attrs) {
+				return fmt.Errorf("unexpected attributes on <%s>: %q", tag, attrs)
+			}
+		default:
+			return fmt.Errorf("unexpected tag <%s>", tag)
+		}
+		if !closing {
+			stack = append(stack, tag)
+			continue
+		}
+		if len(stack) == 0 || stack[len(stack)-1] != tag {
+			return fmt.Errorf("unbalanced </%s>", tag)
+		}
+		stack = stack[:len(stack)-1]
+	}
+	if len(stack) > 0 {
+		return fmt.Errorf("unclosed <%s>", stack[len(stack)-1])
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+)
+
+// mentionedNames возвращает имена, упомянутые в тексте, без повторов в порядке появления.
+// Имена собирает сам рендер Markdown, поэтому @имя в `коде`, блоках ``` ``` и тексте ссылок
+// не считается упоминанием — ровно там, где оно не становится ссылкой на профиль.
+func mentionedNames(text string) []string {
+	var names []string
+	renderMarkdown(text, func(name string) bool {
+		if !containsString(names, name) {
+			names = append(names, name)
+		}
+		return false
+	})
+	return names
+}
+
+// notifyMentions уведомляет пользователей, упомянутых в content, но не в previous.
+// При создании previous пустой; при редактировании уведомление получают только новые упомянутые.
+func notifyMentions(db *sql.DB, actorID, postID, commentID int, content, previous string) {
+	before := mentionedNames(previous)
+	for _, name := range mentionedNames(content) {
+		if containsString(before, name) {
+			continue
+		}
+		var userID int
+		err := db.QueryRow("SELECT id FROM users WHERE username = ?", name).Scan(&userID)
+		if err == sql.ErrNoRows {
+			continue // Упоминание несуществующего пользователя остаётся обычным текстом
+		}
+		if err != nil {
+			log.Println("Error looking up mentioned user:", err)
+			continue
+		}
+		notify(db, userID, actorID, notifyMention, postID, commentID)
+	}
+}
+
+// mentionChecker возвращает проверку существования упомянутого пользователя для рендера Markdown.
+// Результаты запоминаются на время одного запроса.
+func mentionChecker(db *sql.DB) func(string) bool {
+	known := map[string]bool{}
+	return func(name string) bool {
+		if v, ok := known[name]; ok {
+			return v
+		}
+		var found bool
+		if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE username = ?)", name).Scan(&found); err != nil {
+			log.Println("Error checking mentioned user:", err)
+		}
+		known[name] = found
+		return found
+	}
+}
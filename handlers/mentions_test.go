@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMentionedNames(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"@alice and @bob, again @alice", []string{"alice", "bob"}},
+		{"mail me at user@example.com", nil},
+		{"`@alice` and ```@bob``` but @carol", []string{"carol"}},
+		{"```\n@alice\n```\n@bob", []string{"bob"}},
+		{"~~~go\n// @alice\n~~~", nil},
+		{"```\nunclosed @alice", nil},
+		{"    ```\n@alice", []string{"alice"}},
+		{"[@alice](/x) \\@bob @carol", []string{"carol"}},
+		{"> - @alice", []string{"alice"}},
+	}
+	for _, tc := range tests {
+		got := mentionedNames(tc.text)
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("mentionedNames(%q): expected %v, got %v", tc.text, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,810 @@
+package handlers
+
+import (
+	"database/sql"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxConversationMembers  = 8   // Участников в групповом диалоге, включая создателя
+	maxNewConversationsDay  = 20  // Новых диалогов в сутки от одного пользователя
+	maxReportReasonLength   = 200 // Длина пояснения к жалобе
+	conversationMessageShow = 200 // Сколько последних сообщений показывать в диалоге
+)
+
+// Статусы жалоб на сообщения
+const (
+	reportOpen      = "open"
+	reportDismissed = "dismissed"
+	reportRemoved   = "removed"
+)
+
+// Conversation — диалог в списке входящих
+type Conversation struct {
+	ID          int
+	Members     []string // Участники, кроме текущего пользователя
+	LastSender  string
+	LastMessage string // Пусто, если последнее сообщение скрыто модератором
+	LastAt      string
+	Unread      int
+}
+
+// Message — сообщение в диалоге
+type Message struct {
+	ID        int
+	Sender    string
+	Content   string
+	CreatedAt string
+	Mine      bool
+	Removed   bool
+}
+
+// InboxPageData — данные для шаблона messages.html
+type InboxPageData struct {
+	CurrentUser   string
+	Unread        int
+	Conversations []Conversation
+	Error         string
+	To            string // Значения формы нового диалога при ошибке
+	Content       string
+}
+
+// ConversationPageData — данные для шаблона conversation.html
+type ConversationPageData struct {
+	CurrentUser string
+	ID          int
+	Members     []string
+	Messages    []Message
+	Error       string
+	Reported    bool
+	BlockedBy   string // 1:1-диалог, в котором отправка заблокирована; пояснение для пользователя
+	DirectWith  string // Собеседник в диалоге один на один — для кнопки блокировки
+	Content     string
+}
+
+// BlocksPageData — данные для шаблона account_blocks.html
+type BlocksPageData struct {
+	CurrentUser string
+	Blocked     []BlockedUser
+	Error       string
+}
+
+// BlockedUser — заблокированный пользователь
+type BlockedUser struct {
+	Username string
+	Since    string
+}
+
+// MessageReport — жалоба на сообщение в очереди модерации
+type MessageReport struct {
+	ID        int
+	MessageID int
+	Sender    string
+	Reporter  string
+	Reason    string
+	Content   string
+	CreatedAt string
+}
+
+// ReportsPageData — данные для шаблона moderation_reports.html
+type ReportsPageData struct {
+	CurrentUser string
+	Reports     []MessageReport
+}
+
+// unreadMessages возвращает число непрочитанных сообщений пользователя.
+// Сообщения заблокированных им пользователей не учитываются.
+func unreadMessages(db *sql.DB, userID int) int {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*)
+		FROM messages m
+		JOIN conversation_members cm ON cm.conversation_id = m.conversation_id AND cm.user_id = ?
+		WHERE m.id > cm.last_read_message_id AND m.sender_id != ?
+			AND m.sender_id NOT IN (SELECT blocked_id FROM user_blocks WHERE blocker_id = ?)`,
+		userID, userID, userID).Scan(&count)
+	if err != nil {
+		log.Println("Error counting unread messages:", err)
+	}
+	return count
+}
+
+// isBlocked сообщает, заблокировал ли один из пользователей другого
+func isBlocked(db *sql.DB, a, b int) bool {
+	var exists int
+	err := db.QueryRow(`
+		SELECT 1 FROM user_blocks
+		WHERE (blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)`,
+		a, b, b, a).Scan(&exists)
+	return err == nil
+}
+
+// conversationMembers возвращает ID и имена участников диалога
+func conversationMembers(db *sql.DB, conversationID int) (map[int]string, error) {
+	rows, err := db.Query(`
+		SELECT u.id, u.username
+		FROM conversation_members cm
+		JOIN users u ON cm.user_id = u.id
+		WHERE cm.conversation_id = ?
+		ORDER BY u.username`, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	members := map[int]string{}
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		members[id] = name
+	}
+	return members, rows.Err()
+}
+
+// Messages обрабатывает /messages: список диалогов (GET) и начало нового диалога (POST)
+func Messages(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userID, username, ok := sessionUser(db, r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		data := InboxPageData{CurrentUser: username}
+		status := http.StatusOK
+
+		// Обработка POST-запроса: новый диалог с первым сообщением
+		if r.Method == http.MethodPost {
+			data.To, data.Content = r.FormValue("to"), normalizeText(r.FormValue("content"))
+			conversationID, errMsg := startConversation(db, userID, data.To, data.Content)
+			if errMsg == "" && conversationID == 0 {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if errMsg == "" {
+				http.Redirect(w, r, "/messages/"+strconv.Itoa(conversationID), http.StatusSeeOther)
+				return
+			}
+			data.Error = errMsg
+			status = http.StatusBadRequest
+		}
+
+		var err error
+		data.Conversations, err = queryConversations(db, userID)
+		if err != nil {
+			log.Println("Error fetching conversations:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		for _, c := range data.Conversations {
+			data.Unread += c.Unread
+		}
+
+		tmpl, err := template.ParseFiles("templates/messages.html")
+		if err != nil {
+			log.Println("Error parsing messages.html template:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(status)
+		tmpl.Execute(w, data)
+	}
+}
+
+// startConversation проверяет получателей и создаёт диалог с первым сообщением.
+// to — имена через запятую. Диалог один на один с тем же собеседником продолжается, а не создаётся заново.
+// Возвращает ID диалога или сообщение об ошибке; пустые оба значения означают внутреннюю ошибку.
+func startConversation(db *sql.DB, userID int, to, content string) (int, string) {
+	var recipients []int
+	for _, name := range strings.Split(to, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		var id int
+		err := db.QueryRow("SELECT id FROM users WHERE username = ?", name).Scan(&id)
+		if err == sql.ErrNoRows {
+			return 0, "User " + name + " not found."
+		}
+		if err != nil {
+			log.Println("Error looking up recipient:", err)
+			return 0, ""
+		}
+		if id == userID {
+			return 0, "You cannot send a message to yourself."
+		}
+		if isBlocked(db, userID, id) {
+			return 0, "You cannot message " + name + "."
+		}
+		if !containsInt(recipients, id) {
+			recipients = append(recipients, id)
+		}
+	}
+	if len(recipients) == 0 {
+		return 0, "Enter at least one recipient."
+	}
+	if len(recipients)+1 > maxConversationMembers {
+		return 0, "A conversation can have at most " + strconv.Itoa(maxConversationMembers) + " members."
+	}
+	if err := validateMessage(content); err != nil {
+		return 0, err.Error()
+	}
+
+	// Существующий диалог один на один
+	if len(recipients) == 1 {
+		var id int
+		err := db.QueryRow(`
+			SELECT cm.conversation_id
+			FROM conversation_members cm
+			WHERE cm.user_id IN (?, ?)
+			GROUP BY cm.conversation_id
+			HAVING COUNT(*) = 2
+				AND (SELECT COUNT(*) FROM conversation_members x WHERE x.conversation_id = cm.conversation_id) = 2
+			LIMIT 1`, userID, recipients[0]).Scan(&id)
+		if err == nil {
+			if _, err := sendMessage(db, id, userID, content); err != nil {
+				log.Println("Error sending message:", err)
+				return 0, ""
+			}
+			return id, ""
+		}
+		if err != sql.ErrNoRows {
+			log.Println("Error looking up conversation:", err)
+			return 0, ""
+		}
+	}
+
+	var started int
+	if err := db.QueryRow("SELECT COUNT(*) FROM conversations WHERE created_by = ? AND created_at > ?",
+		userID, time.Now().UTC().Add(-24*time.Hour)).Scan(&started); err != nil {
+		log.Println("Error counting conversations:", err)
+		return 0, ""
+	}
+	if started >= maxNewConversationsDay {
+		return 0, "You have started too many conversations today. Try again later."
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		return 0, ""
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec("INSERT INTO conversations (created_by) VALUES (?)", userID)
+	if err != nil {
+		log.Println("Error inserting conversation:", err)
+		return 0, ""
+	}
+	id64, _ := res.LastInsertId()
+	conversationID := int(id64)
+	for _, id := range append([]int{userID}, recipients...) {
+		if _, err := tx.Exec("INSERT INTO conversation_members (conversation_id, user_id) VALUES (?, ?)", conversationID, id); err != nil {
+			log.Println("Error inserting conversation member:", err)
+			return 0, ""
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing conversation:", err)
+		return 0, ""
+	}
+
+	if _, err := sendMessage(db, conversationID, userID, content); err != nil {
+		log.Println("Error sending message:", err)
+		return 0, ""
+	}
+	return conversationID, ""
+}
+
+// sendMessage добавляет сообщение, отмечает его прочитанным для отправителя
+// и сообщает остальным участникам новое число непрочитанных
+func sendMessage(db *sql.DB, conversationID, senderID int, content string) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec("INSERT INTO messages (conversation_id, sender_id, content) VALUES (?, ?, ?)", conversationID, senderID, content)
+	if err != nil {
+		return 0, err
+	}
+	id64, _ := res.LastInsertId()
+	if _, err := tx.Exec("UPDATE conversations SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", conversationID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("UPDATE conversation_members SET last_read_message_id = ? WHERE conversation_id = ? AND user_id = ?", id64, conversationID, senderID); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	members, err := conversationMembers(db, conversationID)
+	if err != nil {
+		log.Println("Error loading conversation members for event:", err)
+	}
+	for id := range members {
+		if id != senderID {
+			publishMessage(db, id)
+		}
+	}
+	return int(id64), nil
+}
+
+// queryConversations возвращает диалоги пользователя, последние активные сначала
+func queryConversations(db *sql.DB, userID int) ([]Conversation, error) {
+	rows, err := db.Query(`
+		SELECT c.id, c.updated_at,
+			COALESCE((SELECT GROUP_CONCAT(u.username, ',') FROM conversation_members x
+				JOIN users u ON u.id = x.user_id
+				WHERE x.conversation_id = c.id AND x.user_id != ?), ''),
+			COALESCE(lm.content, ''), lm.removed_at IS NOT NULL, COALESCE(lu.username, ''),
+			(SELECT COUNT(*) FROM messages m
+				WHERE m.conversation_id = c.id AND m.id > cm.last_read_message_id AND m.sender_id != ?
+					AND m.sender_id NOT IN (SELECT blocked_id FROM user_blocks WHERE blocker_id = ?))
+		FROM conversation_members cm
+		JOIN conversations c ON c.id = cm.conversation_id
+		LEFT JOIN messages lm ON lm.id = (
+			SELECT m.id FROM messages m
+			WHERE m.conversation_id = c.id
+				AND m.sender_id NOT IN (SELECT blocked_id FROM user_blocks WHERE blocker_id = ?)
+			ORDER BY m.id DESC LIMIT 1)
+		LEFT JOIN users lu ON lu.id = lm.sender_id
+		WHERE cm.user_id = ?
+		ORDER BY c.updated_at DESC, c.id DESC`, userID, userID, userID, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var conversations []Conversation
+	for rows.Next() {
+		var c Conversation
+		var updatedAt time.Time
+		var members string
+		var removed bool
+		if err := rows.Scan(&c.ID, &updatedAt, &members, &c.LastMessage, &removed, &c.LastSender, &c.Unread); err != nil {
+			return nil, err
+		}
+		if members != "" {
+			c.Members = strings.Split(members, ",")
+		}
+		if removed {
+			c.LastMessage = ""
+		}
+		c.LastMessage = excerpt(c.LastMessage, 80)
+		c.LastAt = formatDate(updatedAt)
+		conversations = append(conversations, c)
+	}
+	return conversations, rows.Err()
+}
+
+// ConversationPage обрабатывает /messages/{id}: чтение диалога (GET) и ответ (POST).
+// Доступ есть только у участников, в том числе у модераторов.
+func ConversationPage(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userID, username, ok := sessionUser(db, r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		conversationID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid conversation ID", http.StatusBadRequest)
+			return
+		}
+		members, err := conversationMembers(db, conversationID)
+		if err != nil {
+			log.Println("Error loading conversation members:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if _, ok := members[userID]; !ok {
+			http.Error(w, "Conversation not found", http.StatusNotFound)
+			return
+		}
+
+		data := ConversationPageData{CurrentUser: username, ID: conversationID, Reported: r.URL.Query().Get("reported") == "1"}
+		for id, name := range members {
+			if id != userID {
+				data.Members = append(data.Members, name)
+			}
+		}
+		sort.Strings(data.Members)
+		// В диалоге один на один блокировка любой стороны запрещает отправку
+		if len(members) == 2 {
+			for id, name := range members {
+				if id != userID {
+					data.DirectWith = name
+					if isBlocked(db, userID, id) {
+						data.BlockedBy = "You can no longer send messages in this conversation."
+					}
+				}
+			}
+		}
+		status := http.StatusOK
+
+		// Обработка POST-запроса: новое сообщение
+		if r.Method == http.MethodPost {
+			content := normalizeText(r.FormValue("content"))
+			switch err := validateMessage(content); {
+			case data.BlockedBy != "":
+				data.Error = data.BlockedBy
+				status = http.StatusForbidden
+			case err != nil:
+				data.Error = err.Error()
+				data.Content = content
+				status = http.StatusBadRequest
+			default:
+				if _, err := sendMessage(db, conversationID, userID, content); err != nil {
+					log.Println("Error sending message:", err)
+					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+					return
+				}
+				http.Redirect(w, r, "/messages/"+strconv.Itoa(conversationID), http.StatusSeeOther)
+				return
+			}
+		}
+
+		data.Messages, err = queryMessages(db, conversationID, userID)
+		if err != nil {
+			log.Println("Error fetching messages:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		// Просмотр отмечает весь диалог прочитанным
+		if _, err := db.Exec(`
+			UPDATE conversation_members
+			SET last_read_message_id = (SELECT COALESCE(MAX(id), 0) FROM messages WHERE conversation_id = ?)
+			WHERE conversation_id = ? AND user_id = ?`, conversationID, conversationID, userID); err != nil {
+			log.Println("Error marking conversation read:", err)
+		}
+		publishMessage(db, userID)
+
+		tmpl, err := template.New("conversation.html").Funcs(template.FuncMap{"nl2br": nl2br}).ParseFiles("templates/conversation.html")
+		if err != nil {
+			log.Println("Error parsing conversation.html template:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(status)
+		tmpl.Execute(w, data)
+	}
+}
+
+// queryMessages возвращает последние сообщения диалога в порядке отправки,
+// без сообщений пользователей, которых заблокировал viewerID
+func queryMessages(db *sql.DB, conversationID, viewerID int) ([]Message, error) {
+	rows, err := db.Query(`
+		SELECT id, sender_id, username, content, created_at, removed_at IS NOT NULL FROM (
+			SELECT m.id, m.sender_id, u.username, m.content, m.created_at, m.removed_at
+			FROM messages m
+			JOIN users u ON m.sender_id = u.id
+			WHERE m.conversation_id = ?
+				AND m.sender_id NOT IN (SELECT blocked_id FROM user_blocks WHERE blocker_id = ?)
+			ORDER BY m.id DESC
+			LIMIT ?)
+		ORDER BY id`, conversationID, viewerID, conversationMessageShow)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		var m Message
+		var senderID int
+		var createdAt time.Time
+		if err := rows.Scan(&m.ID, &senderID, &m.Sender, &m.Content, &createdAt, &m.Removed); err != nil {
+			return nil, err
+		}
+		m.Mine = senderID == viewerID
+		m.CreatedAt = formatDate(createdAt)
+		if m.Removed {
+			m.Content = ""
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// ReportMessage принимает жалобу участника диалога на чужое сообщение.
+// Модераторы видят только сообщения, на которые пожаловались, но не сами диалоги.
+func ReportMessage(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userID, _, ok := sessionUser(db, r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		messageID, err := strconv.Atoi(r.FormValue("message_id"))
+		if err != nil {
+			http.Error(w, "Invalid message ID", http.StatusBadRequest)
+			return
+		}
+		reason := strings.TrimSpace(r.FormValue("reason"))
+		if reason == "" || len([]rune(reason)) > maxReportReasonLength {
+			http.Error(w, "Reason must be between 1 and 200 characters", http.StatusBadRequest)
+			return
+		}
+
+		// Пожаловаться можно только на чужое сообщение в своём диалоге
+		var conversationID, senderID int
+		err = db.QueryRow(`
+			SELECT m.conversation_id, m.sender_id
+			FROM messages m
+			JOIN conversation_members cm ON cm.conversation_id = m.conversation_id AND cm.user_id = ?
+			WHERE m.id = ?`, userID, messageID).Scan(&conversationID, &senderID)
+		if err == sql.ErrNoRows || (err == nil && senderID == userID) {
+			http.Error(w, "Message not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Println("Error loading reported message:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		_, err = db.Exec("INSERT OR IGNORE INTO message_reports (message_id, reporter_id, reason) VALUES (?, ?, ?)", messageID, userID, reason)
+		if err != nil {
+			log.Println("Error inserting message report:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/messages/"+strconv.Itoa(conversationID)+"?reported=1", http.StatusSeeOther)
+	}
+}
+
+// moderatorUser возвращает ID текущего пользователя, если он модератор или администратор.
+// Гостя перенаправляет на /login, остальным отвечает 403.
+func moderatorUser(db *sql.DB, w http.ResponseWriter, r *http.Request) (userID int, username string, ok bool) {
+	cookie, err := r.Cookie("session_id")
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return 0, "", false
+	}
+	var role string
+	err = db.QueryRow("SELECT u.id, u.username, u.role FROM sessions s JOIN users u ON s.user_id = u.id WHERE s.id = ? AND s.expiry > ?", cookie.Value, time.Now()).Scan(&userID, &username, &role)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return 0, "", false
+	}
+	if !isModeratorRole(role) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return 0, "", false
+	}
+	return userID, username, true
+}
+
+// ModerationReports показывает модераторам открытые жалобы на сообщения
+func ModerationReports(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		_, username, ok := moderatorUser(db, w, r)
+		if !ok {
+			return
+		}
+
+		rows, err := db.Query(`
+			SELECT mr.id, m.id, s.username, rp.username, mr.reason, m.content, mr.created_at
+			FROM message_reports mr
+			JOIN messages m ON mr.message_id = m.id
+			JOIN users s ON m.sender_id = s.id
+			JOIN users rp ON mr.reporter_id = rp.id
+			WHERE mr.status = ?
+			ORDER BY mr.created_at, mr.id`, reportOpen)
+		if err != nil {
+			log.Println("Error fetching message reports:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+		data := ReportsPageData{CurrentUser: username}
+		for rows.Next() {
+			var rep MessageReport
+			var createdAt time.Time
+			if err := rows.Scan(&rep.ID, &rep.MessageID, &rep.Sender, &rep.Reporter, &rep.Reason, &rep.Content, &createdAt); err != nil {
+				log.Println("Error scanning message report:", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			rep.CreatedAt = formatDate(createdAt)
+			data.Reports = append(data.Reports, rep)
+		}
+
+		tmpl, err := template.New("moderation_reports.html").Funcs(template.FuncMap{"nl2br": nl2br}).ParseFiles("templates/moderation_reports.html")
+		if err != nil {
+			log.Println("Error parsing moderation_reports.html template:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		tmpl.Execute(w, data)
+	}
+}
+
+// ResolveReport закрывает жалобу: action=dismiss оставляет сообщение,
+// action=remove скрывает его и закрывает все жалобы на это сообщение
+func ResolveReport(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		moderatorID, _, ok := moderatorUser(db, w, r)
+		if !ok {
+			return
+		}
+		reportID, err := strconv.Atoi(r.FormValue("report_id"))
+		if err != nil {
+			http.Error(w, "Invalid report ID", http.StatusBadRequest)
+			return
+		}
+		var messageID int
+		err = db.QueryRow("SELECT message_id FROM message_reports WHERE id = ? AND status = ?", reportID, reportOpen).Scan(&messageID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Report not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Println("Error loading message report:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		now := time.Now()
+		switch r.FormValue("action") {
+		case "dismiss":
+			_, err = db.Exec("UPDATE message_reports SET status = ?, resolved_by = ?, resolved_at = ? WHERE id = ?",
+				reportDismissed, moderatorID, now, reportID)
+		case "remove":
+			_, err = db.Exec("UPDATE messages SET removed_at = ? WHERE id = ?", now, messageID)
+			if err == nil {
+				_, err = db.Exec("UPDATE message_reports SET status = ?, resolved_by = ?, resolved_at = ? WHERE message_id = ? AND status = ?",
+					reportRemoved, moderatorID, now, messageID, reportOpen)
+			}
+		default:
+			http.Error(w, "Invalid action", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Println("Error resolving message report:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/moderation/reports", http.StatusSeeOther)
+	}
+}
+
+// AccountBlocks обрабатывает /account/blocks: список заблокированных (GET) и блокировка по имени (POST)
+func AccountBlocks(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userID, username, ok := sessionUser(db, r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		data := BlocksPageData{CurrentUser: username}
+		status := http.StatusOK
+
+		// Обработка POST-запроса: блокировка пользователя
+		if r.Method == http.MethodPost {
+			name := strings.TrimSpace(r.FormValue("username"))
+			var blockedID int
+			err := db.QueryRow("SELECT id FROM users WHERE username = ?", name).Scan(&blockedID)
+			switch {
+			case err == sql.ErrNoRows:
+				data.Error = "User " + name + " not found."
+			case err != nil:
+				log.Println("Error looking up user to block:", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			case blockedID == userID:
+				data.Error = "You cannot block yourself."
+			default:
+				if _, err := db.Exec("INSERT OR IGNORE INTO user_blocks (blocker_id, blocked_id) VALUES (?, ?)", userID, blockedID); err != nil {
+					log.Println("Error blocking user:", err)
+					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+					return
+				}
+				publishMessage(db, userID) // Непрочитанные от заблокированного больше не считаются
+				http.Redirect(w, r, "/account/blocks", http.StatusSeeOther)
+				return
+			}
+			status = http.StatusBadRequest
+		}
+
+		rows, err := db.Query(`
+			SELECT u.username, b.created_at
+			FROM user_blocks b
+			JOIN users u ON b.blocked_id = u.id
+			WHERE b.blocker_id = ?
+			ORDER BY u.username`, userID)
+		if err != nil {
+			log.Println("Error fetching blocked users:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var b BlockedUser
+			var since time.Time
+			if err := rows.Scan(&b.Username, &since); err != nil {
+				log.Println("Error scanning blocked user:", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			b.Since = formatDate(since)
+			data.Blocked = append(data.Blocked, b)
+		}
+
+		tmpl, err := template.ParseFiles("templates/account_blocks.html")
+		if err != nil {
+			log.Println("Error parsing account_blocks.html template:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(status)
+		tmpl.Execute(w, data)
+	}
+}
+
+// UnblockUser снимает блокировку пользователя
+func UnblockUser(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userID, _, ok := sessionUser(db, r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		_, err := db.Exec(`
+			DELETE FROM user_blocks
+			WHERE blocker_id = ? AND blocked_id = (SELECT id FROM users WHERE username = ?)`,
+			userID, r.FormValue("username"))
+		if err != nil {
+			log.Println("Error unblocking user:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		publishMessage(db, userID)
+		http.Redirect(w, r, "/account/blocks", http.StatusSeeOther)
+	}
+}
+
+// containsInt сообщает, есть ли число в срезе
+func containsInt(list []int, n int) bool {
+	for _, v := range list {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
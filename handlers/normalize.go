@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// normalizeText приводит пользовательский текст к виду для хранения: переводы строк — \n,
+// управляющие символы (кроме табуляции и перевода строки) и символы переопределения
+// направления текста удаляются, затем выполняется нормализация Unicode NFC.
+// Остальное сохраняется как набрано: пробелы, пустые строки, отступы и адреса.
+func normalizeText(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\r':
+			return '\n'
+		case r == '\n' || r == '\t':
+			return r
+		case unicode.IsControl(r), isBidiControl(r), r == unicode.ReplacementChar:
+			return -1
+		}
+		return r
+	}, s)
+	return norm.NFC.String(s)
+}
+
+// isBidiControl сообщает, меняет ли символ направление текста (U+202A–U+202E, U+2066–U+2069):
+// такими символами можно визуально переставить текст поста
+func isBidiControl(r rune) bool {
+	return (r >= 0x202A && r <= 0x202E) || (r >= 0x2066 && r <= 0x2069)
+}
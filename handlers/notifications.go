@@ -0,0 +1,369 @@
+package handlers
+
+import (
+	"database/sql"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Типы уведомлений
+const (
+	notifyComment     = "comment"      // Комментарий к посту пользователя
+	notifyPostLike    = "post_like"    // Лайк поста пользователя
+	notifyCommentLike = "comment_like" // Лайк комментария пользователя
+	notifyReply       = "reply"        // Комментарий в теме, на которую подписан пользователь
+	notifyMention     = "mention"      // Упоминание @username в посте или комментарии
+)
+
+// Сколько последних уведомлений показывать на странице /notifications
+const notificationsPageSize = 200
+
+// NotificationType — тип уведомлений и его подпись в настройках
+type NotificationType struct {
+	Type    string
+	Label   string
+	Enabled bool
+}
+
+// notificationTypes — все типы уведомлений в порядке показа в настройках
+var notificationTypes = []NotificationType{
+	{Type: notifyComment, Label: "Comments on my posts"},
+	{Type: notifyPostLike, Label: "Likes on my posts"},
+	{Type: notifyCommentLike, Label: "Likes on my comments"},
+	{Type: notifyReply, Label: "Replies in threads I follow"},
+	{Type: notifyMention, Label: "Mentions of me"},
+}
+
+// NotificationGroup — уведомления одного типа об одном объекте,
+// например "alice and 4 others liked your post"
+type NotificationGroup struct {
+	Type      string
+	PostID    int
+	CommentID int
+	Message   string
+	Link      string
+	Unread    bool
+	Count     int
+	LatestAt  string
+}
+
+// NotificationsPageData — данные для шаблона notifications.html
+type NotificationsPageData struct {
+	CurrentUser string
+	Unread      int
+	Groups      []NotificationGroup
+	Types       []NotificationType
+}
+
+// nullableID возвращает NULL для нулевого ID
+func nullableID(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// notify создаёт уведомление для recipientID о действии actorID.
+// Уведомления о собственных действиях, повторные и отключённые пользователем не создаются.
+// Ошибки только логируются: уведомление не должно мешать основному действию.
+func notify(db *sql.DB, recipientID, actorID int, kind string, postID, commentID int) {
+	if recipientID == 0 || recipientID == actorID {
+		return
+	}
+	var skip bool
+	err := db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM notification_optouts WHERE user_id = ? AND type = ?)
+			OR EXISTS(SELECT 1 FROM notifications
+				WHERE user_id = ? AND actor_id = ? AND type = ? AND post_id IS ? AND comment_id IS ?)`,
+		recipientID, kind, recipientID, actorID, kind, nullableID(postID), nullableID(commentID),
+	).Scan(&skip)
+	if err != nil {
+		log.Println("Error checking notification:", err)
+		return
+	}
+	if skip {
+		return
+	}
+	_, err = db.Exec("INSERT INTO notifications (user_id, actor_id, type, post_id, comment_id) VALUES (?, ?, ?, ?, ?)",
+		recipientID, actorID, kind, nullableID(postID), nullableID(commentID))
+	if err != nil {
+		log.Println("Error creating notification:", err)
+		return
+	}
+	publishNotification(db, recipientID)
+}
+
+// withdrawNotification удаляет непрочитанное уведомление, если действие отменено (например, снят лайк)
+func withdrawNotification(db *sql.DB, recipientID, actorID int, kind string, postID, commentID int) {
+	res, err := db.Exec("DELETE FROM notifications WHERE user_id = ? AND actor_id = ? AND type = ? AND post_id IS ? AND comment_id IS ? AND read_at IS NULL",
+		recipientID, actorID, kind, nullableID(postID), nullableID(commentID))
+	if err != nil {
+		log.Println("Error withdrawing notification:", err)
+		return
+	}
+	if count, _ := res.RowsAffected(); count > 0 {
+		publishNotification(db, recipientID)
+	}
+}
+
+// unreadNotifications возвращает количество непрочитанных уведомлений пользователя
+func unreadNotifications(db *sql.DB, userID int) int {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM notifications WHERE user_id = ? AND read_at IS NULL", userID).Scan(&count); err != nil {
+		log.Println("Error counting notifications:", err)
+	}
+	return count
+}
+
+// queryNotificationGroups выбирает последние уведомления пользователя и группирует
+// их по типу и объекту. Группы упорядочены по самому свежему уведомлению.
+func queryNotificationGroups(db *sql.DB, userID int) ([]NotificationGroup, error) {
+	rows, err := db.Query(`
+		SELECT n.type, COALESCE(n.post_id, 0), COALESCE(n.comment_id, 0), n.created_at, n.read_at IS NULL,
+			u.username, COALESCE(p.title, '')
+		FROM notifications n
+		JOIN users u ON n.actor_id = u.id
+		LEFT JOIN posts p ON n.post_id = p.id
+		WHERE n.user_id = ?
+		ORDER BY n.created_at DESC, n.id DESC
+		LIMIT ?`, userID, notificationsPageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []NotificationGroup
+	index := map[string]int{}
+	actors := map[string][]string{}
+	titles := map[string]string{}
+	for rows.Next() {
+		var g NotificationGroup
+		var createdAt time.Time
+		var actor, title string
+		if err := rows.Scan(&g.Type, &g.PostID, &g.CommentID, &createdAt, &g.Unread, &actor, &title); err != nil {
+			return nil, err
+		}
+		key := g.Type + ":" + strconv.Itoa(g.PostID) + ":" + strconv.Itoa(g.CommentID)
+		i, seen := index[key]
+		if !seen {
+			g.LatestAt = formatDate(createdAt)
+			index[key] = len(groups)
+			titles[key] = title
+			groups = append(groups, g)
+			i = len(groups) - 1
+		}
+		groups[i].Count++
+		groups[i].Unread = groups[i].Unread || g.Unread
+		if !containsString(actors[key], actor) {
+			actors[key] = append(actors[key], actor)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range groups {
+		g := &groups[i]
+		key := g.Type + ":" + strconv.Itoa(g.PostID) + ":" + strconv.Itoa(g.CommentID)
+		g.Message = notificationMessage(g.Type, actors[key], titles[key])
+		g.Link = "/posts#post-" + strconv.Itoa(g.PostID)
+		if g.CommentID != 0 {
+			g.Link = "/posts#comment-" + strconv.Itoa(g.CommentID)
+		}
+	}
+	return groups, nil
+}
+
+// notificationMessage формирует текст группы: "alice, bob and 3 others liked your post "Title""
+func notificationMessage(kind string, actors []string, title string) string {
+	var who string
+	switch {
+	case len(actors) == 1:
+		who = actors[0]
+	case len(actors) == 2:
+		who = actors[0] + " and " + actors[1]
+	case len(actors) == 3:
+		who = actors[0] + ", " + actors[1] + " and " + actors[2]
+	default:
+		who = actors[0] + ", " + actors[1] + " and " + strconv.Itoa(len(actors)-2) + " others"
+	}
+
+	var what string
+	switch kind {
+	case notifyComment:
+		what = "commented on your post"
+	case notifyPostLike:
+		what = "liked your post"
+	case notifyCommentLike:
+		what = "liked your comment on"
+	case notifyReply:
+		what = "replied in"
+	case notifyMention:
+		what = "mentioned you in"
+	default:
+		what = "interacted with"
+	}
+	if title == "" {
+		return who + " " + what + " a deleted post"
+	}
+	return who + " " + what + " \"" + title + "\""
+}
+
+// queryNotificationTypes возвращает типы уведомлений с учётом отключённых пользователем
+func queryNotificationTypes(db *sql.DB, userID int) ([]NotificationType, error) {
+	rows, err := db.Query("SELECT type FROM notification_optouts WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var optouts []string
+	for rows.Next() {
+		var kind string
+		if err := rows.Scan(&kind); err != nil {
+			return nil, err
+		}
+		optouts = append(optouts, kind)
+	}
+
+	types := make([]NotificationType, len(notificationTypes))
+	for i, t := range notificationTypes {
+		t.Enabled = !containsString(optouts, t.Type)
+		types[i] = t
+	}
+	return types, rows.Err()
+}
+
+// Notifications показывает страницу /notifications
+func Notifications(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userID, username, ok := sessionUser(db, r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		groups, err := queryNotificationGroups(db, userID)
+		if err != nil {
+			log.Println("Error querying notifications:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		types, err := queryNotificationTypes(db, userID)
+		if err != nil {
+			log.Println("Error querying notification preferences:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		data := NotificationsPageData{
+			CurrentUser: username,
+			Unread:      unreadNotifications(db, userID),
+			Groups:      groups,
+			Types:       types,
+		}
+		tmpl, err := template.ParseFiles("templates/notifications.html")
+		if err != nil {
+			log.Println("Error parsing notifications.html template:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		tmpl.Execute(w, data)
+	}
+}
+
+// MarkNotificationsRead отмечает прочитанными все уведомления (all=1)
+// или одну группу (type, post_id, comment_id)
+func MarkNotificationsRead(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userID, _, ok := sessionUser(db, r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		var err error
+		if r.FormValue("all") == "1" {
+			_, err = db.Exec("UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE user_id = ? AND read_at IS NULL", userID)
+		} else {
+			postID, _ := strconv.Atoi(r.FormValue("post_id"))
+			commentID, _ := strconv.Atoi(r.FormValue("comment_id"))
+			_, err = db.Exec(`UPDATE notifications SET read_at = CURRENT_TIMESTAMP
+				WHERE user_id = ? AND type = ? AND post_id IS ? AND comment_id IS ? AND read_at IS NULL`,
+				userID, r.FormValue("type"), nullableID(postID), nullableID(commentID))
+		}
+		if err != nil {
+			log.Println("Error marking notifications read:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		publishNotification(db, userID)
+
+		// Переход по ссылке уведомления после отметки о прочтении
+		if next := r.FormValue("next"); strings.HasPrefix(next, "/posts") {
+			http.Redirect(w, r, next, http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+	}
+}
+
+// NotificationPreferences сохраняет включённые типы уведомлений; неотмеченные типы отключаются
+func NotificationPreferences(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userID, _, ok := sessionUser(db, r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			log.Println("Error starting transaction:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.Exec("DELETE FROM notification_optouts WHERE user_id = ?", userID); err != nil {
+			log.Println("Error saving notification preferences:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		for _, t := range notificationTypes {
+			if containsString(r.Form["enabled"], t.Type) {
+				continue
+			}
+			if _, err := tx.Exec("INSERT INTO notification_optouts (user_id, type) VALUES (?, ?)", userID, t.Type); err != nil {
+				log.Println("Error saving notification preferences:", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			log.Println("Error saving notification preferences:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,406 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiRoute — маршрут JSON API. По этому списку регистрируются обработчики
+// и проверяется, что у каждого маршрута есть описание в спецификации.
+type apiRoute struct {
+	Pattern string
+	Handler func(db *sql.DB) http.HandlerFunc
+}
+
+var apiRoutes = []apiRoute{
+	{"/api/openapi.json", func(*sql.DB) http.HandlerFunc { return OpenAPI() }},
+	{"/api/v1/posts", APIPosts},
+	{"/api/v1/posts/{id}", APIPost},
+	{"/api/v1/posts/{id}/comments", APIPostComments},
+	{"/api/v1/posts/{id}/vote", APIPostVote},
+	{"/api/v1/comments/{id}", APIComment},
+	{"/api/v1/comments/{id}/vote", APICommentVote},
+	{"/api/v1/categories", APICategories},
+	{"/api/v1/categories/{id}", APICategory},
+	{"/api/v1/categories/{id}/merge", APICategoryMerge},
+	{"/api/v1/tags", APITags},
+
+	// Адреса, которые страницы форума вызывают через fetch
+	{"/post/delete", DeletePost},
+	{"/comment/delete", DeleteComment},
+	{"/drafts/save", SaveDraft},
+}
+
+// RegisterAPI регистрирует все маршруты JSON API в mux.
+// Неизвестные адреса под /api/ получают JSON-ошибку 404.
+func RegisterAPI(mux *http.ServeMux, db *sql.DB) {
+	for _, route := range apiRoutes {
+		mux.HandleFunc(route.Pattern, route.Handler(db))
+	}
+	mux.HandleFunc("/api/", APINotFound())
+}
+
+// apiParam — параметр операции в пути или строке запроса
+type apiParam struct {
+	Name        string
+	In          string // path или query
+	Type        string // integer или string
+	Enum        []string
+	Description string
+}
+
+// apiOperation — описание одной операции API для спецификации OpenAPI
+type apiOperation struct {
+	Method      string
+	Path        string
+	Summary     string
+	Scope       string // Требуемое право; пустая строка — операция без аутентификации
+	Required    bool   // true — анонимный запрос получает 401
+	SessionOnly bool   // true — только сессионная кука, токены не принимаются
+	NotFound    bool   // true — 404, если нет объекта, ID которого передан в теле
+	Params      []apiParam
+	Body        interface{} // Тип тела запроса или готовая схема (map), nil — без тела
+	Form        bool        // true — тело в формате multipart/form-data, а не JSON
+	Status      int         // Код успешного ответа
+	Response    interface{} // Тип тела успешного ответа, nil — пустое тело
+	Description string
+}
+
+var (
+	idParam    = apiParam{Name: "id", In: "path", Type: "integer"}
+	pageParams = []apiParam{
+		{Name: "page", In: "query", Type: "integer", Description: "Page number, starting from 1"},
+		{Name: "per_page", In: "query", Type: "integer", Description: "Posts per page, 1-100 (default 20)"},
+		{Name: "filter", In: "query", Type: "string", Enum: []string{"created", "liked", "following", "saved"}, Description: "Only posts created, liked or bookmarked by the current user, or posts from followed users and categories; requires authentication"},
+		{Name: "category", In: "query", Type: "string", Description: "Category slug (the category name is accepted too)"},
+		{Name: "tag", In: "query", Type: "string", Description: "Only posts with this tag; normalized like tags on posts"},
+	}
+	openAPIDocument = map[string]interface{}{"type": "object"}
+	// Поля формы создания поста, которые присылает автосохранение черновика
+	draftForm = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"draft_id":           map[string]interface{}{"type": "integer", "description": "Draft to update; omitted or 0 creates a new draft"},
+			"title":              map[string]interface{}{"type": "string"},
+			"content":            map[string]interface{}{"type": "string"},
+			"tags":               map[string]interface{}{"type": "string", "description": "Comma-separated tags"},
+			"categories":         map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "integer"}},
+			"image":              map[string]interface{}{"type": "string", "format": "binary"},
+			"remove_draft_image": map[string]interface{}{"type": "string", "enum": []string{"on"}, "description": "Drop the image saved with the draft"},
+		},
+	}
+)
+
+// apiOperations — все операции JSON API. Схемы тел строятся по типам DTO из api.go,
+// поэтому изменение структуры ответа сразу отражается в спецификации.
+var apiOperations = []apiOperation{
+	{Method: http.MethodGet, Path: "/api/openapi.json", Summary: "This OpenAPI document", Status: http.StatusOK, Response: openAPIDocument},
+
+	{Method: http.MethodGet, Path: "/api/v1/posts", Summary: "List posts", Scope: scopeRead, Params: pageParams, Status: http.StatusOK, Response: apiPostList{}},
+	{Method: http.MethodPost, Path: "/api/v1/posts", Summary: "Create a post", Scope: scopeWrite, Required: true, Body: apiPostInput{}, Status: http.StatusCreated, Response: apiPost{}},
+	{Method: http.MethodGet, Path: "/api/v1/posts/{id}", Summary: "Get a post", Scope: scopeRead, Params: []apiParam{idParam}, Status: http.StatusOK, Response: apiPost{}},
+	{Method: http.MethodPut, Path: "/api/v1/posts/{id}", Summary: "Edit own post", Scope: scopeWrite, Required: true, Params: []apiParam{idParam}, Body: apiPostInput{}, Status: http.StatusOK, Response: apiPost{},
+		Description: "Omitted category_ids and tags keep the current categories and tags."},
+	{Method: http.MethodDelete, Path: "/api/v1/posts/{id}", Summary: "Delete a post", Scope: scopeWrite, Required: true, Params: []apiParam{idParam}, Status: http.StatusNoContent,
+		Description: "Authors can delete their own posts; tokens with the moderate scope can delete any post."},
+	{Method: http.MethodPost, Path: "/api/v1/posts/{id}/vote", Summary: "Vote for a post", Scope: scopeWrite, Required: true, Params: []apiParam{idParam}, Body: apiVoteInput{}, Status: http.StatusOK, Response: apiVoteResult{},
+		Description: "value: 1 — like, -1 — dislike, 0 — remove the vote."},
+
+	{Method: http.MethodGet, Path: "/api/v1/posts/{id}/comments", Summary: "List comments of a post", Scope: scopeRead, Params: []apiParam{idParam}, Status: http.StatusOK, Response: []apiComment{}},
+	{Method: http.MethodPost, Path: "/api/v1/posts/{id}/comments", Summary: "Add a comment", Scope: scopeWrite, Required: true, Params: []apiParam{idParam}, Body: apiCommentInput{}, Status: http.StatusCreated, Response: apiComment{}},
+	{Method: http.MethodGet, Path: "/api/v1/comments/{id}", Summary: "Get a comment", Scope: scopeRead, Params: []apiParam{idParam}, Status: http.StatusOK, Response: apiComment{}},
+	{Method: http.MethodPut, Path: "/api/v1/comments/{id}", Summary: "Edit own comment", Scope: scopeWrite, Required: true, Params: []apiParam{idParam}, Body: apiCommentInput{}, Status: http.StatusOK, Response: apiComment{}},
+	{Method: http.MethodDelete, Path: "/api/v1/comments/{id}", Summary: "Delete a comment", Scope: scopeWrite, Required: true, Params: []apiParam{idParam}, Status: http.StatusNoContent,
+		Description: "Authors can delete their own comments; tokens with the moderate scope can delete any comment."},
+	{Method: http.MethodPost, Path: "/api/v1/comments/{id}/vote", Summary: "Vote for a comment", Scope: scopeWrite, Required: true, Params: []apiParam{idParam}, Body: apiVoteInput{}, Status: http.StatusOK, Response: apiVoteResult{},
+		Description: "value: 1 — like, -1 — dislike, 0 — remove the vote."},
+
+	{Method: http.MethodGet, Path: "/api/v1/categories", Summary: "List categories", Scope: scopeRead, Status: http.StatusOK, Response: []apiCategoryDetail{},
+		Params:      []apiParam{{Name: "include_archived", In: "query", Type: "boolean", Description: "Include archived categories"}},
+		Description: "Categories in filter bar order."},
+	{Method: http.MethodPost, Path: "/api/v1/categories", Summary: "Create a category", Scope: scopeAdmin, Required: true, Body: apiCategoryInput{}, Status: http.StatusCreated, Response: apiCategoryDetail{},
+		Description: "name is required; an omitted slug is generated from the name. The category is added at the end of the filter bar unless position is given."},
+	{Method: http.MethodGet, Path: "/api/v1/categories/{id}", Summary: "Get a category", Scope: scopeRead, Params: []apiParam{idParam}, Status: http.StatusOK, Response: apiCategoryDetail{}},
+	{Method: http.MethodPut, Path: "/api/v1/categories/{id}", Summary: "Edit a category", Scope: scopeAdmin, Required: true, Params: []apiParam{idParam}, Body: apiCategoryInput{}, Status: http.StatusOK, Response: apiCategoryDetail{},
+		Description: "Omitted fields keep their current values. Archived categories keep their posts but accept no new ones."},
+	{Method: http.MethodPost, Path: "/api/v1/categories/{id}/merge", Summary: "Merge a category into another", Scope: scopeAdmin, Required: true, Params: []apiParam{idParam}, Body: apiCategoryMergeInput{}, Status: http.StatusOK, Response: apiCategoryDetail{},
+		Description: "Moves posts, follows and webhooks to the category given in into, deletes this category and returns the target."},
+
+	{Method: http.MethodDelete, Path: "/post/delete", Summary: "Delete own post from the site", Scope: scopeWrite, Required: true, SessionOnly: true, NotFound: true, Body: apiPostDeleteInput{}, Status: http.StatusNoContent,
+		Description: "Called by the post pages. Only the author can delete the post."},
+	{Method: http.MethodDelete, Path: "/comment/delete", Summary: "Delete own comment from the site", Scope: scopeWrite, Required: true, SessionOnly: true, NotFound: true, Body: apiCommentDeleteInput{}, Status: http.StatusNoContent,
+		Description: "Called by the post pages. Only the author can delete the comment."},
+	{Method: http.MethodPost, Path: "/drafts/save", Summary: "Autosave the post form as a draft", Scope: scopeWrite, Required: true, SessionOnly: true, NotFound: true, Body: draftForm, Form: true, Status: http.StatusOK, Response: apiDraftSaved{},
+		Description: "Called by the post creation page. Takes the same fields as the form; an empty form without draft_id is not saved and returns id 0."},
+
+	{Method: http.MethodGet, Path: "/api/v1/tags", Summary: "List tags", Scope: scopeRead, Status: http.StatusOK, Response: []apiTag{},
+		Params: []apiParam{
+			{Name: "q", In: "query", Type: "string", Description: "Only tags starting with this prefix"},
+			{Name: "limit", In: "query", Type: "integer", Description: "Number of tags, 1-100 (default 10)"},
+		},
+		Description: "Tags that mark at least one post, most used first. Used for tag autocomplete."},
+}
+
+// errorStatuses возвращает коды ошибок, которые может вернуть операция:
+// 400 — неверные параметры или тело, 401/403 — аутентификация и права, 404 — нет объекта по {id} или из тела.
+func (op apiOperation) errorStatuses() []int {
+	if op.Scope == "" {
+		return nil
+	}
+	var statuses []int
+	if op.Body != nil || len(op.Params) > 0 {
+		statuses = append(statuses, http.StatusBadRequest)
+	}
+	statuses = append(statuses, http.StatusUnauthorized, http.StatusForbidden)
+	if strings.Contains(op.Path, "{id}") || op.NotFound {
+		statuses = append(statuses, http.StatusNotFound)
+	}
+	return append(statuses, http.StatusInternalServerError)
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIJSON []byte
+)
+
+// openAPISpec возвращает спецификацию в формате JSON; строится один раз
+func openAPISpec() []byte {
+	openAPIOnce.Do(func() {
+		data, err := json.MarshalIndent(buildOpenAPI(), "", "  ")
+		if err != nil {
+			panic("openapi: " + err.Error())
+		}
+		openAPIJSON = data
+	})
+	return openAPIJSON
+}
+
+// OpenAPI отдаёт спецификацию OpenAPI 3 по адресу /api/openapi.json
+func OpenAPI() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			apiMethodNotAllowed(w, http.MethodGet)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write(openAPISpec())
+	}
+}
+
+// buildOpenAPI собирает документ OpenAPI из apiOperations и типов DTO
+func buildOpenAPI() map[string]interface{} {
+	schemas := map[string]interface{}{}
+	errorRef := schemaFor(reflect.TypeOf(apiError{}), schemas)
+
+	paths := map[string]interface{}{}
+	for _, op := range apiOperations {
+		item, _ := paths[op.Path].(map[string]interface{})
+		if item == nil {
+			item = map[string]interface{}{}
+			paths[op.Path] = item
+		}
+
+		operation := map[string]interface{}{
+			"summary":     op.Summary,
+			"operationId": operationID(op),
+		}
+		if op.Description != "" {
+			operation["description"] = op.Description
+		}
+		if op.Scope != "" {
+			operation["x-required-scope"] = op.Scope
+			security := []interface{}{
+				map[string]interface{}{"bearerAuth": []string{}},
+				map[string]interface{}{"sessionCookie": []string{}},
+			}
+			if op.SessionOnly {
+				security = security[1:]
+			}
+			if !op.Required {
+				// Пустой объект — анонимный доступ тоже разрешён
+				security = append(security, map[string]interface{}{})
+			}
+			operation["security"] = security
+		} else {
+			operation["security"] = []interface{}{}
+		}
+
+		if len(op.Params) > 0 {
+			var params []interface{}
+			for _, p := range op.Params {
+				schema := map[string]interface{}{"type": p.Type}
+				if p.Type == "integer" {
+					schema["minimum"] = 1
+				}
+				if len(p.Enum) > 0 {
+					schema["enum"] = p.Enum
+				}
+				param := map[string]interface{}{
+					"name":     p.Name,
+					"in":       p.In,
+					"required": p.In == "path",
+					"schema":   schema,
+				}
+				if p.Description != "" {
+					param["description"] = p.Description
+				}
+				params = append(params, param)
+			}
+			operation["parameters"] = params
+		}
+
+		if op.Body != nil {
+			content := jsonContent(bodySchema(op.Body, schemas))
+			if op.Form {
+				content = map[string]interface{}{"multipart/form-data": content["application/json"]}
+			}
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  content,
+			}
+		}
+
+		responses := map[string]interface{}{}
+		success := map[string]interface{}{"description": http.StatusText(op.Status)}
+		if op.Response != nil {
+			success["content"] = jsonContent(bodySchema(op.Response, schemas))
+		}
+		if op.Status == http.StatusCreated {
+			success["headers"] = map[string]interface{}{
+				"Location": map[string]interface{}{
+					"description": "URL of the created resource",
+					"schema":      map[string]interface{}{"type": "string"},
+				},
+			}
+		}
+		responses[strconv.Itoa(op.Status)] = success
+		for _, status := range op.errorStatuses() {
+			responses[strconv.Itoa(status)] = map[string]interface{}{
+				"description": http.StatusText(status),
+				"content":     jsonContent(errorRef),
+			}
+		}
+		operation["responses"] = responses
+
+		item[strings.ToLower(op.Method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "Forum API",
+			"version":     "1.0.0",
+			"description": "JSON API of the forum. Errors always have the form {\"error\": {\"status\", \"code\", \"message\"}}; unsupported methods return 405 with an Allow header.",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": tokenPrefix + "...",
+					"description":  "Personal API token created on /account/tokens. The x-required-scope of an operation must be granted to the token.",
+				},
+				"sessionCookie": map[string]interface{}{
+					"type":        "apiKey",
+					"in":          "cookie",
+					"name":        "session_id",
+					"description": "Browser session; has every scope allowed by the user's role.",
+				},
+			},
+		},
+	}
+}
+
+// operationID строит идентификатор операции вида getApiV1PostsId
+func operationID(op apiOperation) string {
+	id := strings.ToLower(op.Method)
+	for _, part := range strings.FieldsFunc(op.Path, func(r rune) bool {
+		return r == '/' || r == '{' || r == '}' || r == '.'
+	}) {
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return id
+}
+
+// jsonContent оборачивает схему в описание тела application/json
+func jsonContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+// bodySchema возвращает схему тела запроса или ответа: готовую схему (map) или построенную по типу
+func bodySchema(v interface{}, schemas map[string]interface{}) map[string]interface{} {
+	if schema, ok := v.(map[string]interface{}); ok {
+		return schema
+	}
+	return schemaFor(reflect.TypeOf(v), schemas)
+}
+
+// schemaFor строит JSON-схему для типа Go. Структуры попадают в components/schemas
+// под именем без префикса api (apiPost → Post) и подставляются ссылкой.
+// Поля без omitempty считаются обязательными, лишние поля запрещены.
+func schemaFor(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := schemaFor(t.Elem(), schemas)
+		schema["nullable"] = true
+		return schema
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": schemaFor(t.Elem(), schemas)}
+	case reflect.Int, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Struct:
+		name := strings.TrimPrefix(t.Name(), "api")
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + name}
+		if _, ok := schemas[name]; ok {
+			return ref
+		}
+		schemas[name] = nil // защита от рекурсии
+
+		properties := map[string]interface{}{}
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if tag == "-" || !field.IsExported() {
+				continue
+			}
+			fieldName, opts, _ := strings.Cut(tag, ",")
+			if fieldName == "" {
+				fieldName = field.Name
+			}
+			properties[fieldName] = schemaFor(field.Type, schemas)
+			if opts != "omitempty" {
+				required = append(required, fieldName)
+			}
+		}
+		sort.Strings(required)
+
+		schema := map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		schemas[name] = schema
+		return ref
+	}
+	panic("openapi: unsupported type " + t.String())
+}
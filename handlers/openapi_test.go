@@ -0,0 +1,438 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"01.tomorrow-school.ai/git/zsakhipo/forum/database"
+)
+
+// openTestDB создаёт пустую базу со схемой форума во временном каталоге теста
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db := database.Init(filepath.Join(t.TempDir(), "forum.db"))
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// contractStep — один запрос сценария проверки API
+type contractStep struct {
+	Method string
+	Path   string            // {post}, {comment} и {category} заменяются на ID, созданные предыдущими шагами
+	Auth   string            // author — токен read,write; reader — токен read; admin — токен администратора; session — сессия автора; other — сессия другого пользователя; invalid — неверный токен
+	Body   string            // Подстановки те же, что в Path
+	Form   map[string]string // Поля multipart/form-data вместо JSON-тела
+	Status int               // Ожидаемый код ответа
+	Save   string            // Сохранить ID из заголовка Location под этим именем
+}
+
+// contractSteps проходит по всем операциям API, включая основные ошибки
+var contractSteps = []contractStep{
+	{Method: "GET", Path: "/api/openapi.json", Status: 200},
+	{Method: "POST", Path: "/api/openapi.json", Status: 405},
+	{Method: "GET", Path: "/api/v1/categories", Status: 200},
+	{Method: "GET", Path: "/api/v1/categories", Auth: "invalid", Status: 401},
+	{Method: "GET", Path: "/api/v1/categories?include_archived=maybe", Status: 400},
+	{Method: "PATCH", Path: "/api/v1/categories", Status: 405},
+	{Method: "POST", Path: "/api/v1/categories", Body: `{"name":"Contract"}`, Status: 401},
+	{Method: "POST", Path: "/api/v1/categories", Auth: "author", Body: `{"name":"Contract"}`, Status: 403},
+	{Method: "POST", Path: "/api/v1/categories", Auth: "admin", Body: `{"name":" "}`, Status: 400},
+	{Method: "POST", Path: "/api/v1/categories", Auth: "admin", Body: `{"name":"Contract","color":"#3b82f6","icon":"code"}`, Status: 201, Save: "category"},
+	{Method: "GET", Path: "/api/v1/categories/{category}", Status: 200},
+	{Method: "GET", Path: "/api/v1/categories/abc", Status: 400},
+	{Method: "GET", Path: "/api/v1/categories/999999", Status: 404},
+	{Method: "PUT", Path: "/api/v1/categories/{category}", Auth: "author", Body: `{"archived":true}`, Status: 403},
+	{Method: "PUT", Path: "/api/v1/categories/{category}", Auth: "admin", Body: `{"color":"blue"}`, Status: 400},
+	{Method: "PUT", Path: "/api/v1/categories/{category}", Auth: "admin", Body: `{"posting":"sometimes"}`, Status: 400},
+	{Method: "PUT", Path: "/api/v1/categories/{category}", Auth: "admin", Body: `{"parent_id":{category}}`, Status: 400},
+	{Method: "PUT", Path: "/api/v1/categories/{category}", Auth: "admin", Body: `{"description":"Checked","archived":true}`, Status: 200},
+	{Method: "GET", Path: "/api/v1/categories?include_archived=true", Status: 200},
+	{Method: "DELETE", Path: "/api/v1/categories/{category}", Auth: "admin", Status: 405},
+	{Method: "POST", Path: "/api/v1/categories/{category}/merge", Auth: "admin", Body: `{"into":{category}}`, Status: 400},
+	{Method: "POST", Path: "/api/v1/categories/999999/merge", Auth: "admin", Body: `{"into":1}`, Status: 404},
+	{Method: "GET", Path: "/api/v1/categories/{category}/merge", Status: 405},
+	{Method: "POST", Path: "/api/v1/categories/{category}/merge", Auth: "admin", Body: `{"into":1}`, Status: 200},
+	{Method: "GET", Path: "/api/v1/categories/{category}", Status: 404},
+
+	{Method: "GET", Path: "/api/v1/posts", Status: 200},
+	{Method: "GET", Path: "/api/v1/posts?page=0", Status: 400},
+	{Method: "GET", Path: "/api/v1/posts?filter=created", Status: 401},
+	{Method: "POST", Path: "/api/v1/posts", Body: `{"title":"Contract","content":"Check"}`, Status: 401},
+	{Method: "POST", Path: "/api/v1/posts", Auth: "reader", Body: `{"title":"Contract","content":"Check"}`, Status: 403},
+	{Method: "POST", Path: "/api/v1/posts", Auth: "author", Body: `{"title":"","content":""}`, Status: 400},
+	{Method: "POST", Path: "/api/v1/posts", Auth: "author", Body: `{"title":"Contract","content":"Check","tags":["a/b"]}`, Status: 400},
+	{Method: "POST", Path: "/api/v1/posts", Auth: "author", Body: `{"title":"Contract","content":"Check","category_ids":[1],"tags":["Contract Check"," go"]}`, Status: 201, Save: "post"},
+	{Method: "GET", Path: "/api/v1/posts?filter=created&per_page=5", Auth: "author", Status: 200},
+	{Method: "GET", Path: "/api/v1/posts?tag=Contract_Check", Status: 200},
+	{Method: "PATCH", Path: "/api/v1/posts", Status: 405},
+
+	{Method: "GET", Path: "/api/v1/posts/{post}", Status: 200},
+	{Method: "GET", Path: "/api/v1/posts/abc", Status: 400},
+	{Method: "GET", Path: "/api/v1/posts/999999", Status: 404},
+	{Method: "PUT", Path: "/api/v1/posts/{post}", Auth: "other", Body: `{"title":"Contract","content":"Edited"}`, Status: 403},
+	{Method: "PUT", Path: "/api/v1/posts/{post}", Auth: "author", Body: `{"title":"Contract","content":"Edited"}`, Status: 200},
+	{Method: "PATCH", Path: "/api/v1/posts/{post}", Auth: "author", Status: 405},
+
+	{Method: "POST", Path: "/api/v1/posts/{post}/vote", Auth: "author", Body: `{"value":1}`, Status: 200},
+	{Method: "POST", Path: "/api/v1/posts/{post}/vote", Auth: "author", Body: `{"value":5}`, Status: 400},
+	{Method: "POST", Path: "/api/v1/posts/999999/vote", Auth: "author", Body: `{"value":1}`, Status: 404},
+	{Method: "GET", Path: "/api/v1/posts/{post}/vote", Status: 405},
+
+	{Method: "GET", Path: "/api/v1/tags?q=contract", Status: 200},
+	{Method: "GET", Path: "/api/v1/tags?limit=0", Status: 400},
+	{Method: "GET", Path: "/api/v1/tags", Auth: "invalid", Status: 401},
+	{Method: "POST", Path: "/api/v1/tags", Auth: "author", Status: 405},
+
+	{Method: "GET", Path: "/api/v1/posts/{post}/comments", Status: 200},
+	{Method: "GET", Path: "/api/v1/posts/999999/comments", Status: 404},
+	{Method: "POST", Path: "/api/v1/posts/{post}/comments", Auth: "author", Body: `{"content":""}`, Status: 400},
+	{Method: "POST", Path: "/api/v1/posts/{post}/comments", Auth: "author", Body: `{"content":"Nice"}`, Status: 201, Save: "comment"},
+	{Method: "GET", Path: "/api/v1/posts/{post}/comments", Auth: "author", Status: 200},
+	{Method: "DELETE", Path: "/api/v1/posts/{post}/comments", Auth: "author", Status: 405},
+
+	{Method: "GET", Path: "/api/v1/comments/{comment}", Status: 200},
+	{Method: "PUT", Path: "/api/v1/comments/{comment}", Auth: "other", Body: `{"content":"Edited"}`, Status: 403},
+	{Method: "PUT", Path: "/api/v1/comments/{comment}", Auth: "author", Body: `{"content":"Edited"}`, Status: 200},
+	{Method: "POST", Path: "/api/v1/comments/{comment}/vote", Auth: "other", Body: `{"value":-1}`, Status: 200},
+	{Method: "POST", Path: "/api/v1/comments/999999/vote", Auth: "other", Body: `{"value":-1}`, Status: 404},
+	{Method: "GET", Path: "/api/v1/comments/{comment}/vote", Status: 405},
+	{Method: "DELETE", Path: "/api/v1/comments/{comment}", Auth: "other", Status: 403},
+	{Method: "DELETE", Path: "/api/v1/comments/{comment}", Auth: "author", Status: 204},
+	{Method: "GET", Path: "/api/v1/comments/{comment}", Status: 404},
+
+	{Method: "DELETE", Path: "/api/v1/posts/{post}", Auth: "other", Status: 403},
+	{Method: "DELETE", Path: "/api/v1/posts/{post}", Auth: "author", Status: 204},
+	{Method: "GET", Path: "/api/v1/posts/{post}", Status: 404},
+
+	// Удаление со страниц: только сессия автора
+	{Method: "POST", Path: "/api/v1/posts", Auth: "author", Body: `{"title":"Contract","content":"Page delete"}`, Status: 201, Save: "post"},
+	{Method: "POST", Path: "/api/v1/posts/{post}/comments", Auth: "author", Body: `{"content":"Nice"}`, Status: 201, Save: "comment"},
+	{Method: "POST", Path: "/comment/delete", Auth: "session", Body: `{"comment_id":{comment}}`, Status: 405},
+	{Method: "DELETE", Path: "/comment/delete", Body: `{"comment_id":{comment}}`, Status: 401},
+	{Method: "DELETE", Path: "/comment/delete", Auth: "author", Body: `{"comment_id":{comment}}`, Status: 401},
+	{Method: "DELETE", Path: "/comment/delete", Auth: "other", Body: `{"comment_id":{comment}}`, Status: 403},
+	{Method: "DELETE", Path: "/comment/delete", Auth: "session", Body: `{"comment_id":"{comment}"}`, Status: 400},
+	{Method: "DELETE", Path: "/comment/delete", Auth: "session", Body: `{"comment_id":{comment}}`, Status: 204},
+	{Method: "DELETE", Path: "/comment/delete", Auth: "session", Body: `{"comment_id":{comment}}`, Status: 404},
+	{Method: "GET", Path: "/post/delete", Auth: "session", Status: 405},
+	{Method: "DELETE", Path: "/post/delete", Body: `{"post_id":{post}}`, Status: 401},
+	{Method: "DELETE", Path: "/post/delete", Auth: "other", Body: `{"post_id":{post}}`, Status: 403},
+	{Method: "DELETE", Path: "/post/delete", Auth: "session", Body: `{"id":{post}}`, Status: 400},
+	{Method: "DELETE", Path: "/post/delete", Auth: "session", Body: `{"post_id":{post}}`, Status: 204},
+	{Method: "DELETE", Path: "/post/delete", Auth: "session", Body: `{"post_id":{post}}`, Status: 404},
+	{Method: "GET", Path: "/api/v1/posts/{post}", Status: 404},
+
+	// Автосохранение черновика: форма создания поста, только сессия
+	{Method: "GET", Path: "/drafts/save", Auth: "session", Status: 405},
+	{Method: "POST", Path: "/drafts/save", Form: map[string]string{"title": "Draft"}, Status: 401},
+	{Method: "POST", Path: "/drafts/save", Auth: "author", Form: map[string]string{"title": "Draft"}, Status: 401},
+	{Method: "POST", Path: "/drafts/save", Auth: "session", Form: map[string]string{"title": strings.Repeat("a", maxDraftTitleLength+1)}, Status: 400},
+	{Method: "POST", Path: "/drafts/save", Auth: "session", Form: map[string]string{"draft_id": "999999", "title": "Draft"}, Status: 404},
+	{Method: "POST", Path: "/drafts/save", Auth: "session", Form: map[string]string{"title": ""}, Status: 200},
+	{Method: "POST", Path: "/drafts/save", Auth: "session", Form: map[string]string{"title": "Draft", "content": "Autosaved", "tags": "go", "categories": "1"}, Status: 200},
+}
+
+// TestAPIContract прогоняет сценарий запросов ко всем маршрутам JSON API
+// и сверяет коды и тела ответов со спецификацией, которую отдаёт /api/openapi.json
+func TestAPIContract(t *testing.T) {
+	var spec map[string]interface{}
+	if err := json.Unmarshal(openAPISpec(), &spec); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	paths, _ := spec["paths"].(map[string]interface{})
+
+	// Каждый зарегистрированный маршрут описан в спецификации, и наоборот
+	registered := map[string]bool{}
+	for _, route := range apiRoutes {
+		registered[route.Pattern] = true
+		if _, ok := paths[route.Pattern]; !ok {
+			t.Errorf("route %s is not described in the spec", route.Pattern)
+		}
+	}
+	for p := range paths {
+		if !registered[p] {
+			t.Errorf("spec path %s has no registered route", p)
+		}
+	}
+
+	db := openTestDB(t)
+	auth, err := contractUsers(db)
+	if err != nil {
+		t.Fatalf("creating contract users: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	RegisterAPI(mux, db)
+
+	saved := map[string]string{}
+	covered := map[string]bool{}
+	for _, step := range contractSteps {
+		target, body := step.Path, step.Body
+		for name, id := range saved {
+			target = strings.ReplaceAll(target, "{"+name+"}", id)
+			body = strings.ReplaceAll(body, "{"+name+"}", id)
+		}
+		req := httptest.NewRequest(step.Method, target, strings.NewReader(body))
+		if step.Body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if step.Form != nil {
+			var form bytes.Buffer
+			mw := multipart.NewWriter(&form)
+			for name, value := range step.Form {
+				mw.WriteField(name, value)
+			}
+			mw.Close()
+			req = httptest.NewRequest(step.Method, target, &form)
+			req.Header.Set("Content-Type", mw.FormDataContentType())
+		}
+		auth[step.Auth](req)
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		_, pattern := mux.Handler(req)
+		where := step.Method + " " + target
+
+		if rec.Code != step.Status {
+			t.Errorf("%s: expected status %d, got %d: %s", where, step.Status, rec.Code, strings.TrimSpace(rec.Body.String()))
+		}
+		if err := checkResponse(spec, pattern, step.Method, rec); err != nil {
+			t.Errorf("%s: %v", where, err)
+		}
+		covered[step.Method+" "+pattern] = true
+
+		if step.Save != "" {
+			saved[step.Save] = path.Base(rec.Header().Get("Location"))
+		}
+	}
+
+	// Каждая описанная операция должна быть проверена хотя бы одним запросом
+	for p, item := range paths {
+		for method := range item.(map[string]interface{}) {
+			if !covered[strings.ToUpper(method)+" "+p] {
+				t.Errorf("%s %s is not exercised by the contract test", strings.ToUpper(method), p)
+			}
+		}
+	}
+}
+
+// contractUsers создаёт пользователей сценария и возвращает функции,
+// добавляющие к запросу соответствующую аутентификацию
+func contractUsers(db *sql.DB) (map[string]func(*http.Request), error) {
+	var ids [3]int64
+	for i, name := range []string{"contract_author", "contract_other", "contract_admin"} {
+		role := "user"
+		if name == "contract_admin" {
+			role = "admin"
+		}
+		res, err := db.Exec("INSERT INTO users (email, username, password, role) VALUES (?, ?, ?, ?)", name+"@example.com", name, "-", role)
+		if err != nil {
+			return nil, err
+		}
+		if ids[i], err = res.LastInsertId(); err != nil {
+			return nil, err
+		}
+	}
+
+	tokens := map[string]string{}
+	for name, scopes := range map[string]string{"author": "read,write", "reader": "read", "admin": "read,write,admin"} {
+		token, hash, err := generateToken()
+		if err != nil {
+			return nil, err
+		}
+		owner := ids[0]
+		if name == "admin" {
+			owner = ids[2]
+		}
+		_, err = db.Exec("INSERT INTO api_tokens (user_id, name, token_hash, scopes) VALUES (?, ?, ?, ?)",
+			owner, "contract-"+name, hash, scopes)
+		if err != nil {
+			return nil, err
+		}
+		tokens[name] = token
+	}
+
+	sessions := map[string]string{}
+	for name, owner := range map[string]int64{"session": ids[0], "other": ids[1]} {
+		sessionID, _, err := generateToken()
+		if err != nil {
+			return nil, err
+		}
+		_, err = db.Exec("INSERT INTO sessions (id, user_id, expiry) VALUES (?, ?, ?)", sessionID, owner, time.Now().Add(time.Hour))
+		if err != nil {
+			return nil, err
+		}
+		sessions[name] = sessionID
+	}
+
+	bearer := func(token string) func(*http.Request) {
+		return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }
+	}
+	cookie := func(sessionID string) func(*http.Request) {
+		return func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "session_id", Value: sessionID}) }
+	}
+	return map[string]func(*http.Request){
+		"":        func(*http.Request) {},
+		"author":  bearer(tokens["author"]),
+		"reader":  bearer(tokens["reader"]),
+		"admin":   bearer(tokens["admin"]),
+		"invalid": bearer(tokenPrefix + "invalid"),
+		"session": cookie(sessions["session"]),
+		"other":   cookie(sessions["other"]),
+	}, nil
+}
+
+// checkResponse сверяет ответ с описанием операции method pattern в спецификации
+func checkResponse(spec map[string]interface{}, pattern, method string, rec *httptest.ResponseRecorder) error {
+	paths, _ := spec["paths"].(map[string]interface{})
+	item, ok := paths[pattern].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("path %q is not described in the spec", pattern)
+	}
+
+	if rec.Code == http.StatusMethodNotAllowed {
+		// 405 — метод не описан, а заголовок Allow перечисляет ровно описанные методы
+		if _, ok := item[strings.ToLower(method)]; ok {
+			return fmt.Errorf("documented method answered 405")
+		}
+		var documented []string
+		for m := range item {
+			documented = append(documented, strings.ToUpper(m))
+		}
+		allowed := strings.Split(rec.Header().Get("Allow"), ", ")
+		sort.Strings(documented)
+		sort.Strings(allowed)
+		if strings.Join(documented, ",") != strings.Join(allowed, ",") {
+			return fmt.Errorf("Allow header %q does not match documented methods %v", rec.Header().Get("Allow"), documented)
+		}
+		return checkBody(spec, map[string]interface{}{"$ref": "#/components/schemas/Error"}, rec)
+	}
+
+	operation, ok := item[strings.ToLower(method)].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("operation is not described in the spec")
+	}
+	responses, _ := operation["responses"].(map[string]interface{})
+	response, ok := responses[strconv.Itoa(rec.Code)].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("status %d is not documented", rec.Code)
+	}
+
+	content, ok := response["content"].(map[string]interface{})
+	if !ok {
+		if body := bytes.TrimSpace(rec.Body.Bytes()); len(body) > 0 {
+			return fmt.Errorf("status %d is documented without a body, got %q", rec.Code, body)
+		}
+		return nil
+	}
+	media, _ := content["application/json"].(map[string]interface{})
+	schema, _ := media["schema"].(map[string]interface{})
+	return checkBody(spec, schema, rec)
+}
+
+// checkBody проверяет, что тело ответа — JSON, соответствующий schema
+func checkBody(spec, schema map[string]interface{}, rec *httptest.ResponseRecorder) error {
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		return fmt.Errorf("expected application/json, got Content-Type %q", ct)
+	}
+	dec := json.NewDecoder(bytes.NewReader(rec.Body.Bytes()))
+	dec.UseNumber()
+	var body interface{}
+	if err := dec.Decode(&body); err != nil {
+		return fmt.Errorf("invalid JSON body: %v", err)
+	}
+	return matchSchema(spec, schema, body, "body")
+}
+
+// matchSchema проверяет значение v по JSON-схеме из спецификации.
+// Поддерживается подмножество, которое использует buildOpenAPI.
+func matchSchema(spec, schema map[string]interface{}, v interface{}, at string) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		components, _ := spec["components"].(map[string]interface{})
+		schemas, _ := components["schemas"].(map[string]interface{})
+		resolved, ok := schemas[strings.TrimPrefix(ref, "#/components/schemas/")].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: unknown schema %s", at, ref)
+		}
+		return matchSchema(spec, resolved, v, at)
+	}
+	if v == nil {
+		if schema["nullable"] == true {
+			return nil
+		}
+		return fmt.Errorf("%s: unexpected null", at)
+	}
+
+	switch schema["type"] {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected object, got %T", at, v)
+		}
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := obj[name.(string)]; !ok {
+				return fmt.Errorf("%s: missing required field %q", at, name)
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		for name, value := range obj {
+			propSchema, ok := properties[name].(map[string]interface{})
+			if !ok {
+				if schema["additionalProperties"] == false {
+					return fmt.Errorf("%s: undocumented field %q", at, name)
+				}
+				continue
+			}
+			if err := matchSchema(spec, propSchema, value, at+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		arr, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected array, got %T", at, v)
+		}
+		items, _ := schema["items"].(map[string]interface{})
+		for i, value := range arr {
+			if err := matchSchema(spec, items, value, at+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+		}
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s: expected integer, got %T", at, v)
+		}
+		if _, err := n.Int64(); err != nil {
+			return fmt.Errorf("%s: expected integer, got %s", at, n)
+		}
+	case "string":
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s: expected string, got %T", at, v)
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				return fmt.Errorf("%s: invalid date-time %q", at, s)
+			}
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s: expected boolean, got %T", at, v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,379 @@
+package handlers
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// postQuery описывает выборку постов. Используется страницей /posts и JSON API.
+type postQuery struct {
+	ViewerID     int    // ID текущего пользователя (0 — гость)
+	Filter       string // "created", "liked", "following", "saved" или пусто
+	Label        string // Метка закладок для фильтра "saved"
+	Category     string // Slug (или имя) категории для фильтрации
+	Author       string // Имя автора для фильтрации
+	Tag          string // Нормализованный тег для фильтрации
+	PostID       int    // Выбрать только один пост
+	Limit        int    // Количество постов (0 — без ограничения)
+	Offset       int    // Смещение для постраничного вывода
+	WithComments bool   // Загружать комментарии к постам
+}
+
+// postsWhere формирует JOIN и WHERE части запроса для выборки постов
+func postsWhere(q postQuery) (string, []interface{}) {
+	// Запланированные посты не видны никому до публикации
+	whereClauses := []string{"p.publish_at IS NULL"}
+	joinClauses := []string{}
+	queryArgs := []interface{}{}
+
+	if q.Filter == "created" {
+		if q.ViewerID != 0 {
+			whereClauses = append(whereClauses, "p.user_id = ?")
+			queryArgs = append(queryArgs, q.ViewerID)
+		} else {
+			// Если пользователь не авторизован, показываем пустой список
+			whereClauses = append(whereClauses, "p.id = -1")
+		}
+	} else if q.Filter == "liked" {
+		if q.ViewerID != 0 {
+			// Для фильтрации по лайкам нужен JOIN с таблицей likes
+			joinClauses = append(joinClauses, "JOIN likes l ON p.id = l.post_id")
+			whereClauses = append(whereClauses, "l.user_id = ? AND l.is_like = true")
+			queryArgs = append(queryArgs, q.ViewerID)
+		} else {
+			// Если пользователь не авторизован, показываем пустой список
+			whereClauses = append(whereClauses, "p.id = -1")
+		}
+	} else if q.Filter == "saved" {
+		if q.ViewerID != 0 {
+			joinClauses = append(joinClauses, "JOIN bookmarks b ON p.id = b.post_id AND b.user_id = ?")
+			queryArgs = append(queryArgs, q.ViewerID)
+			if q.Label != "" {
+				whereClauses = append(whereClauses, "b.label = ?")
+				queryArgs = append(queryArgs, q.Label)
+			}
+		} else {
+			whereClauses = append(whereClauses, "p.id = -1")
+		}
+	} else if q.Filter == "following" {
+		if q.ViewerID != 0 {
+			// Посты отслеживаемых авторов и отслеживаемых категорий (вместе с их подкатегориями) без повторов
+			whereClauses = append(whereClauses, `(p.user_id IN (SELECT followed_id FROM follows WHERE follower_id = ?)
+				OR p.id IN (SELECT pc.post_id FROM post_categories pc
+					JOIN categories fc ON fc.id = pc.category_id
+					JOIN category_follows f ON f.category_id IN (fc.id, fc.parent_id) WHERE f.user_id = ?))`)
+			queryArgs = append(queryArgs, q.ViewerID, q.ViewerID)
+		} else {
+			whereClauses = append(whereClauses, "p.id = -1")
+		}
+	}
+
+	// Добавляем фильтрацию по категории; родительская категория включает посты подкатегорий
+	if q.Category != "" {
+		whereClauses = append(whereClauses, `p.id IN (SELECT pc.post_id FROM post_categories pc
+			JOIN categories cat ON pc.category_id = cat.id
+			LEFT JOIN categories parent ON cat.parent_id = parent.id
+			WHERE cat.slug = ? OR cat.name = ? OR parent.slug = ? OR parent.name = ?)`)
+		queryArgs = append(queryArgs, q.Category, q.Category, q.Category, q.Category)
+	}
+
+	if q.Tag != "" {
+		whereClauses = append(whereClauses, "p.id IN (SELECT pt.post_id FROM post_tags pt JOIN tags t ON pt.tag_id = t.id WHERE t.name = ?)")
+		queryArgs = append(queryArgs, q.Tag)
+	}
+
+	if q.Author != "" {
+		whereClauses = append(whereClauses, "u.username = ?")
+		queryArgs = append(queryArgs, q.Author)
+	}
+
+	if q.PostID != 0 {
+		whereClauses = append(whereClauses, "p.id = ?")
+		queryArgs = append(queryArgs, q.PostID)
+	}
+
+	clause := " " + strings.Join(joinClauses, " ") + " WHERE " + strings.Join(whereClauses, " AND ")
+	return clause, queryArgs
+}
+
+// countPosts возвращает общее количество постов, подходящих под фильтры
+func countPosts(db *sql.DB, q postQuery) (int, error) {
+	clause, args := postsWhere(q)
+	var total int
+	err := db.QueryRow("SELECT COUNT(DISTINCT p.id) FROM posts p JOIN users u ON p.user_id = u.id"+clause, args...).Scan(&total)
+	return total, err
+}
+
+// queryPosts выбирает посты с лайками/дизлайками, категориями, тегами и (опционально) комментариями
+func queryPosts(db *sql.DB, q postQuery) ([]Post, error) {
+	clause, args := postsWhere(q)
+
+	// Основной SELECT с подсчётом лайков/дизлайков и автором
+	query := `
+		SELECT p.id, p.user_id, p.title, p.content, u.username, p.created_at,
+			(SELECT COUNT(*) FROM likes WHERE post_id = p.id AND is_like = true AND comment_id IS NULL),
+			(SELECT COUNT(*) FROM likes WHERE post_id = p.id AND is_like = false AND comment_id IS NULL),
+			(SELECT COUNT(*) FROM comments WHERE post_id = p.id),
+			p.image_path, p.updated_at
+		FROM posts p
+		JOIN users u ON p.user_id = u.id` + clause + " ORDER BY p.created_at DESC, p.id DESC"
+	if q.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, q.Limit, q.Offset)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var posts []Post
+	for rows.Next() {
+		var p Post
+		var imagePath sql.NullString
+		var updatedAt sql.NullTime
+		if err := rows.Scan(&p.ID, &p.UserID, &p.Title, &p.Content, &p.Author, &p.CreatedTime, &p.Likes, &p.Dislikes, &p.CommentCount, &imagePath, &updatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if imagePath.Valid {
+			p.ImagePath = imagePath.String
+		}
+		p.UpdatedTime = updatedAt.Time
+		// Форматируем дату для отображения
+		p.CreatedAt = formatDate(p.CreatedTime)
+		p.Comments = []Comment{}
+		p.Categories = []Category{}
+		posts = append(posts, p)
+	}
+	// Закрываем выборку до вложенных запросов
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range posts {
+		p := &posts[i]
+
+		// Проверяем, голосовал ли текущий пользователь за этот пост
+		if q.ViewerID != 0 {
+			p.UserLiked, p.UserDisliked, err = userVote(db, q.ViewerID, p.ID, 0)
+			if err != nil {
+				return nil, err
+			}
+			p.Bookmarked, p.BookmarkLabel, err = userBookmark(db, q.ViewerID, p.ID)
+			if err != nil {
+				return nil, err
+			}
+			p.Subscribed, err = threadSubscribed(db, q.ViewerID, p.ID, p.UserID)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if q.WithComments {
+			if p.Comments, err = queryComments(db, p.ID, q.ViewerID); err != nil {
+				return nil, err
+			}
+		}
+
+		if p.Categories, err = queryPostCategories(db, p.ID); err != nil {
+			return nil, err
+		}
+		if p.Tags, err = queryPostTags(db, p.ID); err != nil {
+			return nil, err
+		}
+	}
+	return posts, nil
+}
+
+// queryPost возвращает один пост с комментариями или sql.ErrNoRows
+func queryPost(db *sql.DB, postID, viewerID int) (Post, error) {
+	posts, err := queryPosts(db, postQuery{ViewerID: viewerID, PostID: postID, WithComments: true})
+	if err != nil {
+		return Post{}, err
+	}
+	if len(posts) == 0 {
+		return Post{}, sql.ErrNoRows
+	}
+	return posts[0], nil
+}
+
+// queryComments возвращает комментарии поста в порядке создания
+func queryComments(db *sql.DB, postID, viewerID int) ([]Comment, error) {
+	rows, err := db.Query(`
+		SELECT c.id, c.post_id, c.user_id, u.username, c.content,
+			(SELECT COUNT(*) FROM likes WHERE comment_id = c.id AND is_like = true AND post_id IS NULL),
+			(SELECT COUNT(*) FROM likes WHERE comment_id = c.id AND is_like = false AND post_id IS NULL),
+			c.created_at, c.updated_at
+		FROM comments c
+		JOIN users u ON c.user_id = u.id
+		WHERE c.post_id = ?
+		ORDER BY c.created_at ASC, c.id ASC
+	`, postID)
+	if err != nil {
+		return nil, err
+	}
+	comments := []Comment{}
+	for rows.Next() {
+		var c Comment
+		var updatedAt sql.NullTime
+		if err := rows.Scan(&c.ID, &c.PostID, &c.UserID, &c.Author, &c.Content, &c.Likes, &c.Dislikes, &c.CreatedTime, &updatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		c.UpdatedTime = updatedAt.Time
+		c.CreatedAt = formatDate(c.CreatedTime)
+		comments = append(comments, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Проверяем, голосовал ли текущий пользователь за комментарии
+	if viewerID != 0 {
+		for i := range comments {
+			comments[i].UserLiked, comments[i].UserDisliked, err = userVote(db, viewerID, 0, comments[i].ID)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return comments, nil
+}
+
+// queryComment возвращает один комментарий или sql.ErrNoRows
+func queryComment(db *sql.DB, commentID, viewerID int) (Comment, error) {
+	var c Comment
+	var updatedAt sql.NullTime
+	err := db.QueryRow(`
+		SELECT c.id, c.post_id, c.user_id, u.username, c.content,
+			(SELECT COUNT(*) FROM likes WHERE comment_id = c.id AND is_like = true AND post_id IS NULL),
+			(SELECT COUNT(*) FROM likes WHERE comment_id = c.id AND is_like = false AND post_id IS NULL),
+			c.created_at, c.updated_at
+		FROM comments c
+		JOIN users u ON c.user_id = u.id
+		WHERE c.id = ?
+	`, commentID).Scan(&c.ID, &c.PostID, &c.UserID, &c.Author, &c.Content, &c.Likes, &c.Dislikes, &c.CreatedTime, &updatedAt)
+	if err != nil {
+		return Comment{}, err
+	}
+	c.UpdatedTime = updatedAt.Time
+	c.CreatedAt = formatDate(c.CreatedTime)
+	if viewerID != 0 {
+		c.UserLiked, c.UserDisliked, err = userVote(db, viewerID, 0, c.ID)
+		if err != nil {
+			return Comment{}, err
+		}
+	}
+	return c, nil
+}
+
+// categoryColumns — столбцы категории в порядке полей scanCategory; c — псевдоним таблицы categories.
+// Число постов родительской категории включает посты подкатегорий; запланированные посты не считаются.
+const categoryColumns = `c.id, c.name, c.slug, c.description, c.color, c.icon, c.position, c.archived,
+	c.parent_id, COALESCE((SELECT par.name FROM categories par WHERE par.id = c.parent_id), ''),
+	c.posting, COALESCE((SELECT par.posting FROM categories par WHERE par.id = c.parent_id), ''),
+	(SELECT COUNT(DISTINCT cnt.post_id) FROM post_categories cnt
+		JOIN posts cp ON cp.id = cnt.post_id AND cp.publish_at IS NULL
+		WHERE cnt.category_id = c.id OR cnt.category_id IN (SELECT sub.id FROM categories sub WHERE sub.parent_id = c.id))`
+
+// categoryTreeOrder упорядочивает категории деревом: родитель в порядке позиций, сразу за ним его подкатегории
+const categoryTreeOrder = ` ORDER BY COALESCE((SELECT par.position FROM categories par WHERE par.id = c.parent_id), c.position),
+	CASE WHEN c.parent_id = 0 THEN c.id ELSE c.parent_id END, c.parent_id != 0, c.position, c.name`
+
+// scanCategory читает строку, выбранную через categoryColumns
+func scanCategory(row interface{ Scan(...interface{}) error }) (Category, error) {
+	var cat Category
+	err := row.Scan(&cat.ID, &cat.Name, &cat.Slug, &cat.Description, &cat.Color, &cat.Icon, &cat.Position, &cat.Archived,
+		&cat.ParentID, &cat.ParentName, &cat.Posting, &cat.parentPosting, &cat.PostCount)
+	return cat, err
+}
+
+// scanCategories читает все строки результата в список категорий
+func scanCategories(rows *sql.Rows) ([]Category, error) {
+	defer rows.Close()
+	categories := []Category{}
+	for rows.Next() {
+		cat, err := scanCategory(rows)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, cat)
+	}
+	return categories, rows.Err()
+}
+
+// queryPostCategories возвращает категории поста в порядке панели фильтров
+func queryPostCategories(db *sql.DB, postID int) ([]Category, error) {
+	rows, err := db.Query(`
+		SELECT `+categoryColumns+`
+		FROM categories c
+		JOIN post_categories pc ON c.id = pc.category_id
+		WHERE pc.post_id = ?`+categoryTreeOrder, postID)
+	if err != nil {
+		return nil, err
+	}
+	return scanCategories(rows)
+}
+
+// queryCategories возвращает действующие (не архивные) категории в порядке дерева, заданном администратором
+func queryCategories(db *sql.DB) ([]Category, error) {
+	rows, err := db.Query("SELECT " + categoryColumns + " FROM categories c WHERE c.archived = false" + categoryTreeOrder)
+	if err != nil {
+		return nil, err
+	}
+	return scanCategories(rows)
+}
+
+// queryAllCategories возвращает все категории, включая архивные, в порядке дерева
+func queryAllCategories(db *sql.DB) ([]Category, error) {
+	rows, err := db.Query("SELECT " + categoryColumns + " FROM categories c" + categoryTreeOrder)
+	if err != nil {
+		return nil, err
+	}
+	return scanCategories(rows)
+}
+
+// lookupCategoryByID возвращает категорию по ID (в том числе архивную)
+func lookupCategoryByID(db *sql.DB, categoryID int) (Category, error) {
+	return scanCategory(db.QueryRow("SELECT "+categoryColumns+" FROM categories c WHERE c.id = ?", categoryID))
+}
+
+// lookupCategory находит категорию по slug; для старых ссылок вида ?category=General — по имени
+func lookupCategory(db *sql.DB, key string) (Category, error) {
+	return scanCategory(db.QueryRow(`
+		SELECT `+categoryColumns+` FROM categories c
+		WHERE c.slug = ? OR c.name = ?
+		ORDER BY c.slug = ? DESC LIMIT 1`, key, key, key))
+}
+
+// userVote возвращает голос пользователя за пост (commentID == 0) или комментарий
+func userVote(db *sql.DB, userID, postID, commentID int) (liked, disliked bool, err error) {
+	var isLike bool
+	if commentID == 0 {
+		err = db.QueryRow(`
+			SELECT is_like FROM likes
+			WHERE user_id = ? AND post_id = ? AND comment_id IS NULL
+		`, userID, postID).Scan(&isLike)
+	} else {
+		err = db.QueryRow(`
+			SELECT is_like FROM likes
+			WHERE user_id = ? AND comment_id = ? AND post_id IS NULL
+		`, userID, commentID).Scan(&isLike)
+	}
+	if err == sql.ErrNoRows {
+		// Если пользователь не голосовал, оба поля остаются false
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	return isLike, !isLike, nil
+}
+
+// formatDate форматирует дату для отображения в шаблонах
+func formatDate(t time.Time) string {
+	return t.Format("Jan 02, 2006 at 15:04")
+}
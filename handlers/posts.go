@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"html/template"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 )
@@ -11,46 +12,88 @@ import (
 // Структура для комментария
 type Comment struct {
 	ID           int
+	PostID       int
+	UserID       int
 	Author       string
 	Content      string
 	Likes        int
 	Dislikes     int
 	UserLiked    bool
 	UserDisliked bool
-	CreatedAt    string // Дата создания комментария
+	CreatedAt    string    // Дата создания комментария
+	CreatedTime  time.Time // Дата создания без форматирования (для API)
+	UpdatedTime  time.Time // Дата последнего изменения (нулевая, если не изменялся)
 }
 
 // Структура для категории
 type Category struct {
-	ID   int
-	Name string
+	ID          int
+	Name        string
+	Slug        string // Имя категории в адресах
+	Description string
+	Color       string // #rrggbb или пусто
+	Icon        string // Иконка Font Awesome без префикса fa-
+	Position    int    // Порядок в панели фильтров
+	Archived    bool   // Архивная категория не принимает новые посты и скрыта из панели фильтров
+	ParentID    int    // 0 — категория верхнего уровня
+	ParentName  string
+	Posting     string // Правило публикации: everyone, moderators или readonly
+	PostCount   int
+	Children    []Category // Подкатегории; заполняется categoryTree
+
+	parentPosting string // Правило публикации родительской категории
+}
+
+// Структура для тега в облаке тегов и подсказках
+type Tag struct {
+	Name      string
+	PostCount int
+	Weight    int // Размер в облаке тегов: 1–4
 }
 
 // Структура для поста
 type Post struct {
-	ID           int
-	Title        string
-	Content      string
-	Author       string
-	CreatedAt    string
-	Likes        int
-	Dislikes     int
-	UserLiked    bool
-	UserDisliked bool
-	Comments     []Comment
-	Categories   []Category
-	ImagePath    string // Путь к изображению поста
+	ID            int
+	UserID        int
+	Title         string
+	Content       string
+	Author        string
+	CreatedAt     string
+	Likes         int
+	Dislikes      int
+	UserLiked     bool
+	UserDisliked  bool
+	Comments      []Comment
+	CommentCount  int
+	Categories    []Category
+	Tags          []string  // Нормализованные теги по алфавиту
+	ImagePath     string    // Путь к изображению поста
+	Bookmarked    bool      // Пост в закладках текущего пользователя
+	BookmarkLabel string    // Метка закладки
+	Subscribed    bool      // Текущий пользователь получает уведомления о комментариях
+	CreatedTime   time.Time // Дата создания без форматирования (для API)
+	UpdatedTime   time.Time // Дата последнего изменения (нулевая, если не изменялся)
 }
 
 // Структура для данных, передаваемых в шаблон posts.html
 type PostsPageData struct {
-	IsLoggedIn     bool
-	CurrentUser    string
-	Posts          []Post
-	Categories     []Category
-	Filter         string
-	CategoryFilter string
-	Error          string // Для вывода ошибок (например, пустой комментарий)
+	IsLoggedIn        bool
+	CurrentUser       string
+	Posts             []Post
+	Categories        []Category
+	Filter            string
+	CategoryFilter    string     // Slug выбранной категории
+	CurrentCategory   *Category  // Выбранная категория (nil, если не выбрана или не найдена)
+	CategoryRoot      string     // Slug категории верхнего уровня, к которой относится выбранная
+	Subcategories     []Category // Подкатегории CategoryRoot для второй строки панели фильтров
+	TagFilter         string     // Тег страницы /tag/{name}
+	TagCloud          []Tag      // Популярные теги с весами для облака
+	Error             string     // Для вывода ошибок (например, пустой комментарий)
+	Unread            int        // Количество непрочитанных уведомлений
+	UnreadMessages    int        // Количество непрочитанных личных сообщений
+	FollowingCategory bool       // Текущий пользователь подписан на выбранную категорию
+	Label             string     // Выбранная метка закладок
+	Labels            []string   // Метки закладок текущего пользователя
 }
 
 // nl2br — функция для преобразования переносов строк в HTML <br> для корректного отображения в шаблоне
@@ -58,24 +101,6 @@ func nl2br(text string) template.HTML {
 	return template.HTML(strings.ReplaceAll(template.HTMLEscapeString(text), "\n", "<br>"))
 }
 
-// Функция для автоматического переноса строк по количеству слов
-func splitAndWrap(text string, wordLimit int) string {
-	words := strings.Fields(text)
-	if len(words) <= wordLimit {
-		return text
-	}
-	var sb strings.Builder
-	for i, w := range words {
-		sb.WriteString(w)
-		if (i+1)%wordLimit == 0 {
-			sb.WriteString("\n")
-		} else {
-			sb.WriteString(" ")
-		}
-	}
-	return strings.TrimSpace(sb.String())
-}
-
 // Posts — обработчик вывода всех постов с фильтрами, категориями и комментариями
 func Posts(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -108,212 +133,103 @@ func Posts(db *sql.DB) http.HandlerFunc {
 		// Получаем фильтры из URL (поиск по автору, лайкам, категориям)
 		filter := r.URL.Query().Get("filter")
 		categoryFilter := r.URL.Query().Get("category")
-
-		// Формируем SQL-запрос для выборки постов с учётом фильтров
-		var rows *sql.Rows
-		var query string
-		whereClauses := []string{}
-		joinClauses := []string{}
-		queryArgs := []interface{}{}
-
-		// Основной SELECT с подсчётом лайков/дизлайков и автором
-		selectClause := `
-			SELECT p.id, p.title, p.content, u.username, p.created_at,
-				(SELECT COUNT(*) FROM likes WHERE post_id = p.id AND is_like = true AND comment_id IS NULL),
-				(SELECT COUNT(*) FROM likes WHERE post_id = p.id AND is_like = false AND comment_id IS NULL),
-				p.image_path
-		`
-		fromClause := `
-			FROM posts p
-			JOIN users u ON p.user_id = u.id
-		`
-
-		if filter == "created" {
-			if isLoggedIn {
-				whereClauses = append(whereClauses, "p.user_id = ?")
-				queryArgs = append(queryArgs, userID)
-			} else {
-				// Если пользователь не авторизован, показываем пустой список
-				whereClauses = append(whereClauses, "p.id = -1")
-			}
-		} else if filter == "liked" {
-			if isLoggedIn {
-				// Для фильтрации по лайкам нужен JOIN с таблицей likes
-				joinClauses = append(joinClauses, "JOIN likes l ON p.id = l.post_id")
-				whereClauses = append(whereClauses, "l.user_id = ? AND l.is_like = true")
-				queryArgs = append(queryArgs, userID)
-			} else {
-				// Если пользователь не авторизован, показываем пустой список
-				whereClauses = append(whereClauses, "p.id = -1")
+		label := r.URL.Query().Get("label")
+
+		// Страница /tag/{name}: адрес с ненормализованным тегом перенаправляем на канонический
+		tagFilter := r.PathValue("name")
+		if tagFilter != "" {
+			if tag := normalizeTag(tagFilter); tag != tagFilter {
+				if !isTagName(tag) {
+					http.Error(w, "Invalid tag", http.StatusNotFound)
+					return
+				}
+				http.Redirect(w, r, "/tag/"+url.PathEscape(tag), http.StatusMovedPermanently)
+				return
 			}
 		}
 
-		// Добавляем фильтрацию по категории
+		// Старые ссылки вида ?category=General приводим к slug категории
+		var currentCategory *Category
 		if categoryFilter != "" {
-			// Для фильтрации по категории нужен JOIN с post_categories и categories
-			joinClauses = append(joinClauses, "JOIN post_categories pc ON p.id = pc.post_id")
-			joinClauses = append(joinClauses, "JOIN categories cat ON pc.category_id = cat.id")
-			whereClauses = append(whereClauses, "cat.name = ?")
-			queryArgs = append(queryArgs, categoryFilter)
+			if cat, err := lookupCategory(db, categoryFilter); err == nil {
+				currentCategory = &cat
+				categoryFilter = cat.Slug
+			}
 		}
 
-		// Собираем полный запрос
-		query = selectClause + fromClause + strings.Join(joinClauses, " ")
-		if len(whereClauses) > 0 {
-			query += " WHERE " + strings.Join(whereClauses, " AND ")
+		// Выбираем посты с учётом фильтров вместе с комментариями и категориями
+		var viewerID int
+		if isLoggedIn {
+			viewerID = userID
 		}
-		query += " ORDER BY p.created_at DESC"
-
-		var posts []Post
-		rows, err = db.Query(query, queryArgs...)
+		posts, err := queryPosts(db, postQuery{
+			ViewerID:     viewerID,
+			Filter:       filter,
+			Label:        label,
+			Category:     categoryFilter,
+			Tag:          tagFilter,
+			WithComments: true,
+		})
 		if err != nil {
-			if err == sql.ErrNoRows {
-				// Нет постов — это не ошибка, просто показываем пустой список
-				posts = []Post{}
-			} else {
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-				return
-			}
-		} else {
-			defer rows.Close()
-			for rows.Next() {
-				var p Post
-				var createdAt time.Time
-				var imagePath sql.NullString
-				if err := rows.Scan(&p.ID, &p.Title, &p.Content, &p.Author, &createdAt, &p.Likes, &p.Dislikes, &imagePath); err != nil {
-					continue
-				}
-				if imagePath.Valid {
-					p.ImagePath = imagePath.String
-				}
-				// Форматируем дату для отображения
-				p.CreatedAt = createdAt.Format("Jan 02, 2006 at 15:04")
-				p.Comments = []Comment{}
-				p.Categories = []Category{}
-
-				// Применяем автоматический перенос строк
-				p.Title = splitAndWrap(p.Title, 20)
-				p.Content = splitAndWrap(p.Content, 30)
-
-				// Проверяем, лайкнул ли текущий пользователь этот пост
-				if isLoggedIn {
-					var userVote bool
-					err := db.QueryRow(`
-						SELECT is_like FROM likes 
-						WHERE user_id = ? AND post_id = ? AND comment_id IS NULL
-					`, userID, p.ID).Scan(&userVote)
-					if err == nil {
-						p.UserLiked = userVote
-						p.UserDisliked = !userVote
-					} else if err != sql.ErrNoRows {
-					}
-					// Если пользователь не голосовал, оба поля остаются false
-				}
-
-				// Получаем комментарии для поста
-				commentRows, err := db.Query(`
-					SELECT c.id, u.username, c.content,
-						(SELECT COUNT(*) FROM likes WHERE comment_id = c.id AND is_like = true AND post_id IS NULL),
-						(SELECT COUNT(*) FROM likes WHERE comment_id = c.id AND is_like = false AND post_id IS NULL),
-						c.created_at
-					FROM comments c
-					JOIN users u ON c.user_id = u.id
-					WHERE c.post_id = ?
-					ORDER BY c.created_at ASC
-				`, p.ID)
-				if err == nil {
-					for commentRows.Next() {
-						var c Comment
-						var createdAt time.Time
-						if err := commentRows.Scan(&c.ID, &c.Author, &c.Content, &c.Likes, &c.Dislikes, &createdAt); err == nil {
-							c.CreatedAt = createdAt.Format("Jan 02, 2006 at 15:04")
-							// Проверяем, лайкнул ли текущий пользователь этот комментарий
-							if isLoggedIn {
-								var userVote bool
-								err := db.QueryRow(`
-									SELECT is_like FROM likes 
-									WHERE user_id = ? AND comment_id = ? AND post_id IS NULL
-								`, userID, c.ID).Scan(&userVote)
-								if err == nil {
-									c.UserLiked = userVote
-									c.UserDisliked = !userVote
-								} else if err != sql.ErrNoRows {
-								}
-								// Если пользователь не голосовал, оба поля остаются false
-							}
-							p.Comments = append(p.Comments, c)
-						} else {
-						}
-					}
-					commentRows.Close()
-				} else {
-				}
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
 
-				// Получаем категории для текущего поста
-				categoryRows, err := db.Query(`
-					SELECT c.id, c.name
-					FROM categories c
-					JOIN post_categories pc ON c.id = pc.category_id
-					WHERE pc.post_id = ?
-					ORDER BY c.name ASC
-				`, p.ID)
-				if err == nil {
-					for categoryRows.Next() {
-						var cat Category
-						if err := categoryRows.Scan(&cat.ID, &cat.Name); err == nil {
-							p.Categories = append(p.Categories, cat)
-						} else {
-						}
-					}
-					categoryRows.Close()
-				} else {
+		// Получаем все доступные категории для отображения в фильтре деревом
+		allCategories, _ := queryCategories(db)
+		tree := categoryTree(allCategories)
+		var categoryRoot string
+		var subcategories []Category
+		if currentCategory != nil {
+			for _, root := range tree {
+				if root.ID == currentCategory.ID || root.ID == currentCategory.ParentID {
+					categoryRoot, subcategories = root.Slug, root.Children
 				}
-
-				posts = append(posts, p)
 			}
 		}
 
-		// Проверяем ошибки после итерации по rows
-		if err = rows.Err(); err != nil {
+		data := PostsPageData{
+			IsLoggedIn:      isLoggedIn,
+			CurrentUser:     username,
+			Posts:           posts,
+			Categories:      tree,
+			Filter:          filter,
+			CategoryFilter:  categoryFilter,
+			CurrentCategory: currentCategory,
+			CategoryRoot:    categoryRoot,
+			Subcategories:   subcategories,
+			TagFilter:       tagFilter,
+			Error:           "",
+		}
+		if data.TagCloud, err = tagCloud(db); err != nil {
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
-
-		// Получаем все доступные категории для отображения в фильтре
-		var allCategories []Category
-		rowsCategories, err := db.Query("SELECT id, name FROM categories ORDER BY name ASC")
-		if err != nil {
-		} else {
-			defer rowsCategories.Close()
-			for rowsCategories.Next() {
-				var cat Category
-				if err := rowsCategories.Scan(&cat.ID, &cat.Name); err == nil {
-					allCategories = append(allCategories, cat)
-				} else {
-				}
+		if isLoggedIn {
+			data.Unread = unreadNotifications(db, userID)
+			data.UnreadMessages = unreadMessages(db, userID)
+			if currentCategory != nil {
+				data.FollowingCategory = isFollowingCategory(db, userID, currentCategory.ID)
 			}
-			if err = rowsCategories.Err(); err != nil {
+			if filter == "saved" {
+				data.Label = label
+				if data.Labels, err = bookmarkLabels(db, userID); err != nil {
+					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+					return
+				}
 			}
 		}
-
-		data := PostsPageData{
-			IsLoggedIn:     isLoggedIn,
-			CurrentUser:    username,
-			Posts:          posts,
-			Categories:     allCategories,
-			Filter:         filter,
-			CategoryFilter: categoryFilter,
-			Error:          "",
-		}
 		if errMsg := r.URL.Query().Get("error"); errMsg != "" {
 			if errMsg == "empty_comment" {
-				data.Error = "Comment cannot be empty."
+				data.Error = errEmptyComment.Error()
+			} else if errMsg == "comment_too_long" {
+				data.Error = errCommentTooLong.Error()
 			} else {
 				data.Error = "An error occurred."
 			}
 		}
 
-		tmpl, err := template.New("posts.html").Funcs(template.FuncMap{"nl2br": nl2br}).ParseFiles("templates/posts.html")
+		tmpl, err := template.New("posts.html").Funcs(template.FuncMap{"nl2br": nl2br, "markdown": markdownFunc(db)}).ParseFiles("templates/posts.html")
 		if err != nil {
 			http.Error(w, "Internal Server Error: Could not parse template.", http.StatusInternalServerError)
 			return
@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"database/sql"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Сколько постов или комментариев показывать на одной странице профиля
+const profilePageSize = 10
+
+// UserProfile — публичные сведения о пользователе
+type UserProfile struct {
+	ID            int
+	Username      string
+	DisplayName   string
+	Bio           string
+	Joined        string // Пусто, если дата регистрации неизвестна
+	PostCount     int
+	CommentCount  int
+	ReceivedLikes int // Лайки постов и комментариев пользователя
+	Followers     int
+	Following     int
+}
+
+// ProfileComment — комментарий в профиле вместе с заголовком поста
+type ProfileComment struct {
+	ID        int
+	PostID    int
+	PostTitle string
+	Content   string
+	Likes     int
+	CreatedAt string
+}
+
+// ProfilePageData — данные для шаблона profile.html
+type ProfilePageData struct {
+	IsLoggedIn  bool
+	CurrentUser string
+	Profile     UserProfile
+	Tab         string // "posts" или "comments"
+	Posts       []Post
+	Comments    []ProfileComment
+	Page        int
+	HasNext     bool
+	IsFollowing bool // Текущий пользователь подписан на автора профиля
+}
+
+// AccountProfilePageData — данные для шаблона account_profile.html
+type AccountProfilePageData struct {
+	CurrentUser   string
+	DisplayName   string
+	Bio           string
+	HasAvatar     bool
+	AvatarVersion string
+	Saved         bool
+	Error         string
+}
+
+// queryUserProfile возвращает профиль пользователя по имени или sql.ErrNoRows
+func queryUserProfile(db *sql.DB, username string) (UserProfile, error) {
+	var p UserProfile
+	var joined sql.NullTime
+	err := db.QueryRow(`
+		SELECT u.id, u.username, u.display_name, u.bio, u.created_at,
+			(SELECT COUNT(*) FROM posts WHERE user_id = u.id AND publish_at IS NULL),
+			(SELECT COUNT(*) FROM comments WHERE user_id = u.id),
+			(SELECT COUNT(*) FROM likes l JOIN posts p ON l.post_id = p.id
+				WHERE p.user_id = u.id AND l.comment_id IS NULL AND l.is_like = true)
+			+ (SELECT COUNT(*) FROM likes l JOIN comments c ON l.comment_id = c.id
+				WHERE c.user_id = u.id AND l.post_id IS NULL AND l.is_like = true)
+		FROM users u
+		WHERE u.username = ?`, username,
+	).Scan(&p.ID, &p.Username, &p.DisplayName, &p.Bio, &joined, &p.PostCount, &p.CommentCount, &p.ReceivedLikes)
+	if err != nil {
+		return UserProfile{}, err
+	}
+	if joined.Valid {
+		p.Joined = joined.Time.Format("Jan 02, 2006")
+	}
+	return p, nil
+}
+
+// queryUserComments возвращает комментарии пользователя, новые сначала
+func queryUserComments(db *sql.DB, userID, limit, offset int) ([]ProfileComment, error) {
+	rows, err := db.Query(`
+		SELECT c.id, c.post_id, p.title, c.content,
+			(SELECT COUNT(*) FROM likes WHERE comment_id = c.id AND is_like = true AND post_id IS NULL),
+			c.created_at
+		FROM comments c
+		JOIN posts p ON c.post_id = p.id
+		WHERE c.user_id = ?
+		ORDER BY c.created_at DESC, c.id DESC
+		LIMIT ? OFFSET ?`, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []ProfileComment
+	for rows.Next() {
+		var c ProfileComment
+		var createdAt time.Time
+		if err := rows.Scan(&c.ID, &c.PostID, &c.PostTitle, &c.Content, &c.Likes, &createdAt); err != nil {
+			return nil, err
+		}
+		c.CreatedAt = formatDate(createdAt)
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
+
+// Profile показывает публичный профиль /user/{name}.
+// ?tab=comments переключает список на комментарии, ?page=N — номер страницы.
+func Profile(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		profile, err := queryUserProfile(db, r.PathValue("name"))
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Println("Error querying user profile:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		profile.Followers, profile.Following, err = followCounts(db, profile.ID)
+		if err != nil {
+			log.Println("Error counting follows:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		viewerID, username, isLoggedIn := sessionUser(db, r)
+		data := ProfilePageData{IsLoggedIn: isLoggedIn, CurrentUser: username, Profile: profile, Tab: "posts", Page: 1}
+		if isLoggedIn && viewerID != profile.ID {
+			data.IsFollowing = isFollowing(db, viewerID, profile.ID)
+		}
+		if r.URL.Query().Get("tab") == "comments" {
+			data.Tab = "comments"
+		}
+		if v := r.URL.Query().Get("page"); v != "" {
+			page, err := strconv.Atoi(v)
+			if err != nil || page < 1 {
+				http.Error(w, "Invalid page", http.StatusBadRequest)
+				return
+			}
+			data.Page = page
+		}
+		offset := (data.Page - 1) * profilePageSize
+
+		// Выбираем на одну запись больше, чтобы понять, есть ли следующая страница
+		if data.Tab == "posts" {
+			data.Posts, err = queryPosts(db, postQuery{ViewerID: viewerID, Author: profile.Username, Limit: profilePageSize + 1, Offset: offset})
+			if len(data.Posts) > profilePageSize {
+				data.Posts, data.HasNext = data.Posts[:profilePageSize], true
+			}
+		} else {
+			data.Comments, err = queryUserComments(db, profile.ID, profilePageSize+1, offset)
+			if len(data.Comments) > profilePageSize {
+				data.Comments, data.HasNext = data.Comments[:profilePageSize], true
+			}
+		}
+		if err != nil {
+			log.Println("Error querying profile activity:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		funcs := template.FuncMap{
+			"nl2br":    nl2br,
+			"markdown": markdownFunc(db),
+			"add":      func(a, b int) int { return a + b },
+		}
+		tmpl, err := template.New("profile.html").Funcs(funcs).ParseFiles("templates/profile.html")
+		if err != nil {
+			log.Println("Error parsing profile.html template:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		tmpl.Execute(w, data)
+	}
+}
+
+// AccountProfile обрабатывает /account/profile: форма (GET) и сохранение имени и описания (POST)
+func AccountProfile(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userID, _, ok := sessionUser(db, r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if r.Method == http.MethodGet {
+			renderAccountProfile(w, db, userID, "", r.URL.Query().Get("saved") == "1")
+			return
+		}
+
+		// Обработка POST-запроса: сохранение профиля
+		displayName := strings.TrimSpace(r.FormValue("display_name"))
+		bio := strings.TrimSpace(r.FormValue("bio"))
+		if err := validateProfile(displayName, bio); err != nil {
+			renderAccountProfile(w, db, userID, err.Error(), false)
+			return
+		}
+		if _, err := db.Exec("UPDATE users SET display_name = ?, bio = ? WHERE id = ?", displayName, bio, userID); err != nil {
+			log.Println("Error saving profile:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/account/profile?saved=1", http.StatusSeeOther)
+	}
+}
+
+// renderAccountProfile показывает форму профиля с сохранёнными значениями.
+// Непустой errMsg выводится как ошибка с кодом 400.
+func renderAccountProfile(w http.ResponseWriter, db *sql.DB, userID int, errMsg string, saved bool) {
+	data := AccountProfilePageData{Error: errMsg, Saved: saved}
+	var avatar string
+	err := db.QueryRow("SELECT username, display_name, bio, avatar FROM users WHERE id = ?", userID).
+		Scan(&data.CurrentUser, &data.DisplayName, &data.Bio, &avatar)
+	if err != nil {
+		log.Println("Error loading profile:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	data.HasAvatar = avatar != ""
+	data.AvatarVersion = avatar // Новый ключ после загрузки обходит кэш браузера
+
+	tmpl, err := template.ParseFiles("templates/account_profile.html")
+	if err != nil {
+		log.Println("Error parsing account_profile.html template:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	tmpl.Execute(w, data)
+}
@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Как часто планировщик проверяет, не пора ли опубликовать запланированные посты
+const schedulePollInterval = 30 * time.Second
+
+// ScheduledPost — пост автора, ожидающий публикации
+type ScheduledPost struct {
+	ID          int
+	Title       string
+	ImagePath   string
+	Tags        []string
+	PublishTime time.Time // Время публикации в UTC
+	PublishAt   string    // Время публикации для отображения
+	InputValue  string    // Время публикации в формате поля datetime-local
+}
+
+// ScheduledPageData определяет данные, передаваемые в шаблон scheduled.html
+type ScheduledPageData struct {
+	CurrentUser string
+	Posts       []ScheduledPost
+	Error       string
+}
+
+// StartPostScheduler публикует запланированные посты, когда приходит их время, до отмены ctx.
+// Время публикации хранится в БД, поэтому пропущенное во время простоя публикуется при запуске.
+func StartPostScheduler(ctx context.Context, db *sql.DB) {
+	ticker := time.NewTicker(schedulePollInterval)
+	defer ticker.Stop()
+	for {
+		publishDuePosts(db, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publishDuePosts публикует посты, время которых пришло, и возвращает их количество.
+// Опубликованный пост получает время создания в момент публикации и рассылает
+// обычные события, webhook и уведомления об упоминаниях.
+func publishDuePosts(db *sql.DB, now time.Time) int {
+	now = now.UTC() // publish_at хранится в UTC
+	rows, err := db.Query("SELECT id, user_id, title, content FROM posts WHERE publish_at IS NOT NULL AND publish_at <= ? ORDER BY publish_at, id", now)
+	if err != nil {
+		log.Println("Error querying scheduled posts:", err)
+		return 0
+	}
+	type due struct {
+		id, userID     int
+		title, content string
+	}
+	var batch []due
+	for rows.Next() {
+		var d due
+		if err := rows.Scan(&d.id, &d.userID, &d.title, &d.content); err != nil {
+			log.Println("Error scanning scheduled post:", err)
+			continue
+		}
+		batch = append(batch, d)
+	}
+	rows.Close()
+
+	published := 0
+	for _, d := range batch {
+		// Условие на publish_at не даёт опубликовать пост, который успели перенести или опубликовать
+		res, err := db.Exec("UPDATE posts SET publish_at = NULL, created_at = CURRENT_TIMESTAMP WHERE id = ? AND publish_at IS NOT NULL AND publish_at <= ?", d.id, now)
+		if err != nil {
+			log.Println("Error publishing scheduled post:", err)
+			continue
+		}
+		if count, _ := res.RowsAffected(); count == 0 {
+			continue
+		}
+		notifyMentions(db, d.userID, d.id, 0, d.title+"\n"+d.content, "")
+		publishPostCreated(db, d.id)
+		published++
+	}
+	return published
+}
+
+// queryScheduledPosts возвращает запланированные посты пользователя, ближайшие первыми
+func queryScheduledPosts(db *sql.DB, userID int) ([]ScheduledPost, error) {
+	rows, err := db.Query(`
+		SELECT id, title, COALESCE(image_path, ''), publish_at FROM posts
+		WHERE user_id = ? AND publish_at IS NOT NULL
+		ORDER BY publish_at, id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	posts := []ScheduledPost{}
+	for rows.Next() {
+		var p ScheduledPost
+		if err := rows.Scan(&p.ID, &p.Title, &p.ImagePath, &p.PublishTime); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		p.PublishTime = p.PublishTime.UTC()
+		p.PublishAt = formatDate(p.PublishTime) + " UTC"
+		p.InputValue = p.PublishTime.Format(publishAtLayout)
+		posts = append(posts, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range posts {
+		if posts[i].Tags, err = queryPostTags(db, posts[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return posts, nil
+}
+
+// unschedulePost превращает запланированный пост пользователя обратно в черновик и удаляет пост.
+// Черновик создаётся и пост удаляется в одной транзакции, поэтому пост, который успели
+// опубликовать, остаётся опубликованным без лишнего черновика. Изображение переходит к черновику.
+// Возвращает sql.ErrNoRows, если такого запланированного поста нет.
+func unschedulePost(db *sql.DB, userID, postID int) (Draft, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return Draft{}, err
+	}
+	defer tx.Rollback()
+
+	d := Draft{}
+	var imagePath sql.NullString
+	err = tx.QueryRow("SELECT title, content, image_path FROM posts WHERE id = ? AND user_id = ? AND publish_at IS NOT NULL",
+		postID, userID).Scan(&d.Title, &d.Content, &imagePath)
+	if err != nil {
+		return Draft{}, err
+	}
+	d.ImagePath = imagePath.String
+
+	rows, err := tx.Query("SELECT category_id FROM post_categories WHERE post_id = ? ORDER BY category_id", postID)
+	if err != nil {
+		return Draft{}, err
+	}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return Draft{}, err
+		}
+		d.CategoryIDs = append(d.CategoryIDs, id)
+	}
+	rows.Close()
+
+	rows, err = tx.Query(`
+		SELECT t.name FROM tags t
+		JOIN post_tags pt ON pt.tag_id = t.id
+		WHERE pt.post_id = ?
+		ORDER BY t.name`, postID)
+	if err != nil {
+		return Draft{}, err
+	}
+	var tags []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return Draft{}, err
+		}
+		tags = append(tags, name)
+	}
+	rows.Close()
+	d.Tags = strings.Join(tags, ", ")
+
+	if err := insertDraft(tx, userID, &d); err != nil {
+		return Draft{}, err
+	}
+	if err := deletePostRelations(tx, postID); err != nil {
+		return Draft{}, err
+	}
+	// Условие на publish_at не даёт удалить пост, который опубликовали после чтения
+	res, err := tx.Exec("DELETE FROM posts WHERE id = ? AND publish_at IS NOT NULL", postID)
+	if err != nil {
+		return Draft{}, err
+	}
+	if count, _ := res.RowsAffected(); count == 0 {
+		return Draft{}, sql.ErrNoRows
+	}
+	if err := pruneTags(tx); err != nil {
+		return Draft{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Draft{}, err
+	}
+	return d, nil
+}
+
+// renderScheduled выводит страницу запланированных постов с сообщением об ошибке (если есть)
+func renderScheduled(w http.ResponseWriter, db *sql.DB, userID int, username, errMsg string) {
+	posts, err := queryScheduledPosts(db, userID)
+	if err != nil {
+		log.Println("Error fetching scheduled posts:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	tmpl, err := template.ParseFiles("templates/scheduled.html")
+	if err != nil {
+		log.Println("Error parsing scheduled.html template:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	tmpl.Execute(w, ScheduledPageData{CurrentUser: username, Posts: posts, Error: errMsg})
+}
+
+// ScheduledPosts выводит страницу «Запланированные посты» текущего пользователя
+func ScheduledPosts(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userID, username, ok := sessionUser(db, r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		renderScheduled(w, db, userID, username, "")
+	}
+}
+
+// ReschedulePost переносит публикацию запланированного поста текущего пользователя
+func ReschedulePost(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userID, username, ok := sessionUser(db, r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		postID, err := strconv.Atoi(r.FormValue("post_id"))
+		if err != nil {
+			http.Error(w, "Invalid post ID", http.StatusBadRequest)
+			return
+		}
+		publishAt, err := parsePublishAt(r.FormValue("publish_at"), time.Now())
+		if err == nil && publishAt.IsZero() {
+			err = errInvalidPublishAt
+		}
+		if err != nil {
+			renderScheduled(w, db, userID, username, err.Error())
+			return
+		}
+
+		res, err := db.Exec("UPDATE posts SET publish_at = ? WHERE id = ? AND user_id = ? AND publish_at IS NOT NULL", publishAt.UTC(), postID, userID)
+		if err != nil {
+			log.Println("Error rescheduling post:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if count, _ := res.RowsAffected(); count == 0 {
+			http.Error(w, "Scheduled post not found", http.StatusNotFound)
+			return
+		}
+		http.Redirect(w, r, "/scheduled", http.StatusSeeOther)
+	}
+}
+
+// CancelScheduledPost отменяет публикацию: пост возвращается в черновики, где его можно доработать
+func CancelScheduledPost(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userID, username, ok := sessionUser(db, r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		postID, err := strconv.Atoi(r.FormValue("post_id"))
+		if err != nil {
+			http.Error(w, "Invalid post ID", http.StatusBadRequest)
+			return
+		}
+		draft, err := unschedulePost(db, userID, postID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Scheduled post not found", http.StatusNotFound)
+			return
+		}
+		if err == errTooManyDrafts {
+			renderScheduled(w, db, userID, username, err.Error())
+			return
+		}
+		if err != nil {
+			log.Println("Error cancelling scheduled post:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/post/create?draft="+strconv.Itoa(draft.ID), http.StatusSeeOther)
+	}
+}
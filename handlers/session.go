@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+)
+
+// sessionUser возвращает пользователя по сессионной куке; ok = false для гостя
+// или просроченной сессии
+func sessionUser(db *sql.DB, r *http.Request) (userID int, username string, ok bool) {
+	cookie, err := r.Cookie("session_id")
+	if err != nil {
+		return 0, "", false
+	}
+	err = db.QueryRow(`
+		SELECT u.id, u.username
+		FROM sessions s
+		JOIN users u ON s.user_id = u.id
+		WHERE s.id = ? AND s.expiry > ?`, cookie.Value, time.Now(),
+	).Scan(&userID, &username)
+	if err != nil {
+		return 0, "", false
+	}
+	return userID, username, true
+}
@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// Операции записи, общие для HTML-обработчиков и JSON API.
+// Проверка прав и валидация выполняются вызывающей стороной.
+
+// imageChange описывает, что сделать с изображением поста при обновлении
+type imageChange struct {
+	Set    string // Новый путь к изображению
+	Remove bool   // Удалить текущее изображение
+}
+
+// insertPost создаёт пост вместе со связями категорий и тегами в одной транзакции.
+// Пост с ненулевым publishAt остаётся скрытым до публикации планировщиком; упомянутые
+// узнают о нём тогда же.
+func insertPost(db *sql.DB, userID int, title, content, imagePath string, categoryIDs []int, tags []string, publishAt time.Time) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() // Откат транзакции в случае ошибки
+
+	var imageValue interface{}
+	if imagePath != "" {
+		imageValue = imagePath
+	}
+	var publishValue interface{}
+	if !publishAt.IsZero() {
+		publishValue = publishAt.UTC()
+	}
+	res, err := tx.Exec("INSERT INTO posts (user_id, title, content, image_path, publish_at) VALUES (?, ?, ?, ?, ?)", userID, title, content, imageValue, publishValue)
+	if err != nil {
+		return 0, err
+	}
+	postID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := linkCategories(tx, int(postID), categoryIDs); err != nil {
+		return 0, err
+	}
+	if err := linkTags(tx, int(postID), tags); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	subscribeThread(db, userID, int(postID))
+	if publishAt.IsZero() {
+		notifyMentions(db, userID, int(postID), 0, title+"\n"+content, "")
+	}
+	return int(postID), nil
+}
+
+// updatePost обновляет пост и заменяет его категории и теги; уведомляет только вновь упомянутых
+func updatePost(db *sql.DB, postID int, title, content string, image imageChange, categoryIDs []int, tags []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Прежний текст нужен, чтобы уведомить только новых упомянутых
+	var authorID int
+	var oldTitle, oldContent string
+	if err := tx.QueryRow("SELECT user_id, title, content FROM posts WHERE id = ?", postID).Scan(&authorID, &oldTitle, &oldContent); err != nil {
+		return err
+	}
+
+	if image.Set != "" {
+		_, err = tx.Exec("UPDATE posts SET title = ?, content = ?, image_path = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", title, content, image.Set, postID)
+	} else if image.Remove {
+		_, err = tx.Exec("UPDATE posts SET title = ?, content = ?, image_path = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = ?", title, content, postID)
+	} else {
+		_, err = tx.Exec("UPDATE posts SET title = ?, content = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", title, content, postID)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Удаляем старые связи с категориями и добавляем новые
+	if _, err := tx.Exec("DELETE FROM post_categories WHERE post_id = ?", postID); err != nil {
+		return err
+	}
+	if err := linkCategories(tx, postID, categoryIDs); err != nil {
+		return err
+	}
+
+	// Теги заменяются так же; теги, которые больше ни у кого не остались, удаляются
+	if _, err := tx.Exec("DELETE FROM post_tags WHERE post_id = ?", postID); err != nil {
+		return err
+	}
+	if err := linkTags(tx, postID, tags); err != nil {
+		return err
+	}
+	if err := pruneTags(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	notifyMentions(db, authorID, postID, 0, title+"\n"+content, oldTitle+"\n"+oldContent)
+	return nil
+}
+
+// linkCategories добавляет связи пост-категория
+func linkCategories(tx *sql.Tx, postID int, categoryIDs []int) error {
+	if len(categoryIDs) == 0 {
+		return nil
+	}
+	stmt, err := tx.Prepare("INSERT INTO post_categories (post_id, category_id) VALUES (?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, catID := range categoryIDs {
+		if _, err := stmt.Exec(postID, catID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deletePost удаляет пост вместе с лайками, комментариями, связями категорий и тегов
+func deletePost(db *sql.DB, postID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := deletePostRelations(tx, postID); err != nil {
+		return err
+	}
+	res, err := tx.Exec("DELETE FROM posts WHERE id = ?", postID)
+	if err != nil {
+		return err
+	}
+	if count, _ := res.RowsAffected(); count == 0 {
+		return sql.ErrNoRows
+	}
+	if err := pruneTags(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deletePostRelations удаляет в транзакции tx всё, что ссылается на пост: лайки, комментарии,
+// связи категорий и тегов, уведомления, закладки и подписки. Сам пост удаляет вызывающий.
+func deletePostRelations(tx *sql.Tx, postID int) error {
+	queries := []string{
+		"DELETE FROM likes WHERE comment_id IN (SELECT id FROM comments WHERE post_id = ?)",
+		"DELETE FROM likes WHERE post_id = ?",
+		"DELETE FROM comments WHERE post_id = ?",
+		"DELETE FROM post_categories WHERE post_id = ?",
+		"DELETE FROM post_tags WHERE post_id = ?",
+		"DELETE FROM notifications WHERE post_id = ?",
+		"DELETE FROM bookmarks WHERE post_id = ?",
+		"DELETE FROM thread_subscriptions WHERE post_id = ?",
+	}
+	for _, q := range queries {
+		if _, err := tx.Exec(q, postID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertComment сохраняет комментарий к посту и уведомляет подписчиков темы
+func insertComment(db *sql.DB, postID, userID int, content string) (int, error) {
+	res, err := db.Exec("INSERT INTO comments (post_id, user_id, content) VALUES (?, ?, ?)", postID, userID, content)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	// Комментатор подписывается на тему и узнает о следующих ответах
+	subscribeThread(db, userID, postID)
+	notifyThread(db, postID, int(id), userID)
+	notifyMentions(db, userID, postID, int(id), content, "")
+	return int(id), nil
+}
+
+// updateComment изменяет текст комментария; уведомляет только вновь упомянутых
+func updateComment(db *sql.DB, commentID int, content string) error {
+	var authorID, postID int
+	var oldContent string
+	err := db.QueryRow("SELECT user_id, post_id, content FROM comments WHERE id = ?", commentID).Scan(&authorID, &postID, &oldContent)
+	if err != nil {
+		return err
+	}
+	res, err := db.Exec("UPDATE comments SET content = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", content, commentID)
+	if err != nil {
+		return err
+	}
+	if count, _ := res.RowsAffected(); count == 0 {
+		return sql.ErrNoRows
+	}
+	notifyMentions(db, authorID, postID, commentID, content, oldContent)
+	return nil
+}
+
+// deleteComment удаляет комментарий вместе с его лайками
+func deleteComment(db *sql.DB, commentID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM likes WHERE comment_id = ?", commentID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM notifications WHERE comment_id = ?", commentID); err != nil {
+		return err
+	}
+	res, err := tx.Exec("DELETE FROM comments WHERE id = ?", commentID)
+	if err != nil {
+		return err
+	}
+	if count, _ := res.RowsAffected(); count == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+// setVote устанавливает голос пользователя за пост (commentID == 0) или комментарий:
+// 1 — лайк, -1 — дизлайк, 0 — снять голос. Автор получает уведомление о лайке;
+// если лайк снят или заменён дизлайком, непрочитанное уведомление удаляется.
+func setVote(db *sql.DB, userID, postID, commentID, value int) error {
+	if err := saveVote(db, userID, postID, commentID, value); err != nil {
+		return err
+	}
+
+	kind := notifyPostLike
+	var authorID int
+	var err error
+	if commentID == 0 {
+		err = db.QueryRow("SELECT user_id FROM posts WHERE id = ?", postID).Scan(&authorID)
+	} else {
+		// Уведомление о лайке комментария ссылается и на пост, чтобы вести к нему
+		kind = notifyCommentLike
+		err = db.QueryRow("SELECT user_id, post_id FROM comments WHERE id = ?", commentID).Scan(&authorID, &postID)
+	}
+	if err != nil {
+		log.Println("Error querying author for notification:", err)
+		return nil
+	}
+	if value == 1 {
+		notify(db, authorID, userID, kind, postID, commentID)
+	} else {
+		withdrawNotification(db, authorID, userID, kind, postID, commentID)
+	}
+	return nil
+}
+
+// saveVote записывает голос в таблицу likes
+func saveVote(db *sql.DB, userID, postID, commentID, value int) error {
+	var target string
+	var targetID int
+	if commentID == 0 {
+		target, targetID = "post_id = ? AND comment_id IS NULL", postID
+	} else {
+		target, targetID = "comment_id = ? AND post_id IS NULL", commentID
+	}
+
+	if value == 0 {
+		_, err := db.Exec("DELETE FROM likes WHERE user_id = ? AND "+target, userID, targetID)
+		return err
+	}
+
+	isLike := value > 0
+	res, err := db.Exec("UPDATE likes SET is_like = ? WHERE user_id = ? AND "+target, isLike, userID, targetID)
+	if err != nil {
+		return err
+	}
+	if count, _ := res.RowsAffected(); count > 0 {
+		return nil
+	}
+
+	// Голоса нет, вставляем новый
+	if commentID == 0 {
+		_, err = db.Exec("INSERT INTO likes(user_id, post_id, is_like) VALUES(?, ?, ?)", userID, postID, isLike)
+	} else {
+		_, err = db.Exec("INSERT INTO likes(user_id, comment_id, is_like) VALUES(?, ?, ?)", userID, commentID, isLike)
+	}
+	return err
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"01.tomorrow-school.ai/git/zsakhipo/forum/database"
+)
+
+// subscribeThread подписывает пользователя на комментарии к посту.
+// Заглушённая ранее подписка не возобновляется: автоматическая подписка
+// не должна отменять явный выбор пользователя.
+func subscribeThread(db *sql.DB, userID, postID int) {
+	if _, err := db.Exec("INSERT OR IGNORE INTO thread_subscriptions (user_id, post_id) VALUES (?, ?)", userID, postID); err != nil {
+		log.Println("Error subscribing to thread:", err)
+	}
+}
+
+// threadSubscribed сообщает, получает ли пользователь уведомления о комментариях к посту.
+// Автор поста без записи о подписке считается подписанным: его посты могли появиться до подписок.
+func threadSubscribed(db *sql.DB, userID, postID, authorID int) (bool, error) {
+	var muted bool
+	err := db.QueryRow("SELECT muted FROM thread_subscriptions WHERE user_id = ? AND post_id = ?", userID, postID).Scan(&muted)
+	if err == sql.ErrNoRows {
+		return userID == authorID, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !muted, nil
+}
+
+// notifyThread рассылает уведомления о новом комментарии: автору поста — notifyComment,
+// остальным подписчикам — notifyReply. Автор комментария и заглушившие тему пропускаются.
+func notifyThread(db *sql.DB, postID, commentID, actorID int) {
+	var authorID int
+	if err := db.QueryRow("SELECT user_id FROM posts WHERE id = ?", postID).Scan(&authorID); err != nil {
+		log.Println("Error querying post author for notification:", err)
+		return
+	}
+	if subscribed, err := threadSubscribed(db, authorID, postID, authorID); err != nil {
+		log.Println("Error checking thread subscription:", err)
+	} else if subscribed {
+		notify(db, authorID, actorID, notifyComment, postID, commentID)
+	}
+
+	rows, err := db.Query(`
+		SELECT user_id FROM thread_subscriptions
+		WHERE post_id = ? AND muted = false AND user_id NOT IN (?, ?)`, postID, actorID, authorID)
+	if err != nil {
+		log.Println("Error querying thread subscribers:", err)
+		return
+	}
+	var subscribers []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			log.Println("Error scanning thread subscriber:", err)
+			break
+		}
+		subscribers = append(subscribers, id)
+	}
+	rows.Close()
+	for _, id := range subscribers {
+		notify(db, id, actorID, notifyReply, postID, commentID)
+	}
+}
+
+// SubscribeThread включает (action=subscribe) или заглушает (action=mute)
+// уведомления о комментариях к посту: POST /post/{id}/subscribe
+func SubscribeThread(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userID, _, ok := sessionUser(db, r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		postID, ok := pathID(r, "id")
+		if !ok || !database.PostExists(db, postID) {
+			http.NotFound(w, r)
+			return
+		}
+
+		var muted bool
+		switch r.FormValue("action") {
+		case "subscribe":
+		case "mute":
+			muted = true
+		default:
+			http.Error(w, "Invalid action", http.StatusBadRequest)
+			return
+		}
+		_, err := db.Exec(`
+			INSERT INTO thread_subscriptions (user_id, post_id, muted) VALUES (?, ?, ?)
+			ON CONFLICT(user_id, post_id) DO UPDATE SET muted = excluded.muted`, userID, postID, muted)
+		if err != nil {
+			log.Println("Error saving thread subscription:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		// Перенаправление на пост, сохраняя текущую категорию
+		redirectURL := "/posts"
+		if category := r.FormValue("redirect_category"); category != "" {
+			redirectURL += "?category=" + url.QueryEscape(category)
+		}
+		http.Redirect(w, r, redirectURL+"#post-"+strconv.Itoa(postID), http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"database/sql"
+	"sort"
+)
+
+// Количество тегов в облаке на странице постов
+const tagCloudSize = 30
+
+// linkTags добавляет теги к посту, создавая недостающие; теги должны быть нормализованы
+func linkTags(tx *sql.Tx, postID int, tags []string) error {
+	for _, tag := range tags {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO tags (name) VALUES (?)", tag); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT OR IGNORE INTO post_tags (post_id, tag_id) SELECT ?, id FROM tags WHERE name = ?", postID, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneTags удаляет теги, которые не отмечают ни одного поста
+func pruneTags(tx *sql.Tx) error {
+	_, err := tx.Exec("DELETE FROM tags WHERE id NOT IN (SELECT tag_id FROM post_tags)")
+	return err
+}
+
+// queryPostTags возвращает теги поста по алфавиту
+func queryPostTags(db *sql.DB, postID int) ([]string, error) {
+	rows, err := db.Query(`
+		SELECT t.name FROM tags t
+		JOIN post_tags pt ON pt.tag_id = t.id
+		WHERE pt.post_id = ?
+		ORDER BY t.name`, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tags := []string{}
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// queryTags возвращает самые используемые теги, начинающиеся с prefix (пустой — все теги).
+// Учитываются только опубликованные посты.
+func queryTags(db *sql.DB, prefix string, limit int) ([]Tag, error) {
+	rows, err := db.Query(`
+		SELECT t.name, COUNT(pt.post_id) AS cnt FROM tags t
+		JOIN post_tags pt ON pt.tag_id = t.id
+		JOIN posts p ON p.id = pt.post_id AND p.publish_at IS NULL
+		WHERE substr(t.name, 1, length(?)) = ?
+		GROUP BY t.id
+		ORDER BY cnt DESC, t.name
+		LIMIT ?`, prefix, prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tags := []Tag{}
+	for rows.Next() {
+		var t Tag
+		if err := rows.Scan(&t.Name, &t.PostCount); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// tagCloud возвращает популярные теги по алфавиту с весом 1–4 относительно самого частого тега
+func tagCloud(db *sql.DB) ([]Tag, error) {
+	tags, err := queryTags(db, "", tagCloudSize)
+	if err != nil || len(tags) == 0 {
+		return tags, err
+	}
+	most := tags[0].PostCount
+	for i := range tags {
+		tags[i].Weight = 1 + 3*(tags[i].PostCount-1)/max(most-1, 1)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags, nil
+}
@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Права, которые можно выдать API-токену
+const (
+	scopeRead     = "read"     // Чтение постов, комментариев и категорий
+	scopeWrite    = "write"    // Создание, изменение и удаление своего контента, голосование
+	scopeModerate = "moderate" // Удаление чужого контента (только для модераторов и администраторов)
+	scopeAdmin    = "admin"    // Управление категориями (только для администраторов)
+)
+
+// Префикс токенов, чтобы их было легко узнать в логах и конфигурации
+const tokenPrefix = "fpat_"
+
+// Максимальное количество активных токенов у одного пользователя
+const maxTokensPerUser = 20
+
+// APIToken — токен в списке на странице аккаунта
+type APIToken struct {
+	ID         int
+	Name       string
+	Scopes     []string
+	CreatedAt  string
+	LastUsedAt string // Пусто, если токен ещё не использовался
+	ExpiresAt  string // Пусто, если токен бессрочный
+	Expired    bool
+}
+
+// TokensPageData определяет данные, передаваемые в шаблон account_tokens.html
+type TokensPageData struct {
+	CurrentUser   string
+	IsModerator   bool
+	IsAdmin       bool
+	Tokens        []APIToken
+	NewToken      string // Новый токен показывается один раз сразу после создания
+	Error         string
+	AllowedScopes []string
+}
+
+// generateToken создаёт случайный токен и его хеш для хранения в БД
+func generateToken() (token, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token = tokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashToken(token), nil
+}
+
+// hashToken возвращает SHA-256 от токена в hex
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// isModeratorRole сообщает, может ли роль модерировать контент
+func isModeratorRole(role string) bool {
+	return role == "moderator" || role == "admin"
+}
+
+// allowedScopes возвращает права, которые пользователь с данной ролью может выдать токену
+func allowedScopes(role string) []string {
+	scopes := []string{scopeRead, scopeWrite}
+	if isModeratorRole(role) {
+		scopes = append(scopes, scopeModerate)
+	}
+	if role == "admin" {
+		scopes = append(scopes, scopeAdmin)
+	}
+	return scopes
+}
+
+// authenticateToken проверяет Bearer-токен и отмечает время его использования
+func authenticateToken(db *sql.DB, token string) (apiUser, bool) {
+	var u apiUser
+	var tokenID int
+	var scopes string
+	var expiresAt sql.NullTime
+	err := db.QueryRow(`
+		SELECT t.id, t.scopes, t.expires_at, u.id, u.username, u.role
+		FROM api_tokens t
+		JOIN users u ON t.user_id = u.id
+		WHERE t.token_hash = ?`, hashToken(token),
+	).Scan(&tokenID, &scopes, &expiresAt, &u.ID, &u.Username, &u.Role)
+	if err != nil {
+		return apiUser{}, false
+	}
+	if expiresAt.Valid && !expiresAt.Time.After(time.Now()) {
+		return apiUser{}, false
+	}
+
+	if _, err := db.Exec("UPDATE api_tokens SET last_used_at = ? WHERE id = ?", time.Now(), tokenID); err != nil {
+		log.Println("Error updating token last_used_at:", err)
+	}
+	u.Scopes = strings.Split(scopes, ",")
+	u.TokenID = tokenID
+	return u, true
+}
+
+// AccountTokens обрабатывает страницу /account/tokens: список токенов и создание нового
+func AccountTokens(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Проверка сессии пользователя
+		cookie, err := r.Cookie("session_id")
+		if err != nil {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		var userID int
+		var username, role string
+		err = db.QueryRow("SELECT u.id, u.username, u.role FROM sessions s JOIN users u ON s.user_id = u.id WHERE s.id = ? AND s.expiry > ?", cookie.Value, time.Now()).Scan(&userID, &username, &role)
+		if err != nil {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		data := TokensPageData{
+			CurrentUser:   username,
+			IsModerator:   isModeratorRole(role),
+			IsAdmin:       role == "admin",
+			AllowedScopes: allowedScopes(role),
+		}
+		status := http.StatusOK
+
+		// Обработка POST-запроса: создание токена
+		if r.Method == http.MethodPost {
+			token, errMsg := createToken(db, userID, role, r)
+			if errMsg != "" {
+				data.Error = errMsg
+				status = http.StatusBadRequest
+			} else if token == "" {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			data.NewToken = token
+		}
+
+		data.Tokens, err = queryTokens(db, userID)
+		if err != nil {
+			log.Println("Error fetching API tokens:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		tmpl, err := template.ParseFiles("templates/account_tokens.html")
+		if err != nil {
+			log.Println("Error parsing account_tokens.html template:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		tmpl.Execute(w, data)
+	}
+}
+
+// createToken проверяет форму и создаёт токен. Возвращает токен или сообщение об ошибке;
+// пустые оба значения означают внутреннюю ошибку.
+func createToken(db *sql.DB, userID int, role string, r *http.Request) (string, string) {
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" || utf8.RuneCountInString(name) > 50 {
+		return "", "Token name must be between 1 and 50 characters."
+	}
+
+	// Проверяем выбранные права
+	allowed := allowedScopes(role)
+	var scopes []string
+	for _, s := range r.Form["scopes"] {
+		ok := false
+		for _, a := range allowed {
+			if s == a {
+				ok = true
+			}
+		}
+		if !ok {
+			return "", "Invalid scope selected."
+		}
+		if !containsString(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	if len(scopes) == 0 {
+		return "", "Select at least one scope."
+	}
+
+	// Срок действия в днях, 0 — бессрочный
+	var expiresAt interface{}
+	if v := r.FormValue("expires_in"); v != "" && v != "0" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 1 || days > 365 {
+			return "", "Expiry must be between 1 and 365 days."
+		}
+		expiresAt = time.Now().Add(time.Duration(days) * 24 * time.Hour)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM api_tokens WHERE user_id = ?", userID).Scan(&count); err != nil {
+		log.Println("Error counting API tokens:", err)
+		return "", ""
+	}
+	if count >= maxTokensPerUser {
+		return "", "Too many tokens. Revoke unused tokens first."
+	}
+
+	token, hash, err := generateToken()
+	if err != nil {
+		log.Println("Error generating API token:", err)
+		return "", ""
+	}
+	_, err = db.Exec("INSERT INTO api_tokens (user_id, name, token_hash, scopes, expires_at) VALUES (?, ?, ?, ?, ?)",
+		userID, name, hash, strings.Join(scopes, ","), expiresAt)
+	if err != nil {
+		log.Println("Error inserting API token:", err)
+		return "", ""
+	}
+	return token, ""
+}
+
+// queryTokens возвращает токены пользователя, новые сначала
+func queryTokens(db *sql.DB, userID int) ([]APIToken, error) {
+	rows, err := db.Query(`
+		SELECT id, name, scopes, created_at, last_used_at, expires_at
+		FROM api_tokens
+		WHERE user_id = ?
+		ORDER BY created_at DESC, id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		var t APIToken
+		var scopes string
+		var createdAt time.Time
+		var lastUsed, expires sql.NullTime
+		if err := rows.Scan(&t.ID, &t.Name, &scopes, &createdAt, &lastUsed, &expires); err != nil {
+			return nil, err
+		}
+		t.Scopes = strings.Split(scopes, ",")
+		t.CreatedAt = formatDate(createdAt)
+		if lastUsed.Valid {
+			t.LastUsedAt = formatDate(lastUsed.Time)
+		}
+		if expires.Valid {
+			t.ExpiresAt = formatDate(expires.Time)
+			t.Expired = !expires.Time.After(time.Now())
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// RevokeToken удаляет токен текущего пользователя
+func RevokeToken(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Проверка сессии пользователя
+		cookie, err := r.Cookie("session_id")
+		if err != nil {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		var userID int
+		err = db.QueryRow("SELECT user_id FROM sessions WHERE id = ? AND expiry > ?", cookie.Value, time.Now()).Scan(&userID)
+		if err != nil {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		tokenID, err := strconv.Atoi(r.FormValue("token_id"))
+		if err != nil {
+			http.Error(w, "Invalid token ID", http.StatusBadRequest)
+			return
+		}
+
+		// Удаляем только собственный токен пользователя
+		res, err := db.Exec("DELETE FROM api_tokens WHERE id = ? AND user_id = ?", tokenID, userID)
+		if err != nil {
+			log.Println("Error revoking API token:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if count, _ := res.RowsAffected(); count == 0 {
+			http.Error(w, "Token not found", http.StatusNotFound)
+			return
+		}
+
+		http.Redirect(w, r, "/account/tokens", http.StatusSeeOther)
+	}
+}
+
+// containsAnyString сообщает, есть ли в list хотя бы одна из строк values
+func containsAnyString(list, values []string) bool {
+	for _, v := range values {
+		if containsString(list, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsString сообщает, есть ли строка в срезе
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
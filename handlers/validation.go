@@ -0,0 +1,354 @@
+package handlers
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"01.tomorrow-school.ai/git/zsakhipo/forum/database"
+)
+
+// Ограничения на длину пользовательского контента (в символах unicode)
+const (
+	maxTitleLength   = 120
+	maxContentLength = 500
+	maxCommentLength = 120
+	maxMessageLength = maxCommentLength // Личные сообщения ограничены так же, как комментарии
+
+	maxDisplayNameLength = 40
+	maxBioLength         = 300
+
+	maxCategoryNameLength        = 40
+	maxCategorySlugLength        = 40
+	maxCategoryDescriptionLength = 200
+
+	maxTagsPerPost = 5
+	maxTagLength   = 30
+
+	// Черновик может быть неполным и длиннее поста: лимиты поста проверяются при публикации
+	maxDraftsPerUser      = 50
+	maxDraftTitleLength   = 4 * maxTitleLength
+	maxDraftContentLength = 20 * maxContentLength
+
+	maxScheduleAhead = 365 * 24 * time.Hour // Насколько далеко вперёд можно запланировать пост
+)
+
+// publishAtLayout — формат поля datetime-local; время указывается в UTC
+const publishAtLayout = "2006-01-02T15:04"
+
+// validationError — ошибка валидации, текст которой можно показать пользователю
+type validationError string
+
+func (e validationError) Error() string { return string(e) }
+
+// Ошибки валидации, общие для HTML-форм и JSON API
+const (
+	errEmptyPost          validationError = "Title and content cannot be empty or only spaces."
+	errTitleTooLong       validationError = "Title cannot exceed 120 characters (unicode)."
+	errContentTooLong     validationError = "Content cannot exceed 500 characters (unicode)."
+	errEmptyComment       validationError = "Comment cannot be empty."
+	errCommentTooLong     validationError = "Comment cannot exceed 120 characters (unicode)."
+	errDuplicateCategory  validationError = "Duplicate categories are not allowed."
+	errInvalidCategory    validationError = "Invalid category selected."
+	errArchivedCategory   validationError = "Archived categories do not accept new posts."
+	errEmptyMessage       validationError = "Message cannot be empty."
+	errMessageTooLong     validationError = "Message cannot exceed 120 characters (unicode)."
+	errDisplayNameTooLong validationError = "Display name cannot exceed 40 characters (unicode)."
+	errBioTooLong         validationError = "Bio cannot exceed 300 characters (unicode)."
+
+	errEmptyCategoryName          validationError = "Category name cannot be empty."
+	errCategoryNameTooLong        validationError = "Category name cannot exceed 40 characters (unicode)."
+	errCategoryNameTaken          validationError = "A category with this name already exists."
+	errInvalidCategorySlug        validationError = "Slug may contain only lowercase letters, digits and single dashes (max 40 characters)."
+	errCategorySlugTaken          validationError = "This slug is already used by another category."
+	errCategoryDescriptionTooLong validationError = "Category description cannot exceed 200 characters (unicode)."
+	errInvalidCategoryColor       validationError = "Color must be a hex value such as #3b82f6."
+	errInvalidCategoryIcon        validationError = "Icon must be a Font Awesome icon name such as code or book-open."
+	errMergeIntoSelf              validationError = "A category cannot be merged into itself."
+	errMergeIntoChild             validationError = "A category cannot be merged into its own subcategory."
+	errInvalidParentCategory      validationError = "The parent must be another top-level category."
+	errCategoryHasChildren        validationError = "A category with subcategories cannot become a subcategory."
+	errInvalidPostingRule         validationError = "Invalid posting rule."
+	errReadOnlyPost               validationError = "This post is in a read-only category and cannot be edited."
+
+	errTooManyTags   validationError = "A post can have at most 5 tags."
+	errTooManyDrafts validationError = "You can keep at most 50 drafts. Publish or delete some first."
+	errDraftTooLong  validationError = "Draft is too long to save."
+	errInvalidTag    validationError = "Tags may contain only letters, digits, dashes, dots and plus signs and must start with a letter or digit (max 30 characters)."
+
+	errInvalidPublishAt validationError = "Invalid publish time."
+	errPublishAtPast    validationError = "Publish time must be in the future."
+	errPublishAtTooFar  validationError = "Posts can be scheduled at most a year ahead."
+)
+
+// validatePost проверяет заголовок и содержание поста
+func validatePost(title, content string) error {
+	if strings.TrimSpace(title) == "" || strings.TrimSpace(content) == "" {
+		return errEmptyPost
+	}
+	if utf8.RuneCountInString(title) > maxTitleLength {
+		return errTitleTooLong
+	}
+	if utf8.RuneCountInString(content) > maxContentLength {
+		return errContentTooLong
+	}
+	return nil
+}
+
+// validateComment проверяет текст комментария
+func validateComment(content string) error {
+	if strings.TrimSpace(content) == "" {
+		return errEmptyComment
+	}
+	if utf8.RuneCountInString(content) > maxCommentLength {
+		return errCommentTooLong
+	}
+	return nil
+}
+
+// validateMessage проверяет текст личного сообщения
+func validateMessage(content string) error {
+	if strings.TrimSpace(content) == "" {
+		return errEmptyMessage
+	}
+	if utf8.RuneCountInString(content) > maxMessageLength {
+		return errMessageTooLong
+	}
+	return nil
+}
+
+// validateProfile проверяет отображаемое имя и описание профиля; оба поля необязательны
+func validateProfile(displayName, bio string) error {
+	if utf8.RuneCountInString(displayName) > maxDisplayNameLength {
+		return errDisplayNameTooLong
+	}
+	if utf8.RuneCountInString(bio) > maxBioLength {
+		return errBioTooLong
+	}
+	return nil
+}
+
+// validateCategory приводит поля категории к виду для хранения и проверяет их.
+// categoryID — изменяемая категория (0 для новой). Пустой slug новой категории
+// формируется из имени, у существующей — остаётся прежним.
+func validateCategory(db *sql.DB, in *categoryInput, categoryID int) error {
+	in.Name = strings.Join(strings.Fields(normalizeText(in.Name)), " ")
+	in.Description = strings.TrimSpace(normalizeText(in.Description))
+	in.Slug = strings.TrimSpace(in.Slug)
+	in.Color = strings.ToLower(strings.TrimSpace(in.Color))
+	in.Icon = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(in.Icon)), "fa-")
+
+	if in.Name == "" {
+		return errEmptyCategoryName
+	}
+	if utf8.RuneCountInString(in.Name) > maxCategoryNameLength {
+		return errCategoryNameTooLong
+	}
+	if utf8.RuneCountInString(in.Description) > maxCategoryDescriptionLength {
+		return errCategoryDescriptionTooLong
+	}
+	if in.Color != "" && !isHexColor(in.Color) {
+		return errInvalidCategoryColor
+	}
+	if in.Icon != "" && !isIconName(in.Icon) {
+		return errInvalidCategoryIcon
+	}
+	if in.Posting == "" {
+		in.Posting = postingEveryone
+	}
+	if !containsString(postingRules, in.Posting) {
+		return errInvalidPostingRule
+	}
+	if in.ParentID != 0 {
+		// Дерево в два уровня: родитель — существующая категория верхнего уровня, а у самой категории нет подкатегорий
+		var parentOfParent int
+		err := db.QueryRow("SELECT parent_id FROM categories WHERE id = ?", in.ParentID).Scan(&parentOfParent)
+		if err == sql.ErrNoRows || in.ParentID == categoryID || parentOfParent != 0 {
+			return errInvalidParentCategory
+		}
+		if err != nil {
+			return err
+		}
+		var hasChildren bool
+		if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM categories WHERE parent_id = ?)", categoryID).Scan(&hasChildren); err != nil {
+			return err
+		}
+		if categoryID != 0 && hasChildren {
+			return errCategoryHasChildren
+		}
+	}
+
+	var taken bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM categories WHERE name = ? AND id != ?)", in.Name, categoryID).Scan(&taken); err != nil {
+		return err
+	}
+	if taken {
+		return errCategoryNameTaken
+	}
+
+	if in.Slug == "" {
+		if categoryID != 0 {
+			return db.QueryRow("SELECT slug FROM categories WHERE id = ?", categoryID).Scan(&in.Slug)
+		}
+		slug, err := database.UniqueCategorySlug(db, database.Slugify(in.Name), 0)
+		in.Slug = slug
+		return err
+	}
+	if database.Slugify(in.Slug) != in.Slug || utf8.RuneCountInString(in.Slug) > maxCategorySlugLength {
+		return errInvalidCategorySlug
+	}
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM categories WHERE slug = ? AND id != ?)", in.Slug, categoryID).Scan(&taken); err != nil {
+		return err
+	}
+	if taken {
+		return errCategorySlugTaken
+	}
+	return nil
+}
+
+// isHexColor проверяет цвет вида #rrggbb
+func isHexColor(s string) bool {
+	if len(s) != 7 || s[0] != '#' {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !strings.ContainsRune("0123456789abcdef", rune(s[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+// isIconName проверяет имя иконки Font Awesome: строчные латинские буквы, цифры и дефисы
+func isIconName(s string) bool {
+	if len(s) > 30 {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z') && !(r >= '0' && r <= '9') && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseCategoryIDs разбирает выбранные в форме категории и проверяет их через validateCategoryIDs.
+// Пустые значения пропускаются.
+func parseCategoryIDs(db *sql.DB, values []string, postID int, role string) ([]int, error) {
+	ids := make([]int, 0, len(values))
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, errInvalidCategory
+		}
+		ids = append(ids, id)
+	}
+	return ids, validateCategoryIDs(db, ids, postID, role)
+}
+
+// validateCategoryIDs проверяет, что категории существуют, не повторяются и пользователь
+// с ролью role может добавить в них пост. Категория, в которой пост postID уже состоит,
+// допускается всегда (для нового поста postID = 0).
+func validateCategoryIDs(db *sql.DB, ids []int, postID int, role string) error {
+	seen := make(map[int]struct{}, len(ids))
+	for _, id := range ids {
+		if _, exists := seen[id]; exists {
+			return errDuplicateCategory
+		}
+		seen[id] = struct{}{}
+		cat, err := lookupCategoryByID(db, id)
+		if err == sql.ErrNoRows {
+			return errInvalidCategory
+		}
+		if err != nil {
+			return err
+		}
+		if cat.canPost(role) || database.PostInCategory(db, postID, id) {
+			continue
+		}
+		switch {
+		case cat.EffectivePosting() == postingReadOnly:
+			return validationError("Category \"" + cat.Name + "\" is read-only.")
+		case cat.EffectivePosting() == postingModerators:
+			return validationError("Only moderators can post in \"" + cat.Name + "\".")
+		}
+		return errArchivedCategory
+	}
+	return nil
+}
+
+// normalizeTag приводит тег к виду для хранения: нижний регистр, без # в начале,
+// пробелы и подчёркивания внутри заменены одним дефисом. Возвращает пустую строку для пустого тега.
+func normalizeTag(raw string) string {
+	raw = strings.TrimPrefix(strings.TrimSpace(normalizeText(raw)), "#")
+	words := strings.FieldsFunc(strings.ToLower(raw), func(r rune) bool {
+		return unicode.IsSpace(r) || r == '_' || r == '-'
+	})
+	return strings.Join(words, "-")
+}
+
+// isTagName проверяет нормализованный тег: буквы, цифры, дефис, точка и плюс, первый символ — буква или цифра
+func isTagName(tag string) bool {
+	if tag == "" || utf8.RuneCountInString(tag) > maxTagLength {
+		return false
+	}
+	for i, r := range tag {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			continue
+		}
+		if i == 0 || (r != '-' && r != '.' && r != '+') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseTags разбирает теги из поля формы, разделённые запятыми
+func parseTags(value string) ([]string, error) {
+	return validateTags(strings.Split(value, ","))
+}
+
+// validateTags нормализует теги и проверяет их; пустые и повторяющиеся после нормализации отбрасываются
+func validateTags(values []string) ([]string, error) {
+	tags := []string{}
+	for _, v := range values {
+		tag := normalizeTag(v)
+		if tag == "" || containsString(tags, tag) {
+			continue
+		}
+		if !isTagName(tag) {
+			return nil, errInvalidTag
+		}
+		tags = append(tags, tag)
+	}
+	if len(tags) > maxTagsPerPost {
+		return nil, errTooManyTags
+	}
+	return tags, nil
+}
+
+// parsePublishAt разбирает время запланированной публикации из поля формы (UTC).
+// Пустое значение означает публикацию сразу и возвращает нулевое время.
+func parsePublishAt(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation(publishAtLayout, value, time.UTC)
+	if err != nil {
+		return time.Time{}, errInvalidPublishAt
+	}
+	if !t.After(now) {
+		return time.Time{}, errPublishAtPast
+	}
+	if t.After(now.Add(maxScheduleAhead)) {
+		return time.Time{}, errPublishAtTooFar
+	}
+	return t, nil
+}
@@ -0,0 +1,658 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// События, на которые можно подписать webhook
+const (
+	hookPostCreated    = "post.created"
+	hookCommentCreated = "comment.created"
+	hookPostDeleted    = "post.deleted"
+)
+
+var webhookEvents = []string{hookPostCreated, hookCommentCreated, hookPostDeleted}
+
+// Статусы доставки
+const (
+	deliveryPending   = "pending"
+	deliveryDelivered = "delivered"
+	deliveryFailed    = "failed"
+)
+
+const (
+	webhookMaxAttempts  = 8                // После стольких неудачных попыток доставка помечается failed
+	webhookPollInterval = 5 * time.Second  // Как часто воркер проверяет очередь без новых событий
+	webhookTimeout      = 10 * time.Second // Таймаут одного запроса к получателю
+	webhookBatchSize    = 20               // Сколько доставок отправляется за один проход
+	maxWebhooks         = 50
+)
+
+// webhookBackoff возвращает паузу перед следующей попыткой: 30 с, 1 мин, 2 мин, ... но не больше часа.
+// Переменная, чтобы тесты могли убрать паузы.
+var webhookBackoff = func(attempts int) time.Duration {
+	d := 30 * time.Second << (attempts - 1)
+	if d > time.Hour || d <= 0 {
+		d = time.Hour
+	}
+	return d
+}
+
+// webhookWake будит воркер, когда в очередь добавлена доставка
+var webhookWake = make(chan struct{}, 1)
+
+// Webhook — зарегистрированный получатель событий
+type Webhook struct {
+	ID        int
+	URL       string
+	Events    []string
+	Category  string // Пусто — все категории
+	CreatedAt string
+	Pending   int
+	Failed    int
+}
+
+// WebhookDelivery — запись журнала доставок
+type WebhookDelivery struct {
+	ID           int
+	WebhookID    int
+	WebhookURL   string
+	Event        string
+	Payload      string
+	Status       string
+	Attempts     int
+	ResponseCode int // 0 — ответа не было
+	LastError    string
+	CreatedAt    string
+	NextAttempt  string // Только для pending
+	DeliveredAt  string
+}
+
+// WebhooksPageData определяет данные, передаваемые в шаблон admin_webhooks.html
+type WebhooksPageData struct {
+	CurrentUser string
+	Webhooks    []Webhook
+	Events      []string
+	Categories  []Category
+	NewSecret   string // Секрет нового webhook показывается один раз
+	Error       string
+}
+
+// WebhookDeliveriesPageData определяет данные, передаваемые в шаблон admin_webhook_deliveries.html
+type WebhookDeliveriesPageData struct {
+	CurrentUser string
+	Webhook     *Webhook // nil — доставки всех webhook
+	Status      string   // Фильтр по статусу; пусто — все
+	Deliveries  []WebhookDelivery
+}
+
+// webhookPayload — тело запроса к получателю
+type webhookPayload struct {
+	ID        int         `json:"id"` // ID доставки; одинаковый при повторах, получатель может по нему убирать дубли
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// signWebhook возвращает подпись тела: hex(HMAC-SHA256(secret, timestamp + "." + body))
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// enqueueWebhooks ставит событие в очередь для всех подходящих webhook.
+// categories — категории поста, к которому относится событие. Webhook родительской
+// категории получает и события её подкатегорий.
+func enqueueWebhooks(db *sql.DB, event string, categories []string, data interface{}) {
+	rows, err := db.Query(`
+		SELECT w.id, w.events, w.category, COALESCE((SELECT GROUP_CONCAT(sub.name, char(31)) FROM categories sub
+			JOIN categories parent ON sub.parent_id = parent.id WHERE parent.name = w.category), '')
+		FROM webhooks w`)
+	if err != nil {
+		log.Println("Error querying webhooks:", err)
+		return
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		var hookEvents, category, subcategories string
+		if err := rows.Scan(&id, &hookEvents, &category, &subcategories); err != nil {
+			log.Println("Error scanning webhook:", err)
+			continue
+		}
+		if !containsString(strings.Split(hookEvents, ","), event) {
+			continue
+		}
+		if category != "" && !containsString(categories, category) &&
+			!containsAnyString(categories, strings.Split(subcategories, "\x1f")) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if len(ids) == 0 {
+		return
+	}
+
+	now := time.Now()
+	for _, id := range ids {
+		if err := queueDelivery(db, id, event, now, data); err != nil {
+			log.Println("Error queueing webhook delivery:", err)
+		}
+	}
+	wakeWebhookWorker()
+}
+
+// queueDelivery добавляет доставку в очередь. Тело содержит ID доставки, поэтому
+// записывается после вставки в той же транзакции, чтобы воркер не увидел пустое тело.
+func queueDelivery(db *sql.DB, webhookID int, event string, now time.Time, data interface{}) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO webhook_deliveries (webhook_id, event, payload, next_attempt_at) VALUES (?, ?, '', ?)", webhookID, event, now)
+	if err != nil {
+		return err
+	}
+	deliveryID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(webhookPayload{ID: int(deliveryID), Event: event, CreatedAt: now.UTC(), Data: data})
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE webhook_deliveries SET payload = ? WHERE id = ?", string(body), deliveryID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// wakeWebhookWorker сообщает воркеру о новых доставках, не блокируясь
+func wakeWebhookWorker() {
+	select {
+	case webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// StartWebhookWorker отправляет доставки из очереди до отмены ctx.
+// Очередь хранится в БД, поэтому после перезапуска недоставленное отправляется дальше.
+func StartWebhookWorker(ctx context.Context, db *sql.DB) {
+	client := &http.Client{Timeout: webhookTimeout}
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	for {
+		for deliverDueWebhooks(ctx, db, client) == webhookBatchSize && ctx.Err() == nil {
+			// Полный проход: в очереди могут быть ещё доставки
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-webhookWake:
+		}
+	}
+}
+
+// deliverDueWebhooks отправляет доставки, время которых пришло, и возвращает их количество
+func deliverDueWebhooks(ctx context.Context, db *sql.DB, client *http.Client) int {
+	rows, err := db.Query(`
+		SELECT d.id, d.event, d.payload, d.attempts, w.url, w.secret
+		FROM webhook_deliveries d
+		JOIN webhooks w ON d.webhook_id = w.id
+		WHERE d.status = ? AND d.next_attempt_at <= ?
+		ORDER BY d.next_attempt_at, d.id
+		LIMIT ?`, deliveryPending, time.Now(), webhookBatchSize)
+	if err != nil {
+		log.Println("Error querying webhook deliveries:", err)
+		return 0
+	}
+	type due struct {
+		id              int
+		event, payload  string
+		attempts        int
+		hookURL, secret string
+	}
+	var batch []due
+	for rows.Next() {
+		var d due
+		if err := rows.Scan(&d.id, &d.event, &d.payload, &d.attempts, &d.hookURL, &d.secret); err != nil {
+			log.Println("Error scanning webhook delivery:", err)
+			continue
+		}
+		batch = append(batch, d)
+	}
+	rows.Close()
+
+	for _, d := range batch {
+		if ctx.Err() != nil {
+			break
+		}
+		code, err := sendWebhook(ctx, client, d.hookURL, d.secret, d.id, d.event, []byte(d.payload))
+		if ctx.Err() != nil {
+			break // Остановка сервера — не попытка; доставка останется в очереди
+		}
+		recordAttempt(db, d.id, d.attempts+1, code, err)
+	}
+	return len(batch)
+}
+
+// sendWebhook выполняет одну попытку доставки и возвращает код ответа
+func sendWebhook(ctx context.Context, client *http.Client, hookURL, secret string, deliveryID int, event string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hookURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Forum-Webhooks/1.0")
+	req.Header.Set("X-Forum-Event", event)
+	req.Header.Set("X-Forum-Delivery", strconv.Itoa(deliveryID))
+	req.Header.Set("X-Forum-Timestamp", timestamp)
+	req.Header.Set("X-Forum-Signature", "sha256="+signWebhook(secret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// recordAttempt сохраняет результат попытки и назначает следующую с экспоненциальной паузой
+func recordAttempt(db *sql.DB, deliveryID, attempts, code int, sendErr error) {
+	var responseCode interface{}
+	if code != 0 {
+		responseCode = code
+	}
+	var err error
+	switch {
+	case sendErr == nil:
+		_, err = db.Exec("UPDATE webhook_deliveries SET status = ?, attempts = ?, response_code = ?, last_error = '', delivered_at = ? WHERE id = ?",
+			deliveryDelivered, attempts, responseCode, time.Now(), deliveryID)
+	case attempts >= webhookMaxAttempts:
+		_, err = db.Exec("UPDATE webhook_deliveries SET status = ?, attempts = ?, response_code = ?, last_error = ? WHERE id = ?",
+			deliveryFailed, attempts, responseCode, sendErr.Error(), deliveryID)
+	default:
+		_, err = db.Exec("UPDATE webhook_deliveries SET attempts = ?, response_code = ?, last_error = ?, next_attempt_at = ? WHERE id = ?",
+			attempts, responseCode, sendErr.Error(), time.Now().Add(webhookBackoff(attempts)), deliveryID)
+	}
+	if err != nil {
+		log.Println("Error recording webhook attempt:", err)
+	}
+}
+
+// adminUser возвращает текущего пользователя, если он администратор.
+// Гостя перенаправляет на /login, остальным отвечает 403.
+func adminUser(db *sql.DB, w http.ResponseWriter, r *http.Request) (username string, ok bool) {
+	cookie, err := r.Cookie("session_id")
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return "", false
+	}
+	var role string
+	err = db.QueryRow("SELECT u.username, u.role FROM sessions s JOIN users u ON s.user_id = u.id WHERE s.id = ? AND s.expiry > ?", cookie.Value, time.Now()).Scan(&username, &role)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return "", false
+	}
+	if role != "admin" {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return "", false
+	}
+	return username, true
+}
+
+// AdminWebhooks обрабатывает страницу /admin/webhooks: список webhook и регистрация нового
+func AdminWebhooks(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		username, ok := adminUser(db, w, r)
+		if !ok {
+			return
+		}
+
+		categories, err := queryCategories(db)
+		if err != nil {
+			log.Println("Error fetching categories:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		data := WebhooksPageData{CurrentUser: username, Events: webhookEvents, Categories: categories}
+		status := http.StatusOK
+
+		// Обработка POST-запроса: регистрация webhook
+		if r.Method == http.MethodPost {
+			secret, errMsg := createWebhook(db, r, categories)
+			if errMsg != "" {
+				data.Error = errMsg
+				status = http.StatusBadRequest
+			} else if secret == "" {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			data.NewSecret = secret
+		}
+
+		data.Webhooks, err = queryWebhooks(db)
+		if err != nil {
+			log.Println("Error fetching webhooks:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		tmpl, err := template.ParseFiles("templates/admin_webhooks.html")
+		if err != nil {
+			log.Println("Error parsing admin_webhooks.html template:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		tmpl.Execute(w, data)
+	}
+}
+
+// createWebhook проверяет форму и регистрирует webhook. Возвращает секрет или сообщение об ошибке;
+// пустые оба значения означают внутреннюю ошибку.
+func createWebhook(db *sql.DB, r *http.Request, categories []Category) (string, string) {
+	hookURL := strings.TrimSpace(r.FormValue("url"))
+	u, err := url.Parse(hookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(hookURL) > 2000 {
+		return "", "Enter a valid http:// or https:// URL."
+	}
+
+	var selected []string
+	for _, e := range r.Form["events"] {
+		if !containsString(webhookEvents, e) {
+			return "", "Invalid event selected."
+		}
+		if !containsString(selected, e) {
+			selected = append(selected, e)
+		}
+	}
+	if len(selected) == 0 {
+		return "", "Select at least one event."
+	}
+
+	category := r.FormValue("category")
+	if category != "" {
+		found := false
+		for _, c := range categories {
+			if c.Name == category {
+				found = true
+			}
+		}
+		if !found {
+			return "", "Invalid category selected."
+		}
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM webhooks").Scan(&count); err != nil {
+		log.Println("Error counting webhooks:", err)
+		return "", ""
+	}
+	if count >= maxWebhooks {
+		return "", "Too many webhooks. Delete unused webhooks first."
+	}
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		log.Println("Error generating webhook secret:", err)
+		return "", ""
+	}
+	secret := "whsec_" + hex.EncodeToString(buf)
+	_, err = db.Exec("INSERT INTO webhooks (url, secret, events, category) VALUES (?, ?, ?, ?)",
+		hookURL, secret, strings.Join(selected, ","), category)
+	if err != nil {
+		log.Println("Error inserting webhook:", err)
+		return "", ""
+	}
+	return secret, ""
+}
+
+// queryWebhooks возвращает webhook со счётчиками ожидающих и неудачных доставок
+func queryWebhooks(db *sql.DB) ([]Webhook, error) {
+	rows, err := db.Query(`
+		SELECT w.id, w.url, w.events, w.category, w.created_at,
+			(SELECT COUNT(*) FROM webhook_deliveries d WHERE d.webhook_id = w.id AND d.status = ?),
+			(SELECT COUNT(*) FROM webhook_deliveries d WHERE d.webhook_id = w.id AND d.status = ?)
+		FROM webhooks w
+		ORDER BY w.id`, deliveryPending, deliveryFailed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hooks []Webhook
+	for rows.Next() {
+		var h Webhook
+		var hookEvents string
+		var createdAt time.Time
+		if err := rows.Scan(&h.ID, &h.URL, &hookEvents, &h.Category, &createdAt, &h.Pending, &h.Failed); err != nil {
+			return nil, err
+		}
+		h.Events = strings.Split(hookEvents, ",")
+		h.CreatedAt = formatDate(createdAt)
+		hooks = append(hooks, h)
+	}
+	return hooks, rows.Err()
+}
+
+// DeleteWebhook удаляет webhook вместе с его журналом доставок
+func DeleteWebhook(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if _, ok := adminUser(db, w, r); !ok {
+			return
+		}
+		webhookID, err := strconv.Atoi(r.FormValue("webhook_id"))
+		if err != nil {
+			http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+			return
+		}
+
+		res, err := db.Exec("DELETE FROM webhooks WHERE id = ?", webhookID)
+		if err != nil {
+			log.Println("Error deleting webhook:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if count, _ := res.RowsAffected(); count == 0 {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+			return
+		}
+		if _, err := db.Exec("DELETE FROM webhook_deliveries WHERE webhook_id = ?", webhookID); err != nil {
+			log.Println("Error deleting webhook deliveries:", err)
+		}
+		http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+	}
+}
+
+// WebhookDeliveries показывает журнал доставок: /admin/webhooks/deliveries?webhook=ID&status=failed
+func WebhookDeliveries(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		username, ok := adminUser(db, w, r)
+		if !ok {
+			return
+		}
+		data := WebhookDeliveriesPageData{CurrentUser: username}
+
+		where := []string{"1 = 1"}
+		var args []interface{}
+		if v := r.URL.Query().Get("webhook"); v != "" {
+			id, err := strconv.Atoi(v)
+			if err != nil {
+				http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+				return
+			}
+			hooks, err := queryWebhooks(db)
+			if err != nil {
+				log.Println("Error fetching webhooks:", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			for i := range hooks {
+				if hooks[i].ID == id {
+					data.Webhook = &hooks[i]
+				}
+			}
+			if data.Webhook == nil {
+				http.Error(w, "Webhook not found", http.StatusNotFound)
+				return
+			}
+			where = append(where, "d.webhook_id = ?")
+			args = append(args, id)
+		}
+		switch status := r.URL.Query().Get("status"); status {
+		case "":
+		case deliveryPending, deliveryDelivered, deliveryFailed:
+			data.Status = status
+			where = append(where, "d.status = ?")
+			args = append(args, status)
+		default:
+			http.Error(w, "Invalid status", http.StatusBadRequest)
+			return
+		}
+
+		var err error
+		data.Deliveries, err = queryDeliveries(db, strings.Join(where, " AND "), args)
+		if err != nil {
+			log.Println("Error fetching webhook deliveries:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		tmpl, err := template.ParseFiles("templates/admin_webhook_deliveries.html")
+		if err != nil {
+			log.Println("Error parsing admin_webhook_deliveries.html template:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		tmpl.Execute(w, data)
+	}
+}
+
+// queryDeliveries возвращает последние 200 доставок, новые сначала
+func queryDeliveries(db *sql.DB, where string, args []interface{}) ([]WebhookDelivery, error) {
+	rows, err := db.Query(`
+		SELECT d.id, d.webhook_id, w.url, d.event, d.payload, d.status, d.attempts,
+			d.response_code, d.last_error, d.created_at, d.next_attempt_at, d.delivered_at
+		FROM webhook_deliveries d
+		JOIN webhooks w ON d.webhook_id = w.id
+		WHERE `+where+`
+		ORDER BY d.id DESC
+		LIMIT 200`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		var code sql.NullInt64
+		var createdAt, nextAttempt time.Time
+		var deliveredAt sql.NullTime
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.WebhookURL, &d.Event, &d.Payload, &d.Status, &d.Attempts,
+			&code, &d.LastError, &createdAt, &nextAttempt, &deliveredAt); err != nil {
+			return nil, err
+		}
+		d.ResponseCode = int(code.Int64)
+		d.CreatedAt = formatDate(createdAt)
+		if d.Status == deliveryPending {
+			d.NextAttempt = formatDate(nextAttempt)
+		}
+		if deliveredAt.Valid {
+			d.DeliveredAt = formatDate(deliveredAt.Time)
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// replayDelivery возвращает неудачную доставку в очередь с новым счётчиком попыток.
+// Тело не меняется, поэтому получатель видит тот же ID доставки.
+func replayDelivery(db *sql.DB, deliveryID int) (bool, error) {
+	res, err := db.Exec("UPDATE webhook_deliveries SET status = ?, attempts = 0, next_attempt_at = ? WHERE id = ? AND status = ?",
+		deliveryPending, time.Now(), deliveryID, deliveryFailed)
+	if err != nil {
+		return false, err
+	}
+	count, _ := res.RowsAffected()
+	if count > 0 {
+		wakeWebhookWorker()
+	}
+	return count > 0, nil
+}
+
+// ReplayWebhookDelivery повторяет неудачную доставку
+func ReplayWebhookDelivery(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if _, ok := adminUser(db, w, r); !ok {
+			return
+		}
+		deliveryID, err := strconv.Atoi(r.FormValue("delivery_id"))
+		if err != nil {
+			http.Error(w, "Invalid delivery ID", http.StatusBadRequest)
+			return
+		}
+
+		ok, err := replayDelivery(db, deliveryID)
+		if err != nil {
+			log.Println("Error replaying webhook delivery:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "Failed delivery not found", http.StatusNotFound)
+			return
+		}
+
+		// Возврат на ту же страницу журнала, если она передана
+		next := r.FormValue("next")
+		if !strings.HasPrefix(next, "/admin/webhooks/deliveries") {
+			next = "/admin/webhooks/deliveries"
+		}
+		http.Redirect(w, r, next, http.StatusSeeOther)
+	}
+}
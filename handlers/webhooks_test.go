@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// hookReceiver — локальный получатель webhook: запоминает запросы
+// и отвечает ошибкой первые failures раз
+type hookReceiver struct {
+	mu       sync.Mutex
+	failures int
+	requests []hookRequest
+	server   *httptest.Server
+}
+
+// hookRequest — принятый получателем запрос
+type hookRequest struct {
+	Header http.Header
+	Body   []byte
+	Status int
+}
+
+// newHookReceiver запускает получателя; -1 — отвечать ошибкой всегда
+func newHookReceiver(t *testing.T, failures int) *hookReceiver {
+	h := &hookReceiver{failures: failures}
+	h.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		status := http.StatusNoContent
+		if h.failures != 0 {
+			if h.failures > 0 {
+				h.failures--
+			}
+			status = http.StatusServiceUnavailable
+		}
+		h.requests = append(h.requests, hookRequest{Header: r.Header.Clone(), Body: body, Status: status})
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(h.server.Close)
+	return h
+}
+
+// setFailures меняет число ответов с ошибкой; -1 — отвечать ошибкой всегда
+func (h *hookReceiver) setFailures(n int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.failures = n
+}
+
+// accepted возвращает успешно принятые запросы
+func (h *hookReceiver) accepted() []hookRequest {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var list []hookRequest
+	for _, r := range h.requests {
+		if r.Status < 300 {
+			list = append(list, r)
+		}
+	}
+	return list
+}
+
+// webhookEnv — пустая база с администратором, обычным пользователем и страницами управления webhook
+type webhookEnv struct {
+	db            *sql.DB
+	mux           *http.ServeMux
+	adminID       int
+	adminSession  string
+	memberSession string
+}
+
+// newWebhookEnv готовит окружение теста. Паузы между попытками убираются:
+// каждый проход воркера — следующая попытка.
+func newWebhookEnv(t *testing.T) *webhookEnv {
+	t.Chdir("..") // Страницы администрирования читают шаблоны из templates/
+
+	savedBackoff := webhookBackoff
+	webhookBackoff = func(int) time.Duration { return 0 }
+	t.Cleanup(func() { webhookBackoff = savedBackoff })
+
+	env := &webhookEnv{db: openTestDB(t), mux: http.NewServeMux()}
+	env.adminID, env.adminSession = testUser(t, env.db, "hookadmin", "admin")
+	_, env.memberSession = testUser(t, env.db, "hookmember", "user")
+	env.mux.HandleFunc("/admin/webhooks", AdminWebhooks(env.db))
+	env.mux.HandleFunc("/admin/webhooks/deliveries", WebhookDeliveries(env.db))
+	env.mux.HandleFunc("/admin/webhooks/deliveries/replay", ReplayWebhookDelivery(env.db))
+	return env
+}
+
+// do отправляет форму от имени пользователя с сессией session (пусто — гость) и возвращает код ответа
+func (env *webhookEnv) do(method, target, session string, form url.Values) int {
+	req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if session != "" {
+		req.AddCookie(&http.Cookie{Name: "session_id", Value: session})
+	}
+	rec := httptest.NewRecorder()
+	env.mux.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+// register регистрирует webhook от имени администратора
+func (env *webhookEnv) register(t *testing.T, hookURL, category string, events ...string) {
+	t.Helper()
+	if code := env.do("POST", "/admin/webhooks", env.adminSession, hookForm(hookURL, category, events...)); code != http.StatusOK {
+		t.Fatalf("registering webhook %s: got %d, want 200", hookURL, code)
+	}
+}
+
+// secret возвращает секрет подписи webhook по его адресу
+func (env *webhookEnv) secret(hookURL string) string {
+	var s string
+	env.db.QueryRow("SELECT secret FROM webhooks WHERE url = ?", hookURL).Scan(&s)
+	return s
+}
+
+// drain прогоняет воркер столько раз, чтобы каждая доставка исчерпала попытки
+func (env *webhookEnv) drain() {
+	for i := 0; i < webhookMaxAttempts+2; i++ {
+		deliverDueWebhooks(context.Background(), env.db, http.DefaultClient)
+	}
+}
+
+// hookForm — форма регистрации webhook
+func hookForm(hookURL, category string, events ...string) url.Values {
+	return url.Values{"url": {hookURL}, "category": {category}, "events": events}
+}
+
+func TestWebhookRegistration(t *testing.T) {
+	env := newWebhookEnv(t)
+	receiver := newHookReceiver(t, 0)
+
+	tests := []struct {
+		name    string
+		session string
+		form    url.Values
+		want    int
+	}{
+		{"guest", "", hookForm(receiver.server.URL, "", hookPostCreated), http.StatusSeeOther},
+		{"non-admin", env.memberSession, hookForm(receiver.server.URL, "", hookPostCreated), http.StatusForbidden},
+		{"invalid URL", env.adminSession, hookForm("ftp://example.com", "", hookPostCreated), http.StatusBadRequest},
+		{"unknown event", env.adminSession, hookForm(receiver.server.URL, "", "post.updated"), http.StatusBadRequest},
+		{"valid", env.adminSession, hookForm(receiver.server.URL, "Announcements", hookPostCreated), http.StatusOK},
+	}
+	for _, tt := range tests {
+		if code := env.do("POST", "/admin/webhooks", tt.session, tt.form); code != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, code, tt.want)
+		}
+	}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	env := newWebhookEnv(t)
+	announcements := newHookReceiver(t, 0) // Принимает сразу
+	flaky := newHookReceiver(t, 4)         // Две доставки по две ошибки, затем успех
+	env.register(t, announcements.server.URL, "Announcements", hookPostCreated)
+	env.register(t, flaky.server.URL, "", hookCommentCreated, hookPostDeleted)
+
+	// События: пост в Announcements, пост в General, комментарий и удаление поста
+	announcementID := testPost(t, env.db, env.adminID, "Release", "Announcements")
+	generalID := testPost(t, env.db, env.adminID, "Chat", "General")
+	commentID, err := insertComment(env.db, announcementID, env.adminID, "Great news")
+	if err != nil {
+		t.Fatal(err)
+	}
+	publishCommentCreated(env.db, commentID)
+	categories := postCategoryNames(env.db, generalID)
+	if err := deletePost(env.db, generalID); err != nil {
+		t.Fatal(err)
+	}
+	publishPostDeleted(env.db, generalID, categories)
+	env.drain()
+
+	// Фильтр категории: только пост из Announcements
+	got := announcements.accepted()
+	if len(got) != 1 {
+		t.Fatalf("announcements webhook: got %d deliveries, want 1", len(got))
+	}
+	checkHookRequest(t, got[0], env.secret(announcements.server.URL), hookPostCreated)
+	var p struct {
+		Data struct {
+			PostID     int      `json:"post_id"`
+			Categories []string `json:"categories"`
+		} `json:"data"`
+	}
+	json.Unmarshal(got[0].Body, &p)
+	if p.Data.PostID != announcementID || !containsString(p.Data.Categories, "Announcements") {
+		t.Errorf("announcements webhook: unexpected payload %s", got[0].Body)
+	}
+
+	// Повторы: две ошибки, затем успех на третьей попытке
+	got = flaky.accepted()
+	if len(got) != 2 {
+		t.Errorf("flaky webhook: got %d accepted deliveries, want 2 (comment.created, post.deleted)", len(got))
+	}
+	for _, r := range got {
+		checkHookRequest(t, r, env.secret(flaky.server.URL), r.Header.Get("X-Forum-Event"))
+	}
+	rows, err := env.db.Query(`
+		SELECT d.event, d.status, d.attempts FROM webhook_deliveries d
+		JOIN webhooks w ON d.webhook_id = w.id WHERE w.url = ?`, flaky.server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var event, status string
+		var attempts int
+		if err := rows.Scan(&event, &status, &attempts); err != nil {
+			t.Fatal(err)
+		}
+		if status != deliveryDelivered || attempts != 3 {
+			t.Errorf("flaky webhook %s: status %s after %d attempts, want delivered after 3", event, status, attempts)
+		}
+	}
+}
+
+func TestWebhookReplay(t *testing.T) {
+	env := newWebhookEnv(t)
+	down := newHookReceiver(t, -1) // Всегда ошибка
+	env.register(t, down.server.URL, "", hookPostCreated)
+	testPost(t, env.db, env.adminID, "Release", "General")
+	env.drain()
+
+	// Недоступный получатель: доставка failed после всех попыток
+	var deliveryID, attempts int
+	var status, payload string
+	err := env.db.QueryRow(`
+		SELECT d.id, d.status, d.attempts, d.payload FROM webhook_deliveries d
+		JOIN webhooks w ON d.webhook_id = w.id WHERE w.url = ?`, down.server.URL,
+	).Scan(&deliveryID, &status, &attempts, &payload)
+	if err != nil {
+		t.Fatalf("no delivery queued: %v", err)
+	}
+	if status != deliveryFailed || attempts != webhookMaxAttempts {
+		t.Fatalf("status %s after %d attempts, want failed after %d", status, attempts, webhookMaxAttempts)
+	}
+
+	// Журнал доступен только администратору
+	if code := env.do("GET", "/admin/webhooks/deliveries?status=failed", env.adminSession, nil); code != http.StatusOK {
+		t.Errorf("delivery log: got %d, want 200", code)
+	}
+	if code := env.do("GET", "/admin/webhooks/deliveries", env.memberSession, nil); code != http.StatusForbidden {
+		t.Errorf("delivery log for non-admin: got %d, want 403", code)
+	}
+
+	// Повторная отправка из журнала: то же тело, доставка проходит
+	down.setFailures(0)
+	replay := url.Values{"delivery_id": {strconv.Itoa(deliveryID)}}
+	if code := env.do("POST", "/admin/webhooks/deliveries/replay", env.adminSession, replay); code != http.StatusSeeOther {
+		t.Fatalf("replaying failed delivery: got %d, want 303", code)
+	}
+	env.drain()
+	env.db.QueryRow("SELECT status FROM webhook_deliveries WHERE id = ?", deliveryID).Scan(&status)
+	if status != deliveryDelivered {
+		t.Errorf("replayed delivery: status %s, want delivered", status)
+	}
+	if got := down.accepted(); len(got) != 1 || string(got[0].Body) != payload {
+		t.Errorf("replayed delivery: receiver did not get the original payload")
+	} else {
+		checkHookRequest(t, got[0], env.secret(down.server.URL), hookPostCreated)
+	}
+	if code := env.do("POST", "/admin/webhooks/deliveries/replay", env.adminSession, replay); code != http.StatusNotFound {
+		t.Errorf("replaying delivered delivery: got %d, want 404", code)
+	}
+}
+
+// checkHookRequest проверяет заголовки и подпись запроса к получателю
+func checkHookRequest(t *testing.T, r hookRequest, secret, event string) {
+	t.Helper()
+	if r.Header.Get("X-Forum-Event") != event {
+		t.Errorf("X-Forum-Event %q, want %q", r.Header.Get("X-Forum-Event"), event)
+	}
+	want := "sha256=" + signWebhook(secret, r.Header.Get("X-Forum-Timestamp"), r.Body)
+	if r.Header.Get("X-Forum-Signature") != want {
+		t.Errorf("invalid signature for %s", r.Body)
+	}
+	var p webhookPayload
+	if err := json.Unmarshal(r.Body, &p); err != nil || p.Event != event || strconv.Itoa(p.ID) != r.Header.Get("X-Forum-Delivery") {
+		t.Errorf("payload does not match headers: %s", r.Body)
+	}
+}
+
+// testUser создаёт пользователя с ролью и сессией
+func testUser(t *testing.T, db *sql.DB, username, role string) (int, string) {
+	t.Helper()
+	res, err := db.Exec("INSERT INTO users (email, username, password, role) VALUES (?, ?, '', ?)", username+"@example.com", username, role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := res.LastInsertId()
+	session := "test-" + username
+	if _, err := db.Exec("INSERT INTO sessions (id, user_id, expiry) VALUES (?, ?, ?)", session, id, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	return int(id), session
+}
+
+// testPost публикует пост в категории с именем category и рассылает post.created
+func testPost(t *testing.T, db *sql.DB, userID int, title, category string) int {
+	t.Helper()
+	var categoryID int
+	if err := db.QueryRow("SELECT id FROM categories WHERE name = ?", category).Scan(&categoryID); err != nil {
+		t.Fatalf("category %s: %v", category, err)
+	}
+	postID, err := insertPost(db, userID, title, "Text", "", []int{categoryID}, nil, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	publishPostCreated(db, postID)
+	return postID
+}
@@ -0,0 +1,177 @@
+// Пакет mailer отправляет письма через SMTP или складывает их в каталог (.eml) для локальной разработки.
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Message — письмо с текстовой и HTML-версией
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	Headers map[string]string // Дополнительные заголовки, например List-Unsubscribe
+}
+
+// Mailer отправляет письма
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// SMTP отправляет письма через SMTP-сервер. Если Username пуст, авторизация не используется.
+type SMTP struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	From     string
+}
+
+// Send отправляет письмо
+func (s SMTP) Send(msg Message) error {
+	data, err := build(s.From, msg)
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, _ := net.SplitHostPort(s.Addr)
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	return smtp.SendMail(s.Addr, auth, addressOf(s.From), []string{msg.To}, data)
+}
+
+// FileDrop сохраняет каждое письмо в отдельный .eml-файл в каталоге Dir
+type FileDrop struct {
+	Dir  string
+	From string
+}
+
+// Send записывает письмо в файл
+func (f FileDrop) Send(msg Message) error {
+	data, err := build(f.From, msg)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(f.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405"), randomHex(4))
+	return os.WriteFile(filepath.Join(f.Dir, name), data, 0o644)
+}
+
+// FromEnv выбирает отправку по переменным окружения: FORUM_SMTP_ADDR (и FORUM_SMTP_USER,
+// FORUM_SMTP_PASSWORD) включает SMTP, иначе письма складываются в FORUM_MAIL_DIR (по умолчанию mail/).
+// Адрес отправителя — FORUM_MAIL_FROM.
+func FromEnv() Mailer {
+	from := os.Getenv("FORUM_MAIL_FROM")
+	if from == "" {
+		from = "Forum <forum@localhost>"
+	}
+	if addr := os.Getenv("FORUM_SMTP_ADDR"); addr != "" {
+		return SMTP{Addr: addr, Username: os.Getenv("FORUM_SMTP_USER"), Password: os.Getenv("FORUM_SMTP_PASSWORD"), From: from}
+	}
+	dir := os.Getenv("FORUM_MAIL_DIR")
+	if dir == "" {
+		dir = "mail"
+	}
+	return FileDrop{Dir: dir, From: from}
+}
+
+// build собирает письмо multipart/alternative: сначала текст, затем HTML
+func build(from string, msg Message) ([]byte, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", msg.Text},
+		{"text/html; charset=UTF-8", msg.HTML},
+	} {
+		if part.content == "" {
+			continue
+		}
+		pw, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(pw)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	headers := map[string]string{
+		"From":         from,
+		"To":           msg.To,
+		"Subject":      mime.QEncoding.Encode("UTF-8", msg.Subject),
+		"Date":         time.Now().Format(time.RFC1123Z),
+		"Message-ID":   fmt.Sprintf("<%s@%s>", randomHex(16), domainOf(from)),
+		"MIME-Version": "1.0",
+		"Content-Type": "multipart/alternative; boundary=" + w.Boundary(),
+	}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var out bytes.Buffer
+	for _, k := range keys {
+		// Перевод строки в значении позволил бы подставить свои заголовки
+		if strings.ContainsAny(headers[k], "\r\n") {
+			return nil, fmt.Errorf("mailer: invalid %s header", k)
+		}
+		fmt.Fprintf(&out, "%s: %s\r\n", k, headers[k])
+	}
+	out.WriteString("\r\n")
+	out.Write(body.Bytes())
+	return out.Bytes(), nil
+}
+
+// addressOf возвращает адрес из "Name <addr>"
+func addressOf(from string) string {
+	if i := strings.LastIndex(from, "<"); i >= 0 {
+		return strings.TrimSuffix(from[i+1:], ">")
+	}
+	return from
+}
+
+// domainOf возвращает домен адреса отправителя для Message-ID
+func domainOf(from string) string {
+	addr := addressOf(from)
+	if i := strings.LastIndex(addr, "@"); i >= 0 {
+		return addr[i+1:]
+	}
+	return "localhost"
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
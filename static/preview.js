@@ -0,0 +1,33 @@
+// Живой предпросмотр Markdown в формах создания и редактирования поста.
+// HTML рендерит сервер тем же кодом, что и при показе поста.
+document.addEventListener('DOMContentLoaded', function() {
+    document.querySelectorAll('[data-preview-for]').forEach(function(preview) {
+        var input = document.getElementById(preview.dataset.previewFor);
+        if (!input) return;
+
+        var timer = null;
+        var update = function() {
+            var body = new URLSearchParams();
+            body.set('content', input.value);
+            fetch('/preview', {method: 'POST', body: body, credentials: 'same-origin'})
+                .then(function(res) {
+                    if (!res.ok) return res.text().then(function(text) { throw new Error(text); });
+                    return res.text();
+                })
+                .then(function(html) {
+                    preview.innerHTML = html;
+                    addCopyButtons(preview);
+                })
+                .catch(function(err) {
+                    preview.textContent = err.message;
+                });
+        };
+
+        // Запрос отправляется после паузы в наборе, а не на каждую клавишу
+        input.addEventListener('input', function() {
+            clearTimeout(timer);
+            timer = setTimeout(update, 300);
+        });
+        update();
+    });
+});
@@ -1,8 +1,316 @@
-// Этот файл JavaScript пока пуст, но его можно использовать для добавления
-// интерактивности на стороне клиента
+// Клиентская интерактивность страниц форума
 document.addEventListener('DOMContentLoaded', function() {
     // Найти все секции с комментариями
     document.querySelectorAll('.space-y-3').forEach(function(commentSection) {
         commentSection.scrollTop = commentSection.scrollHeight;
     });
-});
\ No newline at end of file
+
+    addCopyButtons(document);
+
+    if (document.body.dataset.live === 'posts') {
+        startLiveUpdates();
+    }
+
+    var draftForm = document.querySelector('form[data-autosave]');
+    if (draftForm) {
+        startAutosave(draftForm);
+    }
+});
+
+// Интервал автосохранения черновика, мс
+var autosaveInterval = 5000;
+
+// startAutosave сохраняет форму создания поста в черновик через /drafts/save, если она изменилась.
+// Изображение отправляется только после его выбора, а не при каждом сохранении.
+function startAutosave(form) {
+    var status = form.querySelector('[data-autosave-status]');
+    var dirty = false;
+    var imageChanged = false;
+    var saving = false;
+
+    form.addEventListener('input', function() {
+        dirty = true;
+    });
+    form.addEventListener('change', function(e) {
+        dirty = true;
+        if (e.target.name === 'image') imageChanged = true;
+    });
+
+    var timer = setInterval(function() {
+        if (!dirty || saving) return;
+        var data = new FormData(form);
+        if (!imageChanged) data.delete('image');
+        dirty = false;
+        imageChanged = false;
+        saving = true;
+        fetch('/drafts/save', {method: 'POST', body: data, credentials: 'same-origin'})
+            .then(function(res) {
+                return res.json().then(function(body) {
+                    if (!res.ok) throw new Error(body.error.message);
+                    return body;
+                });
+            })
+            .then(function(body) {
+                if (!body.id) return;
+                form.draft_id.value = body.id;
+                if (status) status.textContent = 'Draft saved at ' + new Date(body.saved_at).toLocaleTimeString() + '.';
+            })
+            // Повторная попытка — при следующем изменении формы
+            .catch(function(err) {
+                if (status) status.textContent = 'Draft not saved: ' + err.message;
+            })
+            .finally(function() {
+                saving = false;
+            });
+    }, autosaveInterval);
+
+    // При публикации форма уходит целиком, автосохранение больше не нужно
+    form.addEventListener('submit', function() {
+        clearInterval(timer);
+    });
+}
+
+// startLiveUpdates подписывается на /events и обновляет страницу постов без перезагрузки.
+// EventSource сам переподключается и передаёт Last-Event-ID, поэтому пропущенные события дочитываются.
+function startLiveUpdates() {
+    document.querySelectorAll('[data-comment-form] input[name="content"]').forEach(function(input) {
+        input.addEventListener('focus', function() {
+            openPostChannel(input.form.post_id.value);
+        });
+        input.addEventListener('input', function() {
+            sendTyping(input.form.post_id.value);
+        });
+    });
+
+    if (!window.EventSource) return;
+
+    var url = '/events';
+    var category = document.body.dataset.category;
+    if (category) {
+        url += '?category=' + encodeURIComponent(category);
+    }
+    var source = new EventSource(url);
+    Object.keys(liveHandlers).forEach(function(type) {
+        source.addEventListener(type, function(e) {
+            liveHandlers[type](JSON.parse(e.data));
+        });
+    });
+}
+
+var newPosts = 0;
+
+// showBanner показывает плашку над списком постов
+function showBanner(text) {
+    var banner = document.getElementById('live-banner');
+    if (!banner) return;
+    document.getElementById('live-banner-text').textContent = text;
+    banner.classList.remove('hidden');
+}
+
+// setMarkdown заменяет содержимое элемента отрисованным Markdown.
+// content_html формирует сервер из белого списка тегов, исходный текст в нём экранирован.
+function setMarkdown(el, html) {
+    el.innerHTML = html;
+    addCopyButtons(el);
+}
+
+// addCopyButtons добавляет кнопку копирования к блокам кода Markdown внутри root
+function addCopyButtons(root) {
+    root.querySelectorAll('.markdown pre').forEach(function(pre) {
+        if (pre.querySelector('.code-copy')) return;
+        var button = document.createElement('button');
+        button.type = 'button';
+        button.className = 'btn btn-xs code-copy';
+        button.textContent = 'Copy';
+        button.addEventListener('click', function() {
+            var code = pre.querySelector('code');
+            navigator.clipboard.writeText(code ? code.textContent : pre.textContent).then(function() {
+                button.textContent = 'Copied';
+                setTimeout(function() { button.textContent = 'Copy'; }, 1500);
+            });
+        });
+        pre.appendChild(button);
+    });
+}
+
+// liveHandlers — обработчики событий; общие для /events и WebSocket-канала поста,
+// поэтому повторно пришедшее событие ничего не ломает
+var liveHandlers = {
+    post_created: function(data) {
+        if (document.getElementById('post-' + data.post_id)) return;
+        newPosts++;
+        showBanner(newPosts === 1
+            ? 'New post by ' + data.author + ': "' + data.title + '"'
+            : newPosts + ' new posts are available.');
+    },
+
+    post_updated: function(data) {
+        var post = document.getElementById('post-' + data.post_id);
+        if (!post) return;
+        var title = post.querySelector('[data-post-title]');
+        var content = post.querySelector('[data-post-content]');
+        if (title) title.textContent = data.title;
+        if (content) setMarkdown(content, data.content_html);
+    },
+
+    post_deleted: function(data) {
+        var post = document.getElementById('post-' + data.post_id);
+        if (post) post.remove();
+    },
+
+    comment_created: function(data) {
+        var post = document.getElementById('post-' + data.post_id);
+        if (!post || document.getElementById('comment-' + data.comment_id)) return;
+        var list = post.querySelector('[data-comments]');
+        if (!list) return;
+        list.appendChild(renderComment(data));
+        list.scrollTop = list.scrollHeight;
+        var empty = post.querySelector('[data-no-comments]');
+        if (empty) empty.remove();
+        updateCommentCount(post, 1);
+        hideTyping(data.post_id, data.author);
+    },
+
+    comment_updated: function(data) {
+        var comment = document.getElementById('comment-' + data.comment_id);
+        var content = comment && comment.querySelector('[data-comment-content]');
+        if (content) setMarkdown(content, data.content_html);
+    },
+
+    comment_deleted: function(data) {
+        var comment = document.getElementById('comment-' + data.comment_id);
+        if (!comment) return;
+        var post = comment.closest('[id^="post-"]');
+        comment.remove();
+        if (post) updateCommentCount(post, -1);
+    },
+
+    vote: function(data) {
+        var target, prefix;
+        if (data.comment_id) {
+            target = document.getElementById('comment-' + data.comment_id);
+            prefix = 'comment';
+        } else {
+            target = document.getElementById('post-' + data.post_id);
+            prefix = 'post';
+        }
+        if (!target) return;
+        var likes = target.querySelector('[data-' + prefix + '-likes]');
+        var dislikes = target.querySelector('[data-' + prefix + '-dislikes]');
+        if (likes) likes.textContent = data.likes;
+        if (dislikes) dislikes.textContent = data.dislikes;
+    },
+
+    notification: function(data) {
+        var badge = document.getElementById('notification-count');
+        if (!badge) return;
+        badge.textContent = data.unread;
+        badge.classList.toggle('hidden', data.unread === 0);
+    },
+
+    message: function(data) {
+        var badge = document.getElementById('message-count');
+        if (!badge) return;
+        badge.textContent = data.unread;
+        badge.classList.toggle('hidden', data.unread === 0);
+    },
+
+    typing: function(data) {
+        showTyping(data.post_id, data.user);
+    },
+
+    // Сервер не может восстановить пропущенные события — предлагаем обновить страницу
+    resync: function() {
+        showBanner('The page is out of date.');
+    }
+};
+
+// Открытые WebSocket-каналы постов: пост -> соединение
+var postChannels = {};
+var typingSentAt = {};
+var typingTimers = {};
+
+// openPostChannel открывает канал /post/{id}/live, когда пользователь начинает писать комментарий.
+// После остановки сервера (1001) или обрыва канал переоткрывается; при нарушении лимита (1008) — нет.
+function openPostChannel(postID) {
+    if (!window.WebSocket || postChannels[postID]) return;
+    var scheme = location.protocol === 'https:' ? 'wss://' : 'ws://';
+    var ws = new WebSocket(scheme + location.host + '/post/' + postID + '/live');
+    postChannels[postID] = ws;
+    ws.onmessage = function(e) {
+        var msg = JSON.parse(e.data);
+        if (liveHandlers[msg.type]) liveHandlers[msg.type](msg.data);
+    };
+    ws.onclose = function(e) {
+        delete postChannels[postID];
+        if (e.code !== 1008) {
+            setTimeout(function() { openPostChannel(postID); }, 3000);
+        }
+    };
+}
+
+// sendTyping сообщает остальным зрителям, что пользователь печатает; не чаще раза в 3 секунды
+function sendTyping(postID) {
+    var ws = postChannels[postID];
+    var now = Date.now();
+    if (!ws || ws.readyState !== WebSocket.OPEN || now - (typingSentAt[postID] || 0) < 3000) return;
+    typingSentAt[postID] = now;
+    ws.send(JSON.stringify({type: 'typing'}));
+}
+
+// showTyping показывает «X is typing…» под комментариями поста на несколько секунд
+function showTyping(postID, user) {
+    var post = document.getElementById('post-' + postID);
+    var el = post && post.querySelector('[data-typing]');
+    if (!el) return;
+    el.textContent = user + ' is typing…';
+    el.dataset.user = user;
+    el.classList.remove('hidden');
+    clearTimeout(typingTimers[postID]);
+    typingTimers[postID] = setTimeout(function() { el.classList.add('hidden'); }, 5000);
+}
+
+// hideTyping убирает индикатор, если автор только что отправил комментарий
+function hideTyping(postID, user) {
+    var post = document.getElementById('post-' + postID);
+    var el = post && post.querySelector('[data-typing]');
+    if (el && el.dataset.user === user) el.classList.add('hidden');
+}
+
+// renderComment строит разметку нового комментария; текст — очищенный сервером Markdown
+function renderComment(data) {
+    var wrapper = document.createElement('div');
+    wrapper.id = 'comment-' + data.comment_id;
+    wrapper.className = 'bg-gradient-to-r from-gray-50 to-blue-50/30 rounded-lg p-4 border border-gray-100';
+
+    var header = document.createElement('div');
+    header.className = 'flex items-center space-x-2 mb-2';
+    var icon = document.createElement('img');
+    icon.src = '/avatar/' + encodeURIComponent(data.author) + '?s=32';
+    icon.alt = '';
+    icon.className = 'w-6 h-6 rounded-full';
+    var author = document.createElement('a');
+    author.className = 'font-medium text-gray-800 hover:text-blue-600';
+    author.href = '/user/' + encodeURIComponent(data.author);
+    author.textContent = data.author;
+    var date = document.createElement('span');
+    date.className = 'text-sm text-gray-500';
+    date.textContent = data.created_at;
+    header.append(icon, author, date);
+
+    var content = document.createElement('div');
+    content.className = 'markdown text-gray-700';
+    content.dataset.commentContent = '';
+    setMarkdown(content, data.content_html);
+
+    wrapper.append(header, content);
+    return wrapper;
+}
+
+// updateCommentCount изменяет счётчик комментариев поста на delta
+function updateCommentCount(post, delta) {
+    var counter = post.querySelector('[data-comment-count]');
+    if (counter) {
+        counter.textContent = Math.max(0, parseInt(counter.textContent, 10) + delta);
+    }
+}
@@ -0,0 +1,38 @@
+// Автодополнение тегов в формах создания и редактирования поста.
+// Подсказки — существующие теги, начинающиеся с последнего введённого тега;
+// значение подсказки содержит уже введённые теги, поэтому выбор заменяет только последний.
+document.addEventListener('DOMContentLoaded', function() {
+    document.querySelectorAll('[data-tag-input]').forEach(function(input) {
+        var list = document.getElementById(input.getAttribute('list'));
+        if (!list) return;
+
+        var timer = null;
+        var update = function() {
+            var parts = input.value.split(',').map(function(part) { return part.trim(); });
+            var current = parts.pop();
+            var entered = parts.filter(function(part) { return part !== ''; });
+            if (current === '') {
+                list.innerHTML = '';
+                return;
+            }
+            fetch('/api/v1/tags?q=' + encodeURIComponent(current), {credentials: 'same-origin'})
+                .then(function(res) { return res.ok ? res.json() : []; })
+                .then(function(tags) {
+                    list.innerHTML = '';
+                    tags.forEach(function(tag) {
+                        if (entered.indexOf(tag.name) !== -1) return;
+                        var option = document.createElement('option');
+                        option.value = entered.concat(tag.name).join(', ');
+                        option.label = tag.name + ' (' + tag.post_count + ')';
+                        list.appendChild(option);
+                    });
+                });
+        };
+
+        // Запрос отправляется после паузы в наборе, а не на каждую клавишу
+        input.addEventListener('input', function() {
+            clearTimeout(timer);
+            timer = setTimeout(update, 200);
+        });
+    });
+});